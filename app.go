@@ -4,13 +4,20 @@ import (
 	"context"
 	"fmt"
 	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/local_api"
 	"github.com/apepenkov/wails_sigilix_interface/sigilix/messenger_client"
+	"log"
+	"sync"
 )
 
 // App struct
 type App struct {
 	Client *messenger_client.MessengerClient
 	ctx    context.Context
+	// localApi is nil unless the user turned the local API on, the frontend may start and stop it
+	// concurrently
+	localApiMu sync.Mutex
+	localApi   *local_api.Server
 }
 
 // NewApp creates a new App application struct
@@ -39,13 +46,17 @@ func (a *App) startup(ctx context.Context) {
 }
 
 // domReady is called after the front-end dom has been loaded
-func (a App) domReady(ctx context.Context) {
+func (a *App) domReady(ctx context.Context) {
 	// Add your action here
 }
 
 // shutdown is called at application termination
 func (a *App) shutdown(ctx context.Context) {
 	// Perform your teardown here
+	_ = a.StopLocalApi()
+	if err := a.Client.Lock(); err != nil {
+		log.Printf("error locking client: %s", err.Error())
+	}
 }
 
 // Greet returns a greeting for the given name
@@ -65,6 +76,31 @@ func (a *App) Unlock(password string) error {
 	return a.Client.Unlock(password)
 }
 
+// Lock closes the session, GetState returns "login" until Unlock is called again.
+func (a *App) Lock() error {
+	return a.Client.Lock()
+}
+
+func (a *App) ReportActivity() {
+	a.Client.ReportActivity()
+}
+
+func (a *App) GetAutoLockTimeout() (int, error) {
+	return a.Client.GetAutoLockTimeout()
+}
+
+func (a *App) SetAutoLockTimeout(minutes int) error {
+	return a.Client.SetAutoLockTimeout(minutes)
+}
+
+func (a *App) DeleteAccount(password string) error {
+	return a.Client.DeleteAccount(password)
+}
+
+func (a *App) SetDuressPassword(password string) error {
+	return a.Client.SetDuressPassword(password)
+}
+
 func (a *App) SignUp(password string) error {
 	return a.Client.SignUp(password)
 }
@@ -134,3 +170,204 @@ func (a *App) RenameChat(chatId uint64, newName string) error {
 func (a *App) DeleteChat(chatId uint64) error {
 	return a.Client.DeleteChat(chatId)
 }
+
+func (a *App) CreateGroup(title string, memberIds []uint64) (*data.Group, error) {
+	return a.Client.CreateGroup(title, memberIds)
+}
+
+func (a *App) GetGroups() ([]*data.Group, error) {
+	return a.Client.GetGroups()
+}
+
+func (a *App) GetGroupMessages(groupId string) ([]*data.GroupMessage, error) {
+	return a.Client.GetGroupMessages(groupId)
+}
+
+func (a *App) SendGroupMessage(groupId string, text string) (*data.GroupMessage, error) {
+	return a.Client.SendGroupMessage(groupId, text)
+}
+
+func (a *App) AddGroupMember(groupId string, userId uint64) (*data.Group, error) {
+	return a.Client.AddGroupMember(groupId, userId)
+}
+
+func (a *App) RemoveGroupMember(groupId string, userId uint64) (*data.Group, error) {
+	return a.Client.RemoveGroupMember(groupId, userId)
+}
+
+func (a *App) ReplyToMessage(chatId uint64, replyTo uint64, text string) (*data.Message, error) {
+	return a.Client.ReplyToMessage(chatId, replyTo, text)
+}
+
+func (a *App) EditMessage(chatId uint64, messageId uint64, text string) (*data.Message, error) {
+	return a.Client.EditMessage(chatId, messageId, text)
+}
+
+func (a *App) DeleteMessage(chatId uint64, messageId uint64) error {
+	return a.Client.DeleteMessage(chatId, messageId)
+}
+
+func (a *App) DeleteMessageForMe(chatId uint64, messageId uint64) error {
+	return a.Client.DeleteMessageForMe(chatId, messageId)
+}
+
+func (a *App) ReactToMessage(chatId uint64, messageId uint64, reaction string) error {
+	return a.Client.ReactToMessage(chatId, messageId, reaction)
+}
+
+func (a *App) MarkChatRead(chatId uint64) error {
+	return a.Client.MarkChatRead(chatId)
+}
+
+func (a *App) ReadReceiptsEnabled() bool {
+	return a.Client.ReadReceiptsEnabled()
+}
+
+func (a *App) SetReadReceiptsEnabled(enabled bool) error {
+	return a.Client.SetReadReceiptsEnabled(enabled)
+}
+
+func (a *App) SendTyping(chatId uint64, typing bool) error {
+	return a.Client.SendTyping(chatId, typing)
+}
+
+func (a *App) GetPresence(chatId uint64) *messenger_client.ChatPresence {
+	return a.Client.GetPresence(chatId)
+}
+
+func (a *App) SetChatExpiry(chatId uint64, ttl uint64) error {
+	return a.Client.SetChatExpiry(chatId, ttl)
+}
+
+func (a *App) GetChatExpiry(chatId uint64) (uint64, error) {
+	return a.Client.GetChatExpiry(chatId)
+}
+
+func (a *App) AddContact(username string, nickname string) (*data.Contact, error) {
+	return a.Client.AddContact(username, nickname)
+}
+
+func (a *App) AddContactFromChat(chatId uint64, nickname string) (*data.Contact, error) {
+	return a.Client.AddContactFromChat(chatId, nickname)
+}
+
+func (a *App) GetContacts() ([]*data.Contact, error) {
+	return a.Client.GetContacts()
+}
+
+func (a *App) GetContact(userId uint64) (*data.Contact, error) {
+	return a.Client.GetContact(userId)
+}
+
+func (a *App) SetContactNickname(userId uint64, nickname string) error {
+	return a.Client.SetContactNickname(userId, nickname)
+}
+
+func (a *App) SetContactVerified(userId uint64, verified bool) error {
+	return a.Client.SetContactVerified(userId, verified)
+}
+
+func (a *App) SetUserBlocked(userId uint64, blocked bool) error {
+	return a.Client.SetUserBlocked(userId, blocked)
+}
+
+func (a *App) DeleteContact(userId uint64) error {
+	return a.Client.DeleteContact(userId)
+}
+
+func (a *App) DeclineChat(chatId uint64) error {
+	return a.Client.DeclineChat(chatId)
+}
+
+func (a *App) GetPendingChatRequests() ([]*data.Chat, error) {
+	return a.Client.GetPendingChatRequests()
+}
+
+func (a *App) GetChatRequestPolicy() data.ChatRequestPolicy {
+	return a.Client.GetChatRequestPolicy()
+}
+
+func (a *App) SetChatRequestPolicy(policy data.ChatRequestPolicy) error {
+	return a.Client.SetChatRequestPolicy(policy)
+}
+
+func (a *App) GetUserInfo(userId uint64) (*data.UserInfo, error) {
+	return a.Client.GetUserInfo(userId)
+}
+
+func (a *App) RefreshUserInfo(userId uint64) (*data.UserInfo, error) {
+	return a.Client.RefreshUserInfo(userId)
+}
+
+func (a *App) StartDeviceLink() (string, error) {
+	return a.Client.StartDeviceLink()
+}
+
+func (a *App) LinkDevice(code string, name string) error {
+	return a.Client.LinkDevice(code, name)
+}
+
+func (a *App) GetLinkedDevices() ([]*data.LinkedDevice, error) {
+	return a.Client.GetLinkedDevices()
+}
+
+func (a *App) UnlinkDevice(deviceUserId uint64) error {
+	return a.Client.UnlinkDevice(deviceUserId)
+}
+
+func (a *App) GetPrimaryUserId() uint64 {
+	return a.Client.GetPrimaryUserId()
+}
+
+// StartLocalApi serves the local API on addr (local_api.DefaultAddr if empty) and returns the path
+// of the token file.
+func (a *App) StartLocalApi(addr string) (string, error) {
+	a.localApiMu.Lock()
+	defer a.localApiMu.Unlock()
+	if a.localApi != nil {
+		return a.localApi.TokenPath(), nil
+	}
+	server, err := local_api.Start(a.Client, local_api.Options{Addr: addr})
+	if err != nil {
+		return "", err
+	}
+	a.localApi = server
+	return server.TokenPath(), nil
+}
+
+func (a *App) StopLocalApi() error {
+	a.localApiMu.Lock()
+	defer a.localApiMu.Unlock()
+	if a.localApi == nil {
+		return nil
+	}
+	err := a.localApi.Close()
+	a.localApi = nil
+	return err
+}
+
+func (a *App) IsLocalApiRunning() bool {
+	a.localApiMu.Lock()
+	defer a.localApiMu.Unlock()
+	return a.localApi != nil
+}
+
+func (a *App) SendFile(chatId uint64, mimeType string, content []byte) (*data.Attachment, error) {
+	return a.Client.SendFile(chatId, mimeType, content)
+}
+
+func (a *App) GetChatAttachments(chatId uint64) ([]*data.Attachment, error) {
+	return a.Client.GetChatAttachments(chatId)
+}
+
+func (a *App) GetAttachment(chatId uint64, messageId uint64) (*data.Attachment, error) {
+	return a.Client.GetAttachment(chatId, messageId)
+}
+
+func (a *App) ExportChat(chatId uint64, format string, path string) error {
+	return a.Client.ExportChat(chatId, messenger_client.ExportFormat(format), path)
+}
+
+func (a *App) ExportAllChats(format string, dir string) ([]string, error) {
+	return a.Client.ExportAllChats(messenger_client.ExportFormat(format), dir)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/crypto_utils"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/messenger_client"
+)
+
+func parseChatId(args []string, minArgs int) (uint64, error) {
+	if len(args) < minArgs {
+		return 0, errors.New("not enough arguments")
+	}
+	chatId, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid chat id %q", args[0])
+	}
+	return chatId, nil
+}
+
+func printChat(chat *data.Chat) {
+	state := "accepted"
+	if !chat.Accepted {
+		if chat.AmIInitiator {
+			state = "waiting"
+		} else {
+			state = "incoming"
+		}
+	}
+	fmt.Printf("%d\t%d\t%s\t%s\n", chat.ChatId, chat.OtherUserId, state, chat.Title)
+}
+
+func printMessage(message *data.Message) {
+	fmt.Printf("[%d] %d: %s\n", message.MessageId, message.SenderId, message.Content)
+}
+
+func cmdSignUp(env *environment, args []string) error {
+	fs := flag.NewFlagSet("signup", flag.ContinueOnError)
+	legacyId := fs.Bool("legacy-id", false, "derive a 32-bit user id, for servers that do not verify wide ones")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if env.client.IsSignedUp() {
+		return fmt.Errorf("%s already holds an identity", env.opts.dataDir)
+	}
+	password, err := readNewPassword(env.opts.passwordFd)
+	if err != nil {
+		return err
+	}
+	version := crypto_utils.UserIdWide
+	if *legacyId {
+		version = crypto_utils.UserIdLegacy
+	}
+	err = env.client.SignUpWithIdVersion(password, version)
+	if err != nil {
+		return err
+	}
+	err = env.client.Unlock(password)
+	if err != nil {
+		return err
+	}
+	return cmdUnlock(env, nil)
+}
+
+func cmdUnlock(env *environment, _ []string) error {
+	info := map[string]interface{}{
+		"user_id":  env.client.GetUserId(),
+		"username": env.client.GetUsername(),
+	}
+	env.print(info, func() {
+		fmt.Printf("user id: %d\nusername: %s\n", env.client.GetUserId(), env.client.GetUsername())
+	})
+	return nil
+}
+
+func cmdChats(env *environment, _ []string) error {
+	chats, err := env.client.GetChats()
+	if err != nil {
+		return err
+	}
+	env.print(chats, func() {
+		for _, chat := range chats {
+			printChat(chat)
+		}
+	})
+	return nil
+}
+
+func cmdMessages(env *environment, args []string) error {
+	chatId, err := parseChatId(args, 1)
+	if err != nil {
+		return err
+	}
+	messages, err := env.client.GetChatMessages(chatId)
+	if err != nil {
+		return err
+	}
+	env.print(messages, func() {
+		for _, message := range messages {
+			printMessage(message)
+		}
+	})
+	return nil
+}
+
+func cmdRequest(env *environment, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected a user id or username")
+	}
+	chat, err := env.client.TryRequestChat(args[0])
+	if err != nil {
+		return err
+	}
+	env.print(chat, func() { printChat(chat) })
+	return nil
+}
+
+func cmdAccept(env *environment, args []string) error {
+	chatId, err := parseChatId(args, 1)
+	if err != nil {
+		return err
+	}
+	chat, err := env.client.InitChatFromReceiver(chatId)
+	if err != nil {
+		return err
+	}
+	env.print(chat, func() { printChat(chat) })
+	return nil
+}
+
+func cmdRequests(env *environment, _ []string) error {
+	chats, err := env.client.GetPendingChatRequests()
+	if err != nil {
+		return err
+	}
+	env.print(chats, func() {
+		for _, chat := range chats {
+			printChat(chat)
+		}
+	})
+	return nil
+}
+
+func cmdDecline(env *environment, args []string) error {
+	chatId, err := parseChatId(args, 1)
+	if err != nil {
+		return err
+	}
+	err = env.client.DeclineChat(chatId)
+	if err != nil {
+		return err
+	}
+	env.print(map[string]interface{}{"chat_id": chatId, "declined": true}, func() {
+		fmt.Println("declined")
+	})
+	return nil
+}
+
+func cmdSend(env *environment, args []string) error {
+	chatId, err := parseChatId(args, 2)
+	if err != nil {
+		return err
+	}
+	message, err := env.client.SendMessage(chatId, joinArgs(args[1:]))
+	if err != nil {
+		return err
+	}
+	env.print(message, func() { printMessage(message) })
+	return nil
+}
+
+func printNotification(env *environment, notification *messenger_client.WebNotificationWithTypeInfo) {
+	env.print(notification, func() {
+		switch n := notification.Notification.(type) {
+		case *messenger_client.IncomingChatNotification:
+			fmt.Printf("incoming chat: ")
+			printChat(n.Chat)
+		case *messenger_client.ChatAcceptedNotification:
+			fmt.Printf("chat accepted: ")
+			printChat(n.Chat)
+		case *messenger_client.NewMessageNotification:
+			fmt.Printf("chat %d ", n.ChatId)
+			printMessage(n.Message)
+		default:
+			fmt.Printf("%s\n", notification.Type)
+		}
+	})
+}
+
+func cmdTail(env *environment, args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	interval := fs.Duration("interval", 2*time.Second, "polling interval")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	for {
+		notifications, err := env.client.PullNotificationsAndUpdateData()
+		if err != nil {
+			return err
+		}
+		for _, notification := range notifications {
+			printNotification(env, notification)
+		}
+		time.Sleep(*interval)
+	}
+}
+
+func cmdRename(env *environment, args []string) error {
+	chatId, err := parseChatId(args, 2)
+	if err != nil {
+		return err
+	}
+	err = env.client.RenameChat(chatId, joinArgs(args[1:]))
+	if err != nil {
+		return err
+	}
+	env.print(map[string]interface{}{"chat_id": chatId, "title": joinArgs(args[1:])}, func() {
+		fmt.Println("renamed")
+	})
+	return nil
+}
+
+func cmdDelete(env *environment, args []string) error {
+	chatId, err := parseChatId(args, 1)
+	if err != nil {
+		return err
+	}
+	err = env.client.DeleteChat(chatId)
+	if err != nil {
+		return err
+	}
+	env.print(map[string]interface{}{"chat_id": chatId, "deleted": true}, func() {
+		fmt.Println("deleted")
+	})
+	return nil
+}
+
+func cmdSetUsername(env *environment, args []string) error {
+	fs := flag.NewFlagSet("set-username", flag.ContinueOnError)
+	searchable := fs.Bool("searchable", false, "allow other users to find you by username")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("expected a username")
+	}
+	err := env.client.SetUsernameConfig(fs.Arg(0), *searchable)
+	if err != nil {
+		return err
+	}
+	env.print(map[string]interface{}{"username": fs.Arg(0), "searchable": *searchable}, func() {
+		fmt.Println("username updated")
+	})
+	return nil
+}
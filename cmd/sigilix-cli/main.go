@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/messenger_client"
+)
+
+const defaultApiUrl = "https://sigilix.aperlaqf.work/api/"
+
+type globalOptions struct {
+	apiUrl     string
+	dataDir    string
+	jsonOutput bool
+	passwordFd int
+	ephemeral  bool
+}
+
+type command struct {
+	usage       string
+	description string
+	// needsUnlock commands get an unlocked client
+	needsUnlock bool
+	// needsSync commands act on local state, notifications are pulled before they run, see sync
+	needsSync bool
+	run       func(env *environment, args []string) error
+}
+
+type environment struct {
+	opts   *globalOptions
+	client *messenger_client.MessengerClient
+}
+
+var commands = map[string]*command{
+	"signup":       {usage: "signup [-legacy-id]", description: "create a new identity in the data directory", run: cmdSignUp},
+	"unlock":       {usage: "unlock", description: "check the password and print the account info", needsUnlock: true, run: cmdUnlock},
+	"chats":        {usage: "chats", description: "list chats", needsUnlock: true, needsSync: true, run: cmdChats},
+	"messages":     {usage: "messages <chat_id>", description: "list messages of a chat", needsUnlock: true, needsSync: true, run: cmdMessages},
+	"request":      {usage: "request <user_id|username>", description: "request a chat with a user", needsUnlock: true, run: cmdRequest},
+	"accept":       {usage: "accept <chat_id>", description: "accept an incoming chat request", needsUnlock: true, needsSync: true, run: cmdAccept},
+	"requests":     {usage: "requests", description: "list incoming chat requests", needsUnlock: true, needsSync: true, run: cmdRequests},
+	"decline":      {usage: "decline <chat_id>", description: "decline an incoming chat request", needsUnlock: true, needsSync: true, run: cmdDecline},
+	"send":         {usage: "send <chat_id> <text...>", description: "send a message", needsUnlock: true, needsSync: true, run: cmdSend},
+	"tail":         {usage: "tail [-interval 2s]", description: "follow incoming notifications", needsUnlock: true, run: cmdTail},
+	"rename":       {usage: "rename <chat_id> <title...>", description: "rename a chat", needsUnlock: true, needsSync: true, run: cmdRename},
+	"delete":       {usage: "delete <chat_id>", description: "leave a chat and delete it with its history", needsUnlock: true, needsSync: true, run: cmdDelete},
+	"set-username": {usage: "set-username [-searchable] <username>", description: "set the username and its visibility", needsUnlock: true, run: cmdSetUsername},
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: sigilix-cli [options] <command> [args]\n\nOptions:\n")
+	flag.PrintDefaults()
+	fmt.Fprintf(out, "\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-40s %s\n", commands[name].usage, commands[name].description)
+	}
+}
+
+func main() {
+	opts := &globalOptions{}
+	flag.StringVar(&opts.apiUrl, "api", defaultApiUrl, "Sigilix API base url")
+	flag.StringVar(&opts.dataDir, "dir", ".", "directory holding config.json and the database")
+	flag.BoolVar(&opts.jsonOutput, "json", false, "print machine-readable JSON")
+	flag.IntVar(&opts.passwordFd, "password-fd", -1, "read the password from this file descriptor instead of the terminal")
+	flag.BoolVar(&opts.ephemeral, "ephemeral", false, "keep chats and messages in memory only, they are lost when the command exits")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	os.Exit(run(opts, cmd, flag.Args()[1:]))
+}
+
+// run runs cmd and returns the exit code. The client is locked before, which closes the database.
+func run(opts *globalOptions, cmd *command, args []string) int {
+	env := &environment{
+		opts:   opts,
+		client: messenger_client.NewClientWithDataDir(opts.apiUrl, opts.dataDir),
+	}
+	if opts.ephemeral {
+		env.client.UseInMemoryStore()
+	}
+	defer func() {
+		if err := env.client.Lock(); err != nil {
+			report(opts, err)
+		}
+	}()
+	if cmd.needsUnlock {
+		if err := env.unlock(); err != nil {
+			report(opts, err)
+			return 1
+		}
+	}
+	if cmd.needsSync {
+		env.sync()
+	}
+	if err := cmd.run(env, args); err != nil {
+		report(opts, err)
+		return 1
+	}
+	return 0
+}
+
+func (e *environment) unlock() error {
+	if !e.client.IsSignedUp() {
+		return fmt.Errorf("no identity in %s, run signup first", e.opts.dataDir)
+	}
+	password, err := readPassword(e.opts.passwordFd, "Password: ")
+	if err != nil {
+		return err
+	}
+	return e.client.Unlock(password)
+}
+
+// sync applies the notifications waiting on the server, which hands them out only once, before a
+// command acts on local state. Without a connection the command runs on what is stored.
+func (e *environment) sync() {
+	if _, err := e.client.PullNotificationsAndUpdateData(); err != nil {
+		report(e.opts, fmt.Errorf("could not pull notifications, local data may be out of date: %w", err))
+	}
+}
+
+// print writes v as a JSON line in json mode, otherwise calls human
+func (e *environment) print(v interface{}, human func()) {
+	if e.opts.jsonOutput {
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			report(e.opts, err)
+			return
+		}
+		fmt.Println(string(encoded))
+		return
+	}
+	human()
+}
+
+func report(opts *globalOptions, err error) {
+	if opts.jsonOutput {
+		encoded, _ := json.Marshal(map[string]string{"error": err.Error()})
+		fmt.Fprintln(os.Stderr, string(encoded))
+	} else {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+	}
+}
+
+func joinArgs(args []string) string {
+	return strings.Join(args, " ")
+}
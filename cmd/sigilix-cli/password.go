@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// readPassword reads from the given file descriptor if fd >= 0, from the terminal without echo if
+// stdin is a TTY, and otherwise takes the first line of stdin.
+func readPassword(fd int, prompt string) (string, error) {
+	if fd >= 0 {
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+		if f == nil {
+			return "", fmt.Errorf("invalid password file descriptor %d", fd)
+		}
+		defer f.Close()
+		return readPasswordLine(f)
+	}
+
+	stdinFd := int(os.Stdin.Fd())
+	if term.IsTerminal(stdinFd) {
+		fmt.Fprint(os.Stderr, prompt)
+		password, err := term.ReadPassword(stdinFd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		return string(password), nil
+	}
+	return readPasswordLine(os.Stdin)
+}
+
+func readPasswordLine(f *os.File) (string, error) {
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && line == "" {
+		return "", errors.New("no password provided")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func readNewPassword(fd int) (string, error) {
+	password, err := readPassword(fd, "New password: ")
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", errors.New("password must not be empty")
+	}
+	if fd < 0 && term.IsTerminal(int(os.Stdin.Fd())) {
+		repeated, err := readPassword(fd, "Repeat password: ")
+		if err != nil {
+			return "", err
+		}
+		if repeated != password {
+			return "", errors.New("passwords do not match")
+		}
+	}
+	return password, nil
+}
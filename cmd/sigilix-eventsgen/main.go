@@ -0,0 +1,155 @@
+// Command sigilix-eventsgen writes the TypeScript definitions of the notifications in
+// messenger_client.Events, see the go:generate line in sigilix/messenger_client/events.go.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/messenger_client"
+)
+
+type generator struct {
+	// interfaces by name, and the type each name was taken by
+	interfaces map[string]string
+	owners     map[string]reflect.Type
+	order      []string
+}
+
+func main() {
+	output := flag.String("o", "events.d.ts", "file to write")
+	flag.Parse()
+
+	g := &generator{interfaces: make(map[string]string), owners: make(map[string]reflect.Type)}
+	var variants []string
+	for _, event := range messenger_client.Events {
+		name, err := g.structInterface(reflect.TypeOf(event).Elem())
+		if err != nil {
+			log.Fatal(err)
+		}
+		variants = append(variants, fmt.Sprintf("\t| { type: %q; notification: %s }", event.NotificationType(), name))
+	}
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by cmd/sigilix-eventsgen. DO NOT EDIT.\n")
+	out.WriteString("// Events sent by PullNotificationsAndUpdateData and to subscribers, switch on `type`.\n\n")
+	for _, name := range g.order {
+		out.WriteString(g.interfaces[name])
+		out.WriteString("\n")
+	}
+	types := make([]string, 0, len(messenger_client.Events))
+	for _, event := range messenger_client.Events {
+		types = append(types, fmt.Sprintf("%q", event.NotificationType()))
+	}
+	sort.Strings(types)
+	fmt.Fprintf(&out, "export type WebNotificationType =\n\t| %s;\n\n", strings.Join(types, "\n\t| "))
+	fmt.Fprintf(&out, "export type WebNotificationWithTypeInfo =\n%s;\n", strings.Join(variants, "\n"))
+
+	if err := os.WriteFile(*output, out.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// structInterface declares the interface of a struct type once and returns its name.
+func (g *generator) structInterface(t reflect.Type) (string, error) {
+	name := t.Name()
+	if owner, ok := g.owners[name]; ok {
+		if owner != t {
+			return "", fmt.Errorf("%s and %s would both be named %s", owner, t, name)
+		}
+		return name, nil
+	}
+	g.owners[name] = t
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "export interface %s {\n", name)
+	if err := g.fields(t, &body); err != nil {
+		return "", err
+	}
+	body.WriteString("}\n")
+	g.interfaces[name] = body.String()
+	g.order = append(g.order, name)
+	return name, nil
+}
+
+// fields writes the fields the way encoding/json marshals them, embedded structs are flattened.
+func (g *generator) fields(t reflect.Type, body *strings.Builder) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && tag == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if err := g.fields(embedded, body); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		optional := ""
+		if strings.Contains(options, "omitempty") {
+			optional = "?"
+		}
+		tsType, err := g.tsType(field.Type)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", t.Name(), field.Name, err)
+		}
+		fmt.Fprintf(body, "\t%s%s: %s;\n", name, optional, tsType)
+	}
+	return nil
+}
+
+func (g *generator) tsType(t reflect.Type) (string, error) {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number", nil
+	case reflect.String:
+		return "string", nil
+	case reflect.Pointer:
+		return g.tsType(t.Elem())
+	case reflect.Interface:
+		return "any", nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// base64, like encoding/json
+			return "string", nil
+		}
+		elem, err := g.tsType(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		return elem + "[]", nil
+	case reflect.Map:
+		elem, err := g.tsType(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		return "Record<string, " + elem + ">", nil
+	case reflect.Struct:
+		return g.structInterface(t)
+	}
+	return "", fmt.Errorf("unsupported type %s", t)
+}
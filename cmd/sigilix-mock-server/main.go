@@ -0,0 +1,24 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/mock_server"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:8080", "address to listen on")
+	flag.Parse()
+
+	server, err := mock_server.NewServer()
+	if err != nil {
+		log.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/api/", http.StripPrefix("/api", server))
+
+	log.Printf("mock Sigilix server listening on http://%s/api/", *listen)
+	log.Fatal(http.ListenAndServe(*listen, mux))
+}
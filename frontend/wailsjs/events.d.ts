@@ -0,0 +1,261 @@
+// Code generated by cmd/sigilix-eventsgen. DO NOT EDIT.
+// Events sent by PullNotificationsAndUpdateData and to subscribers, switch on `type`.
+
+export interface MessagePreview {
+	message_id: number;
+	sender_id: number;
+	text: string;
+	deleted: boolean;
+	mime_type?: string;
+}
+
+export interface Reaction {
+	user_id: number;
+	reaction: string;
+}
+
+export interface Message {
+	message_id: number;
+	chat_id: number;
+	sender_id: number;
+	content: string;
+	reply_to: number;
+	edited: boolean;
+	deleted: boolean;
+	status: string;
+	reactions: Reaction[];
+	expires_at: number;
+}
+
+export interface Chat {
+	chat_id: number;
+	other_user_id: number;
+	last_message_id: number;
+	last_activity_at: number;
+	am_i_initiator: boolean;
+	accepted: boolean;
+	OtherUserRsaPublic: string;
+	OtherUserEcdsaPublic: string;
+	title: string;
+	message_ttl: number;
+	state: string;
+	mirrored_from: number;
+	other_username: string;
+	preview?: MessagePreview;
+	messages: Message[];
+}
+
+export interface IncomingChatNotification {
+	chat: Chat;
+}
+
+export interface NewMessageNotification {
+	chat_id?: number;
+	message?: Message;
+	sender_username?: string;
+}
+
+export interface ChatAcceptedNotification {
+	chat: Chat;
+}
+
+export interface GroupMember {
+	group_id: string;
+	user_id: number;
+}
+
+export interface Group {
+	group_id: string;
+	title: string;
+	owner_id: number;
+	left: boolean;
+	members: GroupMember[];
+}
+
+export interface NewGroupNotification {
+	group: Group;
+}
+
+export interface GroupUpdatedNotification {
+	group: Group;
+}
+
+export interface GroupMessage {
+	id: number;
+	group_id: string;
+	sender_id: number;
+	iteration: number;
+	content: string;
+}
+
+export interface NewGroupMessageNotification {
+	group_id: string;
+	message: GroupMessage;
+}
+
+export interface MessageStatusNotification {
+	chat_id: number;
+	message_ids: number[];
+	status: string;
+}
+
+export interface MessageEditedNotification {
+	chat_id: number;
+	message: Message;
+}
+
+export interface MessageDeletedNotification {
+	chat_id: number;
+	message_id: number;
+}
+
+export interface MessageReactionNotification {
+	chat_id: number;
+	message_id: number;
+	user_id: number;
+	reaction: string;
+}
+
+export interface MessagesExpiredNotification {
+	chat_id: number;
+	message_ids: number[];
+}
+
+export interface ChatTimerNotification {
+	chat_id: number;
+	user_id: number;
+	ttl: number;
+}
+
+export interface SecurityAlertNotification {
+	kind: string;
+	user_id: number;
+	chat_id?: number;
+	detail: string;
+}
+
+export interface DeviceLinkedNotification {
+	primary_user_id: number;
+	device_user_id?: number;
+}
+
+export interface DeviceUnlinkedNotification {
+	primary_user_id: number;
+}
+
+export interface DeviceHistoryNotification {
+	chat_id: number;
+	messages: number;
+}
+
+export interface Attachment {
+	chat_id: number;
+	message_id: number;
+	sender_id: number;
+	mime_type: string;
+	size: number;
+	content?: string;
+	created_at: number;
+	expires_at: number;
+}
+
+export interface FileReceivedNotification {
+	chat_id: number;
+	attachment: Attachment;
+}
+
+export interface ChatClosedNotification {
+	chat_id: number;
+	user_id: number;
+}
+
+export interface AccountClosedNotification {
+	chat_id: number;
+	user_id: number;
+}
+
+export interface KeyChangedNotification {
+	chat_id: number;
+	user_id: number;
+}
+
+export interface DecryptFailedNotification {
+	chat_id: number;
+	message_id: number;
+	sender_id: number;
+	reason: string;
+}
+
+export interface UsernameChangedNotification {
+	user_id: number;
+	old_username: string;
+	username: string;
+}
+
+export interface ConnectionStateNotification {
+	state: string;
+	error?: string;
+}
+
+export interface ChatPresence {
+	chat_id: number;
+	user_id: number;
+	typing: boolean;
+	online: boolean;
+}
+
+export interface PresenceNotification {
+	presence: ChatPresence;
+}
+
+export type WebNotificationType =
+	| "account_closed"
+	| "chat_accepted"
+	| "chat_closed"
+	| "chat_timer"
+	| "connection_state"
+	| "decrypt_failed"
+	| "device_history"
+	| "device_linked"
+	| "device_unlinked"
+	| "file_received"
+	| "group_updated"
+	| "key_changed"
+	| "message_deleted"
+	| "message_edited"
+	| "message_reaction"
+	| "message_status"
+	| "messages_expired"
+	| "new_group"
+	| "new_group_message"
+	| "new_incoming_chat"
+	| "new_message"
+	| "presence"
+	| "security_alert"
+	| "username_changed";
+
+export type WebNotificationWithTypeInfo =
+	| { type: "new_incoming_chat"; notification: IncomingChatNotification }
+	| { type: "new_message"; notification: NewMessageNotification }
+	| { type: "chat_accepted"; notification: ChatAcceptedNotification }
+	| { type: "new_group"; notification: NewGroupNotification }
+	| { type: "group_updated"; notification: GroupUpdatedNotification }
+	| { type: "new_group_message"; notification: NewGroupMessageNotification }
+	| { type: "message_status"; notification: MessageStatusNotification }
+	| { type: "message_edited"; notification: MessageEditedNotification }
+	| { type: "message_deleted"; notification: MessageDeletedNotification }
+	| { type: "message_reaction"; notification: MessageReactionNotification }
+	| { type: "messages_expired"; notification: MessagesExpiredNotification }
+	| { type: "chat_timer"; notification: ChatTimerNotification }
+	| { type: "security_alert"; notification: SecurityAlertNotification }
+	| { type: "device_linked"; notification: DeviceLinkedNotification }
+	| { type: "device_unlinked"; notification: DeviceUnlinkedNotification }
+	| { type: "device_history"; notification: DeviceHistoryNotification }
+	| { type: "file_received"; notification: FileReceivedNotification }
+	| { type: "chat_closed"; notification: ChatClosedNotification }
+	| { type: "account_closed"; notification: AccountClosedNotification }
+	| { type: "key_changed"; notification: KeyChangedNotification }
+	| { type: "decrypt_failed"; notification: DecryptFailedNotification }
+	| { type: "username_changed"; notification: UsernameChangedNotification }
+	| { type: "connection_state"; notification: ConnectionStateNotification }
+	| { type: "presence"; notification: PresenceNotification };
@@ -3,18 +3,70 @@
 import {data} from '../models';
 import {messenger_client} from '../models';
 
+export function AddContact(arg1:string,arg2:string):Promise<data.Contact>;
+
+export function AddContactFromChat(arg1:number,arg2:string):Promise<data.Contact>;
+
+export function AddGroupMember(arg1:string,arg2:number):Promise<data.Group>;
+
+export function CreateGroup(arg1:string,arg2:Array<number>):Promise<data.Group>;
+
+export function DeclineChat(arg1:number):Promise<void>;
+
+export function DeleteAccount(arg1:string):Promise<void>;
+
 export function DeleteChat(arg1:number):Promise<void>;
 
+export function DeleteContact(arg1:number):Promise<void>;
+
+export function DeleteMessage(arg1:number,arg2:number):Promise<void>;
+
+export function DeleteMessageForMe(arg1:number,arg2:number):Promise<void>;
+
+export function EditMessage(arg1:number,arg2:number,arg3:string):Promise<data.Message>;
+
+export function ExportAllChats(arg1:string,arg2:string):Promise<Array<string>>;
+
+export function ExportChat(arg1:number,arg2:string,arg3:string):Promise<void>;
+
+export function GetAttachment(arg1:number,arg2:number):Promise<data.Attachment>;
+
+export function GetAutoLockTimeout():Promise<number>;
+
 export function GetChat(arg1:number):Promise<data.Chat>;
 
+export function GetChatAttachments(arg1:number):Promise<Array<data.Attachment>>;
+
+export function GetChatExpiry(arg1:number):Promise<number>;
+
 export function GetChatMessages(arg1:number):Promise<Array<data.Message>>;
 
+export function GetChatRequestPolicy():Promise<data.ChatRequestPolicy>;
+
 export function GetChats():Promise<Array<data.Chat>>;
 
+export function GetContact(arg1:number):Promise<data.Contact>;
+
+export function GetContacts():Promise<Array<data.Contact>>;
+
+export function GetGroupMessages(arg1:string):Promise<Array<data.GroupMessage>>;
+
+export function GetGroups():Promise<Array<data.Group>>;
+
+export function GetLinkedDevices():Promise<Array<data.LinkedDevice>>;
+
+export function GetPendingChatRequests():Promise<Array<data.Chat>>;
+
+export function GetPresence(arg1:number):Promise<messenger_client.ChatPresence>;
+
+export function GetPrimaryUserId():Promise<number>;
+
 export function GetState():Promise<string>;
 
 export function GetUserId():Promise<number>;
 
+export function GetUserInfo(arg1:number):Promise<data.UserInfo>;
+
 export function GetUsername():Promise<string>;
 
 export function Greet(arg1:string):Promise<string>;
@@ -23,22 +75,72 @@ export function InitChatFromInitializer(arg1:number):Promise<data.Chat>;
 
 export function InitChatFromReceiver(arg1:number):Promise<data.Chat>;
 
+export function IsLocalApiRunning():Promise<boolean>;
+
 export function IsSignedUp():Promise<boolean>;
 
 export function IsUnlocked():Promise<boolean>;
 
+export function LinkDevice(arg1:string,arg2:string):Promise<void>;
+
+export function Lock():Promise<void>;
+
+export function MarkChatRead(arg1:number):Promise<void>;
+
 export function PullNotificationsAndUpdateData():Promise<Array<messenger_client.WebNotificationWithTypeInfo>>;
 
+export function ReactToMessage(arg1:number,arg2:number,arg3:string):Promise<void>;
+
+export function ReadReceiptsEnabled():Promise<boolean>;
+
+export function RefreshUserInfo(arg1:number):Promise<data.UserInfo>;
+
+export function RemoveGroupMember(arg1:string,arg2:number):Promise<data.Group>;
+
 export function RenameChat(arg1:number,arg2:string):Promise<void>;
 
+export function ReplyToMessage(arg1:number,arg2:number,arg3:string):Promise<data.Message>;
+
+export function ReportActivity():Promise<void>;
+
 export function SearchByUsername(arg1:string):Promise<number>;
 
+export function SendFile(arg1:number,arg2:string,arg3:Array<number>):Promise<data.Attachment>;
+
+export function SendGroupMessage(arg1:string,arg2:string):Promise<data.GroupMessage>;
+
 export function SendMessage(arg1:number,arg2:string):Promise<data.Message>;
 
+export function SendTyping(arg1:number,arg2:boolean):Promise<void>;
+
+export function SetAutoLockTimeout(arg1:number):Promise<void>;
+
+export function SetChatExpiry(arg1:number,arg2:number):Promise<void>;
+
+export function SetChatRequestPolicy(arg1:data.ChatRequestPolicy):Promise<void>;
+
+export function SetContactNickname(arg1:number,arg2:string):Promise<void>;
+
+export function SetContactVerified(arg1:number,arg2:boolean):Promise<void>;
+
+export function SetDuressPassword(arg1:string):Promise<void>;
+
+export function SetReadReceiptsEnabled(arg1:boolean):Promise<void>;
+
+export function SetUserBlocked(arg1:number,arg2:boolean):Promise<void>;
+
 export function SetUsernameConfig(arg1:string,arg2:boolean):Promise<void>;
 
 export function SignUp(arg1:string):Promise<void>;
 
+export function StartDeviceLink():Promise<string>;
+
+export function StartLocalApi(arg1:string):Promise<string>;
+
+export function StopLocalApi():Promise<void>;
+
 export function TryRequestChat(arg1:string):Promise<data.Chat>;
 
+export function UnlinkDevice(arg1:number):Promise<void>;
+
 export function Unlock(arg1:string):Promise<void>;
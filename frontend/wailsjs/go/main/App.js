@@ -2,22 +2,122 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function AddContact(arg1, arg2) {
+  return window['go']['main']['App']['AddContact'](arg1, arg2);
+}
+
+export function AddContactFromChat(arg1, arg2) {
+  return window['go']['main']['App']['AddContactFromChat'](arg1, arg2);
+}
+
+export function AddGroupMember(arg1, arg2) {
+  return window['go']['main']['App']['AddGroupMember'](arg1, arg2);
+}
+
+export function CreateGroup(arg1, arg2) {
+  return window['go']['main']['App']['CreateGroup'](arg1, arg2);
+}
+
+export function DeclineChat(arg1) {
+  return window['go']['main']['App']['DeclineChat'](arg1);
+}
+
+export function DeleteAccount(arg1) {
+  return window['go']['main']['App']['DeleteAccount'](arg1);
+}
+
 export function DeleteChat(arg1) {
   return window['go']['main']['App']['DeleteChat'](arg1);
 }
 
+export function DeleteContact(arg1) {
+  return window['go']['main']['App']['DeleteContact'](arg1);
+}
+
+export function DeleteMessage(arg1, arg2) {
+  return window['go']['main']['App']['DeleteMessage'](arg1, arg2);
+}
+
+export function DeleteMessageForMe(arg1, arg2) {
+  return window['go']['main']['App']['DeleteMessageForMe'](arg1, arg2);
+}
+
+export function EditMessage(arg1, arg2, arg3) {
+  return window['go']['main']['App']['EditMessage'](arg1, arg2, arg3);
+}
+
+export function ExportAllChats(arg1, arg2) {
+  return window['go']['main']['App']['ExportAllChats'](arg1, arg2);
+}
+
+export function ExportChat(arg1, arg2, arg3) {
+  return window['go']['main']['App']['ExportChat'](arg1, arg2, arg3);
+}
+
+export function GetAttachment(arg1, arg2) {
+  return window['go']['main']['App']['GetAttachment'](arg1, arg2);
+}
+
+export function GetAutoLockTimeout() {
+  return window['go']['main']['App']['GetAutoLockTimeout']();
+}
+
 export function GetChat(arg1) {
   return window['go']['main']['App']['GetChat'](arg1);
 }
 
+export function GetChatAttachments(arg1) {
+  return window['go']['main']['App']['GetChatAttachments'](arg1);
+}
+
+export function GetChatExpiry(arg1) {
+  return window['go']['main']['App']['GetChatExpiry'](arg1);
+}
+
 export function GetChatMessages(arg1) {
   return window['go']['main']['App']['GetChatMessages'](arg1);
 }
 
+export function GetChatRequestPolicy() {
+  return window['go']['main']['App']['GetChatRequestPolicy']();
+}
+
 export function GetChats() {
   return window['go']['main']['App']['GetChats']();
 }
 
+export function GetContact(arg1) {
+  return window['go']['main']['App']['GetContact'](arg1);
+}
+
+export function GetContacts() {
+  return window['go']['main']['App']['GetContacts']();
+}
+
+export function GetGroupMessages(arg1) {
+  return window['go']['main']['App']['GetGroupMessages'](arg1);
+}
+
+export function GetGroups() {
+  return window['go']['main']['App']['GetGroups']();
+}
+
+export function GetLinkedDevices() {
+  return window['go']['main']['App']['GetLinkedDevices']();
+}
+
+export function GetPendingChatRequests() {
+  return window['go']['main']['App']['GetPendingChatRequests']();
+}
+
+export function GetPresence(arg1) {
+  return window['go']['main']['App']['GetPresence'](arg1);
+}
+
+export function GetPrimaryUserId() {
+  return window['go']['main']['App']['GetPrimaryUserId']();
+}
+
 export function GetState() {
   return window['go']['main']['App']['GetState']();
 }
@@ -26,6 +126,10 @@ export function GetUserId() {
   return window['go']['main']['App']['GetUserId']();
 }
 
+export function GetUserInfo(arg1) {
+  return window['go']['main']['App']['GetUserInfo'](arg1);
+}
+
 export function GetUsername() {
   return window['go']['main']['App']['GetUsername']();
 }
@@ -42,6 +146,10 @@ export function InitChatFromReceiver(arg1) {
   return window['go']['main']['App']['InitChatFromReceiver'](arg1);
 }
 
+export function IsLocalApiRunning() {
+  return window['go']['main']['App']['IsLocalApiRunning']();
+}
+
 export function IsSignedUp() {
   return window['go']['main']['App']['IsSignedUp']();
 }
@@ -50,22 +158,102 @@ export function IsUnlocked() {
   return window['go']['main']['App']['IsUnlocked']();
 }
 
+export function LinkDevice(arg1, arg2) {
+  return window['go']['main']['App']['LinkDevice'](arg1, arg2);
+}
+
+export function Lock() {
+  return window['go']['main']['App']['Lock']();
+}
+
+export function MarkChatRead(arg1) {
+  return window['go']['main']['App']['MarkChatRead'](arg1);
+}
+
 export function PullNotificationsAndUpdateData() {
   return window['go']['main']['App']['PullNotificationsAndUpdateData']();
 }
 
+export function ReactToMessage(arg1, arg2, arg3) {
+  return window['go']['main']['App']['ReactToMessage'](arg1, arg2, arg3);
+}
+
+export function ReadReceiptsEnabled() {
+  return window['go']['main']['App']['ReadReceiptsEnabled']();
+}
+
+export function RefreshUserInfo(arg1) {
+  return window['go']['main']['App']['RefreshUserInfo'](arg1);
+}
+
+export function RemoveGroupMember(arg1, arg2) {
+  return window['go']['main']['App']['RemoveGroupMember'](arg1, arg2);
+}
+
 export function RenameChat(arg1, arg2) {
   return window['go']['main']['App']['RenameChat'](arg1, arg2);
 }
 
+export function ReplyToMessage(arg1, arg2, arg3) {
+  return window['go']['main']['App']['ReplyToMessage'](arg1, arg2, arg3);
+}
+
+export function ReportActivity() {
+  return window['go']['main']['App']['ReportActivity']();
+}
+
 export function SearchByUsername(arg1) {
   return window['go']['main']['App']['SearchByUsername'](arg1);
 }
 
+export function SendFile(arg1, arg2, arg3) {
+  return window['go']['main']['App']['SendFile'](arg1, arg2, arg3);
+}
+
+export function SendGroupMessage(arg1, arg2) {
+  return window['go']['main']['App']['SendGroupMessage'](arg1, arg2);
+}
+
 export function SendMessage(arg1, arg2) {
   return window['go']['main']['App']['SendMessage'](arg1, arg2);
 }
 
+export function SendTyping(arg1, arg2) {
+  return window['go']['main']['App']['SendTyping'](arg1, arg2);
+}
+
+export function SetAutoLockTimeout(arg1) {
+  return window['go']['main']['App']['SetAutoLockTimeout'](arg1);
+}
+
+export function SetChatExpiry(arg1, arg2) {
+  return window['go']['main']['App']['SetChatExpiry'](arg1, arg2);
+}
+
+export function SetChatRequestPolicy(arg1) {
+  return window['go']['main']['App']['SetChatRequestPolicy'](arg1);
+}
+
+export function SetContactNickname(arg1, arg2) {
+  return window['go']['main']['App']['SetContactNickname'](arg1, arg2);
+}
+
+export function SetContactVerified(arg1, arg2) {
+  return window['go']['main']['App']['SetContactVerified'](arg1, arg2);
+}
+
+export function SetDuressPassword(arg1) {
+  return window['go']['main']['App']['SetDuressPassword'](arg1);
+}
+
+export function SetReadReceiptsEnabled(arg1) {
+  return window['go']['main']['App']['SetReadReceiptsEnabled'](arg1);
+}
+
+export function SetUserBlocked(arg1, arg2) {
+  return window['go']['main']['App']['SetUserBlocked'](arg1, arg2);
+}
+
 export function SetUsernameConfig(arg1, arg2) {
   return window['go']['main']['App']['SetUsernameConfig'](arg1, arg2);
 }
@@ -74,10 +262,26 @@ export function SignUp(arg1) {
   return window['go']['main']['App']['SignUp'](arg1);
 }
 
+export function StartDeviceLink() {
+  return window['go']['main']['App']['StartDeviceLink']();
+}
+
+export function StartLocalApi(arg1) {
+  return window['go']['main']['App']['StartLocalApi'](arg1);
+}
+
+export function StopLocalApi() {
+  return window['go']['main']['App']['StopLocalApi']();
+}
+
 export function TryRequestChat(arg1) {
   return window['go']['main']['App']['TryRequestChat'](arg1);
 }
 
+export function UnlinkDevice(arg1) {
+  return window['go']['main']['App']['UnlinkDevice'](arg1);
+}
+
 export function Unlock(arg1) {
   return window['go']['main']['App']['Unlock'](arg1);
 }
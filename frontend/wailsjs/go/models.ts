@@ -1,10 +1,30 @@
 export namespace data {
 	
+	export class Reaction {
+	    user_id: number;
+	    reaction: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Reaction(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.user_id = source["user_id"];
+	        this.reaction = source["reaction"];
+	    }
+	}
 	export class Message {
 	    message_id: number;
 	    chat_id: number;
 	    sender_id: number;
 	    content: string;
+	    reply_to: number;
+	    edited: boolean;
+	    deleted: boolean;
+	    status: string;
+	    reactions: Reaction[];
+	    expires_at: number;
 	
 	    static createFrom(source: any = {}) {
 	        return new Message(source);
@@ -16,15 +36,65 @@ export namespace data {
 	        this.chat_id = source["chat_id"];
 	        this.sender_id = source["sender_id"];
 	        this.content = source["content"];
+	        this.reply_to = source["reply_to"];
+	        this.edited = source["edited"];
+	        this.deleted = source["deleted"];
+	        this.status = source["status"];
+	        this.reactions = this.convertValues(source["reactions"], Reaction);
+	        this.expires_at = source["expires_at"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class MessagePreview {
+	    message_id: number;
+	    sender_id: number;
+	    text: string;
+	    deleted: boolean;
+	    mime_type: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new MessagePreview(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.message_id = source["message_id"];
+	        this.sender_id = source["sender_id"];
+	        this.text = source["text"];
+	        this.deleted = source["deleted"];
+	        this.mime_type = source["mime_type"];
 	    }
 	}
 	export class Chat {
 	    chat_id: number;
 	    other_user_id: number;
 	    last_message_id: number;
+	    last_activity_at: number;
 	    am_i_initiator: boolean;
 	    accepted: boolean;
 	    title: string;
+	    message_ttl: number;
+	    state: string;
+	    mirrored_from: number;
+	    other_username: string;
+	    preview: MessagePreview;
 	    messages: Message[];
 	
 	    static createFrom(source: any = {}) {
@@ -36,9 +106,15 @@ export namespace data {
 	        this.chat_id = source["chat_id"];
 	        this.other_user_id = source["other_user_id"];
 	        this.last_message_id = source["last_message_id"];
+	        this.last_activity_at = source["last_activity_at"];
 	        this.am_i_initiator = source["am_i_initiator"];
 	        this.accepted = source["accepted"];
 	        this.title = source["title"];
+	        this.message_ttl = source["message_ttl"];
+	        this.state = source["state"];
+	        this.mirrored_from = source["mirrored_from"];
+	        this.other_username = source["other_username"];
+	        this.preview = this.convertValues(source["preview"], MessagePreview);
 	        this.messages = this.convertValues(source["messages"], Message);
 	    }
 	
@@ -60,6 +136,182 @@ export namespace data {
 		    return a;
 		}
 	}
+	export class GroupMember {
+	    group_id: string;
+	    user_id: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new GroupMember(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.group_id = source["group_id"];
+	        this.user_id = source["user_id"];
+	    }
+	}
+	export class Group {
+	    group_id: string;
+	    title: string;
+	    owner_id: number;
+	    left: boolean;
+	    members: GroupMember[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Group(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.group_id = source["group_id"];
+	        this.title = source["title"];
+	        this.owner_id = source["owner_id"];
+	        this.left = source["left"];
+	        this.members = this.convertValues(source["members"], GroupMember);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class GroupMessage {
+	    id: number;
+	    group_id: string;
+	    sender_id: number;
+	    iteration: number;
+	    content: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new GroupMessage(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.group_id = source["group_id"];
+	        this.sender_id = source["sender_id"];
+	        this.iteration = source["iteration"];
+	        this.content = source["content"];
+	    }
+	}
+	export class Contact {
+	    user_id: number;
+	    username: string;
+	    ecdsa_public_key: string;
+	    rsa_public_key: string;
+	    nickname: string;
+	    verified: boolean;
+	    blocked: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new Contact(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.user_id = source["user_id"];
+	        this.username = source["username"];
+	        this.ecdsa_public_key = source["ecdsa_public_key"];
+	        this.rsa_public_key = source["rsa_public_key"];
+	        this.nickname = source["nickname"];
+	        this.verified = source["verified"];
+	        this.blocked = source["blocked"];
+	    }
+	}
+	export class ChatRequestPolicy {
+	    only_contacts: boolean;
+	    auto_accept_verified: boolean;
+	    max_requests_per_sender: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ChatRequestPolicy(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.only_contacts = source["only_contacts"];
+	        this.auto_accept_verified = source["auto_accept_verified"];
+	        this.max_requests_per_sender = source["max_requests_per_sender"];
+	    }
+	}
+	export class UserInfo {
+	    user_id: number;
+	    username: string;
+	    ecdsa_public_key: string;
+	    rsa_public_key: string;
+	    updated_at: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new UserInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.user_id = source["user_id"];
+	        this.username = source["username"];
+	        this.ecdsa_public_key = source["ecdsa_public_key"];
+	        this.rsa_public_key = source["rsa_public_key"];
+	        this.updated_at = source["updated_at"];
+	    }
+	}
+	export class LinkedDevice {
+	    device_user_id: number;
+	    chat_id: number;
+	    name: string;
+	    linked_at: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new LinkedDevice(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.device_user_id = source["device_user_id"];
+	        this.chat_id = source["chat_id"];
+	        this.name = source["name"];
+	        this.linked_at = source["linked_at"];
+	    }
+	}
+	export class Attachment {
+	    chat_id: number;
+	    message_id: number;
+	    sender_id: number;
+	    mime_type: string;
+	    size: number;
+	    content: number[];
+	    created_at: number;
+	    expires_at: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new Attachment(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.chat_id = source["chat_id"];
+	        this.message_id = source["message_id"];
+	        this.sender_id = source["sender_id"];
+	        this.mime_type = source["mime_type"];
+	        this.size = source["size"];
+	        this.content = source["content"];
+	        this.created_at = source["created_at"];
+	        this.expires_at = source["expires_at"];
+	    }
+	}
 
 }
 
@@ -79,6 +331,24 @@ export namespace messenger_client {
 	        this.type = source["type"];
 	    }
 	}
+	export class ChatPresence {
+	    chat_id: number;
+	    user_id: number;
+	    typing: boolean;
+	    online: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new ChatPresence(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.chat_id = source["chat_id"];
+	        this.user_id = source["user_id"];
+	        this.typing = source["typing"];
+	        this.online = source["online"];
+	    }
+	}
 
 }
 
@@ -8,6 +8,7 @@ require (
 	github.com/mutecomm/go-sqlcipher v0.0.0-20190227152316-55dbde17881f
 	github.com/wailsapp/wails/v2 v2.7.1
 	golang.org/x/crypto v0.14.0
+	golang.org/x/term v0.13.0
 )
 
 require (
@@ -0,0 +1,264 @@
+// Package bot is a small framework for automated Sigilix accounts (build notifications, pagers,
+// echo services...). A Bot polls the notification pipeline of an unlocked MessengerClient and
+// dispatches incoming chat requests and messages to registered handlers.
+package bot
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/messenger_client"
+)
+
+const DefaultPollInterval = 2 * time.Second
+
+// AcceptPolicy decides whether an incoming chat request is accepted automatically.
+type AcceptPolicy func(chat *data.Chat) bool
+
+func AcceptAll(*data.Chat) bool { return true }
+
+func AcceptNone(*data.Chat) bool { return false }
+
+// AcceptUsers accepts requests only from the given user ids.
+func AcceptUsers(userIds ...uint64) AcceptPolicy {
+	allowed := make(map[uint64]bool, len(userIds))
+	for _, id := range userIds {
+		allowed[id] = true
+	}
+	return func(chat *data.Chat) bool {
+		return allowed[chat.OtherUserId]
+	}
+}
+
+type Options struct {
+	// PollInterval is the delay between notification pulls, DefaultPollInterval if zero.
+	PollInterval time.Duration
+	// AcceptPolicy is applied to incoming chat requests before OnChatRequest handlers run.
+	// Requests are left pending if nil.
+	AcceptPolicy AcceptPolicy
+	// ErrorHandler receives pull and handler errors, they are logged if nil.
+	ErrorHandler func(err error)
+}
+
+type MessageHandler func(ev *MessageEvent) error
+
+type ChatRequestHandler func(ev *ChatRequestEvent) error
+
+type ChatAcceptedHandler func(ev *ChatAcceptedEvent) error
+
+type Bot struct {
+	client *messenger_client.MessengerClient
+	opts   Options
+
+	mu                   sync.Mutex
+	messageHandlers      []MessageHandler
+	chatRequestHandlers  []ChatRequestHandler
+	chatAcceptedHandlers []ChatAcceptedHandler
+	cancel               context.CancelFunc
+	done                 chan struct{}
+	// calls are run by the run loop between pulls, see Do
+	calls chan func()
+}
+
+// New creates a bot on top of an already unlocked client.
+func New(client *messenger_client.MessengerClient, opts Options) *Bot {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.ErrorHandler == nil {
+		opts.ErrorHandler = func(err error) {
+			log.Printf("bot: %s", err.Error())
+		}
+	}
+	return &Bot{
+		client: client,
+		opts:   opts,
+		calls:  make(chan func()),
+	}
+}
+
+func (b *Bot) Client() *messenger_client.MessengerClient {
+	return b.client
+}
+
+func (b *Bot) OnMessage(handler MessageHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.messageHandlers = append(b.messageHandlers, handler)
+}
+
+func (b *Bot) OnChatRequest(handler ChatRequestHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.chatRequestHandlers = append(b.chatRequestHandlers, handler)
+}
+
+func (b *Bot) OnChatAccepted(handler ChatAcceptedHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.chatAcceptedHandlers = append(b.chatAcceptedHandlers, handler)
+}
+
+// Send sends a text message to an accepted chat.
+func (b *Bot) Send(chatId uint64, text string) (*data.Message, error) {
+	return b.client.SendMessage(chatId, text)
+}
+
+// Broadcast sends text to every accepted chat and returns the first error encountered.
+func (b *Bot) Broadcast(text string) error {
+	chats, err := b.client.GetChats()
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, chat := range chats {
+		if !chat.Accepted {
+			continue
+		}
+		if _, err = b.client.SendMessage(chat.ChatId, text); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Do runs fn on the run loop between two pulls and waits for it, for code outside of handlers that
+// has to run in order with them; the client itself may be used from any goroutine. It returns
+// ctx.Err() if the loop did not pick fn up before ctx is done.
+func (b *Bot) Do(ctx context.Context, fn func()) error {
+	ran := make(chan struct{})
+	select {
+	case b.calls <- func() { defer close(ran); fn() }:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	<-ran
+	return nil
+}
+
+// Run polls for notifications until ctx is cancelled or Shutdown is called. Handlers and Do calls
+// are invoked sequentially from the run loop, so a batch that is being dispatched always completes.
+func (b *Bot) Run(ctx context.Context) error {
+	if !b.client.IsUnlocked() {
+		return errors.New("client is not unlocked")
+	}
+	b.mu.Lock()
+	if b.done != nil {
+		b.mu.Unlock()
+		return errors.New("bot is already running")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	b.cancel = cancel
+	b.done = make(chan struct{})
+	done := b.done
+	b.mu.Unlock()
+
+	defer func() {
+		cancel()
+		b.mu.Lock()
+		b.cancel = nil
+		b.done = nil
+		b.mu.Unlock()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(b.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		b.poll()
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case call := <-b.calls:
+				call()
+			case <-ticker.C:
+				break wait
+			}
+		}
+	}
+}
+
+// Shutdown stops the run loop and waits for the batch in progress to finish or ctx to expire.
+func (b *Bot) Shutdown(ctx context.Context) error {
+	b.mu.Lock()
+	cancel, done := b.cancel, b.done
+	b.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *Bot) poll() {
+	notifications, err := b.client.PullNotificationsAndUpdateData()
+	if err != nil {
+		b.opts.ErrorHandler(err)
+		return
+	}
+	for _, notification := range notifications {
+		b.dispatch(notification.Notification)
+	}
+}
+
+func (b *Bot) dispatch(notification messenger_client.WebNotification) {
+	b.mu.Lock()
+	messageHandlers := append([]MessageHandler{}, b.messageHandlers...)
+	chatRequestHandlers := append([]ChatRequestHandler{}, b.chatRequestHandlers...)
+	chatAcceptedHandlers := append([]ChatAcceptedHandler{}, b.chatAcceptedHandlers...)
+	b.mu.Unlock()
+
+	switch n := notification.(type) {
+	case *messenger_client.IncomingChatNotification:
+		ev := &ChatRequestEvent{bot: b, Chat: n.Chat}
+		if b.opts.AcceptPolicy != nil && b.opts.AcceptPolicy(n.Chat) {
+			if err := ev.Accept(); err != nil {
+				b.opts.ErrorHandler(err)
+			}
+		}
+		for _, handler := range chatRequestHandlers {
+			b.handleError(handler(ev))
+		}
+	case *messenger_client.ChatAcceptedNotification:
+		ev := &ChatAcceptedEvent{bot: b, Chat: n.Chat}
+		for _, handler := range chatAcceptedHandlers {
+			b.handleError(handler(ev))
+		}
+	case *messenger_client.NewMessageNotification:
+		ev := &MessageEvent{bot: b, ChatId: n.ChatId, Message: n.Message}
+		for _, handler := range messageHandlers {
+			b.handleError(handler(ev))
+		}
+	}
+}
+
+func (b *Bot) handleError(err error) {
+	if err != nil {
+		b.opts.ErrorHandler(err)
+	}
+}
+
+// OpenClient unlocks the identity stored in dataDir, creating it first if it does not exist yet.
+func OpenClient(apiUrl string, dataDir string, password string) (*messenger_client.MessengerClient, error) {
+	client := messenger_client.NewClientWithDataDir(apiUrl, dataDir)
+	if !client.IsSignedUp() {
+		if err := client.SignUp(password); err != nil {
+			return nil, err
+		}
+	}
+	if err := client.Unlock(password); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
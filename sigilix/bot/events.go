@@ -0,0 +1,67 @@
+package bot
+
+import (
+	"errors"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+)
+
+type MessageEvent struct {
+	ChatId  uint64
+	Message *data.Message
+
+	bot *Bot
+}
+
+func (e *MessageEvent) Text() string {
+	return e.Message.Content
+}
+
+// Reply sends text back to the chat the message came from.
+func (e *MessageEvent) Reply(text string) error {
+	_, err := e.bot.Send(e.ChatId, text)
+	return err
+}
+
+type ChatRequestEvent struct {
+	Chat *data.Chat
+
+	bot *Bot
+}
+
+// Accept accepts the chat request. It is a no-op if the accept policy already did.
+func (e *ChatRequestEvent) Accept() error {
+	if e.Chat.Accepted {
+		return nil
+	}
+	chat, err := e.bot.client.InitChatFromReceiver(e.Chat.ChatId)
+	if err != nil {
+		return err
+	}
+	e.Chat = chat
+	return nil
+}
+
+func (e *ChatRequestEvent) Accepted() bool {
+	return e.Chat.Accepted
+}
+
+// Reply sends text to the requesting user, the request has to be accepted first.
+func (e *ChatRequestEvent) Reply(text string) error {
+	if !e.Chat.Accepted {
+		return errors.New("chat request is not accepted")
+	}
+	_, err := e.bot.Send(e.Chat.ChatId, text)
+	return err
+}
+
+type ChatAcceptedEvent struct {
+	Chat *data.Chat
+
+	bot *Bot
+}
+
+func (e *ChatAcceptedEvent) Reply(text string) error {
+	_, err := e.bot.Send(e.Chat.ChatId, text)
+	return err
+}
@@ -0,0 +1,59 @@
+// Echo bot: accepts every chat request and sends every message back.
+//
+//	go run ./cmd/sigilix-mock-server &
+//	go run ./sigilix/bot/examples/echo -api http://127.0.0.1:8080/api/ -username echo
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/bot"
+)
+
+func main() {
+	apiUrl := flag.String("api", "http://127.0.0.1:8080/api/", "Sigilix API base url")
+	dataDir := flag.String("dir", "echo-bot-data", "directory for the bot identity")
+	password := flag.String("password", "echo-bot", "identity password")
+	username := flag.String("username", "", "searchable username to register")
+	flag.Parse()
+
+	if err := os.MkdirAll(*dataDir, 0700); err != nil {
+		log.Fatal(err)
+	}
+	client, err := bot.OpenClient(*apiUrl, *dataDir, *password)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *username != "" {
+		if err = client.SetUsernameConfig(*username, true); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("echo bot running as user %d", client.GetUserId())
+
+	b := bot.New(client, bot.Options{AcceptPolicy: bot.AcceptAll})
+	b.OnChatRequest(func(ev *bot.ChatRequestEvent) error {
+		log.Printf("accepted chat %d from %d", ev.Chat.ChatId, ev.Chat.OtherUserId)
+		return ev.Reply("hi! I repeat everything you say")
+	})
+	b.OnMessage(func(ev *bot.MessageEvent) error {
+		return ev.Reply(ev.Text())
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = b.Shutdown(shutdownCtx)
+	}()
+	if err = b.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,70 @@
+// Notifier bot: broadcasts every line read from stdin to the users it is chatting with, e.g. to
+// forward build results or pages. Only the listed user ids may subscribe.
+//
+//	go run ./cmd/sigilix-mock-server &
+//	tail -f build.log | go run ./sigilix/bot/examples/notifier -allow 123456789
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/bot"
+)
+
+func main() {
+	apiUrl := flag.String("api", "http://127.0.0.1:8080/api/", "Sigilix API base url")
+	dataDir := flag.String("dir", "notifier-bot-data", "directory for the bot identity")
+	password := flag.String("password", "notifier-bot", "identity password")
+	allow := flag.String("allow", "", "comma separated user ids allowed to subscribe")
+	flag.Parse()
+
+	allowed := make([]uint64, 0)
+	for _, part := range strings.Split(*allow, ",") {
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			log.Fatalf("invalid user id %q", part)
+		}
+		allowed = append(allowed, id)
+	}
+
+	if err := os.MkdirAll(*dataDir, 0700); err != nil {
+		log.Fatal(err)
+	}
+	client, err := bot.OpenClient(*apiUrl, *dataDir, *password)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("notifier bot running as user %d", client.GetUserId())
+
+	b := bot.New(client, bot.Options{AcceptPolicy: bot.AcceptUsers(allowed...)})
+	b.OnChatRequest(func(ev *bot.ChatRequestEvent) error {
+		if !ev.Accepted() {
+			log.Printf("ignoring chat request from %d", ev.Chat.OtherUserId)
+			return nil
+		}
+		return ev.Reply("subscribed")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		defer cancel()
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if err := b.Broadcast(scanner.Text()); err != nil {
+				log.Printf("broadcast: %s", err.Error())
+			}
+		}
+	}()
+	if err = b.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,227 @@
+package crypto_utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/subtle"
+	"errors"
+	"math/big"
+	"sync"
+)
+
+// Signer signs with an ECDSA private key it does not hand out, the signature is the one of
+// SignMessage.
+type Signer interface {
+	Sign(data []byte) ([]byte, error)
+}
+
+// Decrypter decrypts DecryptMessage ciphertexts with an RSA private key it does not hand out.
+type Decrypter interface {
+	Decrypt(data []byte) ([]byte, error)
+}
+
+var ErrKeyringWiped = errors.New("keyring is wiped")
+
+// Keyring holds the identity keys of an unlocked user. Only their encoded bytes are kept in memory
+// that is not swapped out where the platform allows it (see lockedBuffer) and reliably zeroed by
+// Wipe. The decoded keys live on the Go heap: Wipe zeroes the big.Int values it can reach, but
+// crypto/rsa and math/big keep internal copies (e.g. the precomputed moduli of an RSA key) that it
+// can not clear, and the garbage collector may have moved any of them.
+type Keyring struct {
+	mu       sync.RWMutex
+	ecdsaRaw *lockedBuffer
+	rsaRaw   *lockedBuffer
+	ecdsaKey *ecdsa.PrivateKey
+	rsaKey   *rsa.PrivateKey
+	// chat keys that are not the identity RSA key, by chat id
+	chatRaw  map[uint64]*lockedBuffer
+	chatKeys map[uint64]*rsa.PrivateKey
+}
+
+// NewKeyring decodes the keys in the format of PrivateKeyToBytes and RsaPrivateToBytes. It copies
+// them, the caller should wipe its own copies.
+func NewKeyring(ecdsaPrivate []byte, rsaPrivate []byte) (*Keyring, error) {
+	ecdsaKey, err := PrivateKeyFromBytes(ecdsaPrivate)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, err := RsaPrivateFromBytes(rsaPrivate)
+	if err != nil {
+		wipeEcdsaKey(ecdsaKey)
+		return nil, err
+	}
+	return &Keyring{
+		ecdsaRaw: newLockedBuffer(ecdsaPrivate),
+		rsaRaw:   newLockedBuffer(rsaPrivate),
+		ecdsaKey: ecdsaKey,
+		rsaKey:   rsaKey,
+		chatRaw:  make(map[uint64]*lockedBuffer),
+		chatKeys: make(map[uint64]*rsa.PrivateKey),
+	}, nil
+}
+
+func (k *Keyring) EcdsaPublicKey() *ecdsa.PublicKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.ecdsaKey == nil {
+		return nil
+	}
+	public := k.ecdsaKey.PublicKey
+	return &public
+}
+
+func (k *Keyring) RsaPublicKey() *rsa.PublicKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.rsaKey == nil {
+		return nil
+	}
+	public := k.rsaKey.PublicKey
+	return &public
+}
+
+// Sign signs with the identity ECDSA key.
+func (k *Keyring) Sign(data []byte) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.ecdsaKey == nil {
+		return nil, ErrKeyringWiped
+	}
+	return SignMessage(k.ecdsaKey, data)
+}
+
+// Decrypt decrypts with the identity RSA key.
+func (k *Keyring) Decrypt(data []byte) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.rsaKey == nil {
+		return nil, ErrKeyringWiped
+	}
+	return DecryptMessage(k.rsaKey, data)
+}
+
+// AddChatKey keeps the RSA private key of a chat that does not use the identity key, chats from
+// before the keyring have one. It copies key like NewKeyring.
+func (k *Keyring) AddChatKey(chatId uint64, key []byte) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.rsaKey == nil {
+		return ErrKeyringWiped
+	}
+	if subtle.ConstantTimeCompare(key, k.rsaRaw.bytes) == 1 {
+		return nil
+	}
+	decoded, err := RsaPrivateFromBytes(key)
+	if err != nil {
+		return err
+	}
+	if old, ok := k.chatKeys[chatId]; ok {
+		wipeRsaKey(old)
+		k.chatRaw[chatId].free()
+	}
+	k.chatRaw[chatId] = newLockedBuffer(key)
+	k.chatKeys[chatId] = decoded
+	return nil
+}
+
+// ChatDecrypter returns the decrypter of a chat, the identity key unless AddChatKey added one.
+func (k *Keyring) ChatDecrypter(chatId uint64) (Decrypter, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.rsaKey == nil {
+		return nil, ErrKeyringWiped
+	}
+	if key, ok := k.chatKeys[chatId]; ok {
+		return &chatDecrypter{keyring: k, key: key}, nil
+	}
+	return k, nil
+}
+
+// WriteKeys passes the encoded keys to fn, to write them to the encrypted config. fn must not keep
+// them, they are wiped with the keyring.
+func (k *Keyring) WriteKeys(fn func(ecdsaPrivate []byte, rsaPrivate []byte, chatKeys map[uint64][]byte) error) error {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.ecdsaKey == nil {
+		return ErrKeyringWiped
+	}
+	chatKeys := make(map[uint64][]byte, len(k.chatRaw))
+	for chatId, raw := range k.chatRaw {
+		chatKeys[chatId] = raw.bytes
+	}
+	return fn(k.ecdsaRaw.bytes, k.rsaRaw.bytes, chatKeys)
+}
+
+// Wipe zeroes the encoded keys and drops the decoded ones, every later operation fails with
+// ErrKeyringWiped. See Keyring for what is left in memory.
+func (k *Keyring) Wipe() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.ecdsaKey == nil {
+		return
+	}
+	wipeEcdsaKey(k.ecdsaKey)
+	wipeRsaKey(k.rsaKey)
+	for chatId, key := range k.chatKeys {
+		wipeRsaKey(key)
+		k.chatRaw[chatId].free()
+		delete(k.chatKeys, chatId)
+		delete(k.chatRaw, chatId)
+	}
+	k.ecdsaRaw.free()
+	k.rsaRaw.free()
+	k.ecdsaKey = nil
+	k.rsaKey = nil
+}
+
+type chatDecrypter struct {
+	keyring *Keyring
+	key     *rsa.PrivateKey
+}
+
+func (d *chatDecrypter) Decrypt(data []byte) ([]byte, error) {
+	d.keyring.mu.RLock()
+	defer d.keyring.mu.RUnlock()
+	if d.keyring.rsaKey == nil {
+		return nil, ErrKeyringWiped
+	}
+	return DecryptMessage(d.key, data)
+}
+
+// Wipe zeroes b, e.g. a decrypted config once it is parsed.
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func wipeInt(i *big.Int) {
+	if i == nil {
+		return
+	}
+	words := i.Bits()
+	for j := range words {
+		words[j] = 0
+	}
+	i.SetInt64(0)
+}
+
+func wipeEcdsaKey(key *ecdsa.PrivateKey) {
+	wipeInt(key.D)
+}
+
+// wipeRsaKey is best effort, see Keyring.
+func wipeRsaKey(key *rsa.PrivateKey) {
+	wipeInt(key.D)
+	for _, prime := range key.Primes {
+		wipeInt(prime)
+	}
+	wipeInt(key.Precomputed.Dp)
+	wipeInt(key.Precomputed.Dq)
+	wipeInt(key.Precomputed.Qinv)
+	for _, value := range key.Precomputed.CRTValues {
+		wipeInt(value.Exp)
+		wipeInt(value.Coeff)
+		wipeInt(value.R)
+	}
+}
@@ -0,0 +1,54 @@
+//go:build linux
+
+package crypto_utils
+
+import (
+	"log"
+	"syscall"
+)
+
+// lockedBuffer is a copy of key bytes outside the Go heap, in pages locked with mlock so they are
+// never written to swap. If the memlock limit is reached the pages stay unlocked.
+type lockedBuffer struct {
+	bytes  []byte
+	mapped []byte
+	locked bool
+}
+
+func newLockedBuffer(data []byte) *lockedBuffer {
+	b := &lockedBuffer{}
+	if len(data) == 0 {
+		return b
+	}
+	mapped, err := syscall.Mmap(-1, 0, len(data), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		log.Printf("error mapping key memory, keeping keys on the heap: %s", err.Error())
+		b.bytes = make([]byte, len(data))
+		copy(b.bytes, data)
+		return b
+	}
+	b.mapped = mapped
+	if err = syscall.Mlock(mapped); err != nil {
+		log.Printf("error locking key memory, keys may be swapped out: %s", err.Error())
+	} else {
+		b.locked = true
+	}
+	b.bytes = mapped[:len(data)]
+	copy(b.bytes, data)
+	return b
+}
+
+func (b *lockedBuffer) free() {
+	Wipe(b.bytes)
+	b.bytes = nil
+	if b.mapped == nil {
+		return
+	}
+	if b.locked {
+		_ = syscall.Munlock(b.mapped)
+	}
+	if err := syscall.Munmap(b.mapped); err != nil {
+		log.Printf("error unmapping key memory: %s", err.Error())
+	}
+	b.mapped = nil
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package crypto_utils
+
+// lockedBuffer is a copy of key bytes. Only Linux builds lock it in memory, here it is a plain heap
+// copy that is wiped when freed.
+type lockedBuffer struct {
+	bytes []byte
+}
+
+func newLockedBuffer(data []byte) *lockedBuffer {
+	b := &lockedBuffer{bytes: make([]byte, len(data))}
+	copy(b.bytes, data)
+	return b
+}
+
+func (b *lockedBuffer) free() {
+	Wipe(b.bytes)
+	b.bytes = nil
+}
@@ -0,0 +1,137 @@
+package crypto_utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+)
+
+// Sender keys are used for group messages: every member owns a chain key, derives a one-time
+// message key from it for each message and then ratchets the chain forward, so that a leaked
+// chain key does not reveal earlier messages.
+
+const SenderChainKeySize = 32
+
+// MaxSenderKeySkip limits how far a receiver ratchets forward to catch up with a sender.
+const MaxSenderKeySkip = 2000
+
+var (
+	senderMessageKeySeed = []byte{0x01}
+	senderChainKeySeed   = []byte{0x02}
+)
+
+func NewSenderChainKey() ([]byte, error) {
+	key := make([]byte, SenderChainKeySize)
+	if _, err := io.ReadFull(crand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func hmacSha256(key []byte, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func SenderMessageKey(chainKey []byte) []byte {
+	return hmacSha256(chainKey, senderMessageKeySeed)
+}
+
+func NextSenderChainKey(chainKey []byte) []byte {
+	return hmacSha256(chainKey, senderChainKeySeed)
+}
+
+// RatchetSenderChainKey advances chainKey from iteration `from` to iteration `to`.
+func RatchetSenderChainKey(chainKey []byte, from uint32, to uint32) ([]byte, error) {
+	if to < from {
+		return nil, errors.New("sender key iteration is in the past")
+	}
+	if to-from > MaxSenderKeySkip {
+		return nil, errors.New("sender key iteration is too far ahead")
+	}
+	for i := from; i < to; i++ {
+		chainKey = NextSenderChainKey(chainKey)
+	}
+	return chainKey, nil
+}
+
+func EncryptSymmetric(key []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(crand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func DecryptSymmetric(key []byte, ciphertext []byte, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, additionalData)
+}
+
+// SenderKeyEncrypt encrypts plaintext with the message key of chainKey and returns the
+// ciphertext together with the chain key for the next message.
+func SenderKeyEncrypt(chainKey []byte, plaintext []byte, additionalData []byte) ([]byte, []byte, error) {
+	ciphertext, err := EncryptSymmetric(SenderMessageKey(chainKey), plaintext, additionalData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ciphertext, NextSenderChainKey(chainKey), nil
+}
+
+// SenderKeyDecrypt decrypts a message sent at iteration `to` with a chain key known at iteration
+// `from` and returns the plaintext and the chain key for iteration to+1.
+func SenderKeyDecrypt(chainKey []byte, from uint32, to uint32, ciphertext []byte, additionalData []byte) ([]byte, []byte, error) {
+	plaintext, next, _, err := SenderKeyDecryptSkipping(chainKey, from, to, ciphertext, additionalData)
+	return plaintext, next, err
+}
+
+// SenderKeyDecryptSkipping is SenderKeyDecrypt that also returns the message keys of the
+// iterations from `from` up to `to`, by iteration. Messages of those iterations that arrive late
+// are decrypted with them by SenderKeyDecryptSkipped.
+func SenderKeyDecryptSkipping(chainKey []byte, from uint32, to uint32, ciphertext []byte, additionalData []byte) ([]byte, []byte, map[uint32][]byte, error) {
+	if to < from {
+		return nil, nil, nil, errors.New("sender key iteration is in the past")
+	}
+	if to-from > MaxSenderKeySkip {
+		return nil, nil, nil, errors.New("sender key iteration is too far ahead")
+	}
+	skipped := make(map[uint32][]byte, to-from)
+	for i := from; i < to; i++ {
+		skipped[i] = SenderMessageKey(chainKey)
+		chainKey = NextSenderChainKey(chainKey)
+	}
+	plaintext, err := DecryptSymmetric(SenderMessageKey(chainKey), ciphertext, additionalData)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return plaintext, NextSenderChainKey(chainKey), skipped, nil
+}
+
+// SenderKeyDecryptSkipped decrypts a message with a message key of SenderKeyDecryptSkipping.
+func SenderKeyDecryptSkipped(messageKey []byte, ciphertext []byte, additionalData []byte) ([]byte, error) {
+	return DecryptSymmetric(messageKey, ciphertext, additionalData)
+}
@@ -0,0 +1,56 @@
+package crypto_utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+// User ids are derived from the ECDSA public key. Legacy ids (GenerateUserIdByPublicKey) only use
+// 32 bits of the hash, which makes finding a second key for an existing id feasible. Wide ids use
+// 52 bits and carry wideUserIdMarker, so they never overlap with legacy ids and still fit in a
+// JavaScript number. Both forms stay valid: an id is the account's address on the server, so
+// existing accounts keep their legacy id and new accounts get a wide one.
+
+type UserIdVersion int
+
+const (
+	UserIdLegacy UserIdVersion = 1
+	UserIdWide   UserIdVersion = 2
+)
+
+const (
+	wideUserIdMarker = uint64(1) << 52
+	wideUserIdMask   = wideUserIdMarker - 1
+)
+
+func GenerateWideUserIdByPublicKey(publicKey *ecdsa.PublicKey) uint64 {
+	hashBytes := sha256.Sum256(elliptic.Marshal(publicKey.Curve, publicKey.X, publicKey.Y))
+	return wideUserIdMarker | binary.BigEndian.Uint64(hashBytes[:8])&wideUserIdMask
+}
+
+func DeriveUserId(publicKey *ecdsa.PublicKey, version UserIdVersion) (uint64, error) {
+	switch version {
+	case UserIdLegacy:
+		return GenerateUserIdByPublicKey(publicKey), nil
+	case UserIdWide:
+		return GenerateWideUserIdByPublicKey(publicKey), nil
+	}
+	return 0, errors.New("unknown user id version")
+}
+
+// UserIdVersionOf tells which derivation an id claims to use.
+func UserIdVersionOf(userId uint64) UserIdVersion {
+	if userId&^wideUserIdMask == wideUserIdMarker {
+		return UserIdWide
+	}
+	return UserIdLegacy
+}
+
+// VerifyUserId checks that userId is derived from publicKey, in either form.
+func VerifyUserId(userId uint64, publicKey *ecdsa.PublicKey) bool {
+	derived, err := DeriveUserId(publicKey, UserIdVersionOf(userId))
+	return err == nil && derived == userId
+}
@@ -2,7 +2,6 @@ package custom_types
 
 import (
 	"crypto/ecdsa"
-	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -53,6 +52,21 @@ type SetUsernameConfigResponse struct {
 
 func (u *SetUsernameConfigResponse) ImplementSigilixStruct() {}
 
+// DeleteAccountRequest deletes the account that signs it, its chats and queued notifications.
+// Farewells are sent like SendMessageRequest to their chats once the account is deleted, chats
+// that no longer exist are skipped.
+type DeleteAccountRequest struct {
+	Farewells []*SendMessageRequest `json:"farewells,omitempty"`
+}
+
+func (u *DeleteAccountRequest) ImplementSigilixStruct() {}
+
+type DeleteAccountResponse struct {
+	Success bool `json:"success"`
+}
+
+func (u *DeleteAccountResponse) ImplementSigilixStruct() {}
+
 type SearchByUsernameRequest struct {
 	Username string `json:"username"`
 }
@@ -139,6 +153,19 @@ type SendMessageResponse struct {
 
 func (u *SendMessageResponse) ImplementSigilixStruct() {}
 
+// CloseChatRequest deletes a chat on the server, neither member can send to it afterwards.
+type CloseChatRequest struct {
+	ChatId uint64 `json:"chat_id"`
+}
+
+func (u *CloseChatRequest) ImplementSigilixStruct() {}
+
+type CloseChatResponse struct {
+	ChatId uint64 `json:"chat_id"`
+}
+
+func (u *CloseChatResponse) ImplementSigilixStruct() {}
+
 type SendMessageNotification struct {
 	ChatId                uint64      `json:"chat_id"`
 	MessageId             uint64      `json:"message_id"`
@@ -147,11 +174,11 @@ type SendMessageNotification struct {
 	MessageEcdsaSignature Base64Bytes `json:"message_ecdsa_signature"`
 }
 
-func (s *SendMessageNotification) ValidateAndDecrypt(ecdsaPublicKey *ecdsa.PublicKey, rsaPrivateKey *rsa.PrivateKey) ([]byte, error) {
+func (s *SendMessageNotification) ValidateAndDecrypt(ecdsaPublicKey *ecdsa.PublicKey, decrypter crypto_utils.Decrypter) ([]byte, error) {
 	// Verify the signature
 	// Decrypt the message
 
-	decryptedMessage, err := crypto_utils.DecryptMessage(rsaPrivateKey, s.EncryptedMessage)
+	decryptedMessage, err := decrypter.Decrypt(s.EncryptedMessage)
 	if err != nil {
 		return nil, err
 	}
@@ -195,6 +222,26 @@ type SendFileNotification struct {
 	FileEcdsaSignature Base64Bytes `json:"file_ecdsa_signature"`
 }
 
+// ValidateAndDecrypt decrypts the file and its mime type and checks the signature of the file.
+func (s *SendFileNotification) ValidateAndDecrypt(ecdsaPublicKey *ecdsa.PublicKey, decrypter crypto_utils.Decrypter) ([]byte, string, error) {
+	decryptedFile, err := decrypter.Decrypt(s.EncryptedFile)
+	if err != nil {
+		return nil, "", err
+	}
+	ok, err := crypto_utils.ValidateECDSASignature(ecdsaPublicKey, decryptedFile, s.FileEcdsaSignature)
+	if err != nil {
+		return nil, "", err
+	}
+	if !ok {
+		return nil, "", fmt.Errorf("invalid signature")
+	}
+	mimeType, err := decrypter.Decrypt(s.EncryptedMimeType)
+	if err != nil {
+		return nil, "", err
+	}
+	return decryptedFile, string(mimeType), nil
+}
+
 func (s *SendFileNotification) ImplementSigilixStruct() {}
 
 type IncomingNotification struct {
@@ -0,0 +1,64 @@
+package data
+
+import "database/sql"
+
+// Attachment is a file sent in a chat. It shares the message id space of the chat with the
+// messages.
+type Attachment struct {
+	ChatId    uint64 `json:"chat_id"`
+	MessageId uint64 `json:"message_id"`
+	SenderId  uint64 `json:"sender_id"`
+	MimeType  string `json:"mime_type"`
+	Size      int    `json:"size"`
+	// Content is only loaded by GetAttachment.
+	Content   []byte `json:"content,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	// ExpiresAt is the unix time the file disappears at, 0 if it never does.
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+func (s *SqliteDB) SaveAttachment(a *Attachment) error {
+	err := s.execUpsert(
+		"UPDATE attachments SET sender_id = ?, mime_type = ?, content = ?, created_at = ?, expires_at = ? WHERE chat_id = ? AND message_id = ?",
+		[]interface{}{a.SenderId, a.MimeType, a.Content, a.CreatedAt, a.ExpiresAt, a.ChatId, a.MessageId},
+		"INSERT INTO attachments (chat_id, message_id, sender_id, mime_type, content, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		[]interface{}{a.ChatId, a.MessageId, a.SenderId, a.MimeType, a.Content, a.CreatedAt, a.ExpiresAt},
+	)
+	if err != nil {
+		return err
+	}
+	return s.touchChat(a.ChatId, a.MessageId, a.CreatedAt)
+}
+
+// GetAttachment returns nil if there is no attachment with messageId in the chat.
+func (s *SqliteDB) GetAttachment(chatId uint64, messageId uint64) (*Attachment, error) {
+	a := &Attachment{}
+	err := s.QueryRow("SELECT chat_id, message_id, sender_id, mime_type, content, created_at, expires_at FROM attachments WHERE chat_id = ? AND message_id = ?", chatId, messageId).
+		Scan(&a.ChatId, &a.MessageId, &a.SenderId, &a.MimeType, &a.Content, &a.CreatedAt, &a.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.Size = len(a.Content)
+	return a, nil
+}
+
+// GetAttachments lists the attachments of a chat without their content.
+func (s *SqliteDB) GetAttachments(chatId uint64) ([]*Attachment, error) {
+	rows, err := s.Query("SELECT chat_id, message_id, sender_id, mime_type, length(content), created_at, expires_at FROM attachments WHERE chat_id = ? ORDER BY message_id", chatId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	attachments := make([]*Attachment, 0)
+	for rows.Next() {
+		a := &Attachment{}
+		if err = rows.Scan(&a.ChatId, &a.MessageId, &a.SenderId, &a.MimeType, &a.Size, &a.CreatedAt, &a.ExpiresAt); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, nil
+}
@@ -0,0 +1,78 @@
+package data
+
+import "database/sql"
+
+type Contact struct {
+	UserId   uint64 `json:"user_id"`
+	Username string `json:"username"`
+	// EcdsaPublic and RsaPublic are the keys the contact was added with, nil if they are not known.
+	EcdsaPublic []byte `json:"ecdsa_public_key"`
+	RsaPublic   []byte `json:"rsa_public_key"`
+	Nickname    string `json:"nickname"`
+	// Verified is set by the user after comparing the keys out of band.
+	Verified bool `json:"verified"`
+	Blocked  bool `json:"blocked"`
+}
+
+// DisplayName returns the nickname if there is one, the username otherwise.
+func (c *Contact) DisplayName() string {
+	if c.Nickname != "" {
+		return c.Nickname
+	}
+	return c.Username
+}
+
+func (s *SqliteDB) SaveContact(c *Contact) error {
+	return s.execUpsert(
+		"UPDATE contacts SET username = ?, ecdsa_public = ?, rsa_public = ?, nickname = ?, verified = ?, blocked = ? WHERE user_id = ?",
+		[]interface{}{c.Username, c.EcdsaPublic, c.RsaPublic, c.Nickname, c.Verified, c.Blocked, c.UserId},
+		"INSERT INTO contacts (user_id, username, ecdsa_public, rsa_public, nickname, verified, blocked) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		[]interface{}{c.UserId, c.Username, c.EcdsaPublic, c.RsaPublic, c.Nickname, c.Verified, c.Blocked},
+	)
+}
+
+func (s *SqliteDB) DeleteContact(userId uint64) error {
+	_, err := s.Exec("DELETE FROM contacts WHERE user_id = ?", userId)
+	return err
+}
+
+// GetContact returns nil if userId is not in the contact book.
+func (s *SqliteDB) GetContact(userId uint64) (*Contact, error) {
+	contact := &Contact{}
+	err := s.QueryRow("SELECT user_id, username, ecdsa_public, rsa_public, nickname, verified, blocked FROM contacts WHERE user_id = ?", userId).
+		Scan(&contact.UserId, &contact.Username, &contact.EcdsaPublic, &contact.RsaPublic, &contact.Nickname, &contact.Verified, &contact.Blocked)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return contact, nil
+}
+
+func (s *SqliteDB) GetContacts() ([]*Contact, error) {
+	rows, err := s.Query("SELECT user_id, username, ecdsa_public, rsa_public, nickname, verified, blocked FROM contacts ORDER BY user_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	contacts := make([]*Contact, 0)
+	for rows.Next() {
+		contact := &Contact{}
+		err = rows.Scan(&contact.UserId, &contact.Username, &contact.EcdsaPublic, &contact.RsaPublic, &contact.Nickname, &contact.Verified, &contact.Blocked)
+		if err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, contact)
+	}
+	return contacts, nil
+}
+
+func (s *SqliteDB) IsBlocked(userId uint64) (bool, error) {
+	var blocked bool
+	err := s.QueryRow("SELECT blocked FROM contacts WHERE user_id = ?", userId).Scan(&blocked)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return blocked, err
+}
@@ -5,10 +5,26 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 )
 
 //import _ "github.com/mattn/go-sqlite3"
-import _ "github.com/mutecomm/go-sqlcipher"
+import sqlite3 "github.com/mutecomm/go-sqlcipher"
+
+// sqliteDriver sets the per-connection pragmas on every connection database/sql opens, a pragma run
+// with db.Exec only reaches one connection of the pool.
+const sqliteDriver = "sqlite3_sigilix"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+		if _, err := conn.Exec("PRAGMA foreign_keys = ON;", nil); err != nil {
+			return err
+		}
+		// overwrite deleted content, disappearing messages must not survive in free pages
+		_, err := conn.Exec("PRAGMA secure_delete = ON;", nil)
+		return err
+	}})
+}
 
 var initSqls = []string{
 	`CREATE TABLE IF NOT EXISTS chats (
@@ -29,6 +45,71 @@ var initSqls = []string{
     		content TEXT NOT NULL,
     		FOREIGN KEY(chat_id) REFERENCES chats(chat_id) ON DELETE CASCADE
 	);`,
+	`CREATE TABLE IF NOT EXISTS message_reactions (
+    		chat_id INTEGER NOT NULL,
+    		message_id INTEGER NOT NULL,
+    		user_id INTEGER NOT NULL,
+    		reaction TEXT NOT NULL,
+    		PRIMARY KEY (chat_id, message_id, user_id),
+    		FOREIGN KEY(chat_id) REFERENCES chats(chat_id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS chat_groups (
+    		group_id TEXT PRIMARY KEY,
+    		title TEXT DEFAULT '' NOT NULL,
+    		owner_id INTEGER NOT NULL,
+    		left_group INTEGER DEFAULT 0 NOT NULL,
+    		my_chain_key BLOB NOT NULL,
+    		my_iteration INTEGER DEFAULT 0 NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS group_members (
+    		group_id TEXT NOT NULL,
+    		user_id INTEGER NOT NULL,
+    		chain_key BLOB,
+    		iteration INTEGER DEFAULT 0 NOT NULL,
+    		PRIMARY KEY (group_id, user_id),
+    		FOREIGN KEY(group_id) REFERENCES chat_groups(group_id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS group_messages (
+    		id INTEGER PRIMARY KEY AUTOINCREMENT,
+    		group_id TEXT NOT NULL,
+    		sender_id INTEGER NOT NULL,
+    		iteration INTEGER NOT NULL,
+    		content TEXT NOT NULL,
+    		FOREIGN KEY(group_id) REFERENCES chat_groups(group_id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS contacts (
+    		user_id INTEGER PRIMARY KEY,
+    		username TEXT DEFAULT '' NOT NULL,
+    		ecdsa_public BLOB,
+    		rsa_public BLOB,
+    		nickname TEXT DEFAULT '' NOT NULL,
+    		verified INTEGER DEFAULT 0 NOT NULL,
+    		blocked INTEGER DEFAULT 0 NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS user_infos (
+    		user_id INTEGER PRIMARY KEY,
+    		username TEXT DEFAULT '' NOT NULL,
+    		ecdsa_public BLOB,
+    		rsa_public BLOB,
+    		updated_at INTEGER DEFAULT 0 NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS linked_devices (
+    		device_user_id INTEGER PRIMARY KEY,
+    		chat_id INTEGER NOT NULL,
+    		name TEXT DEFAULT '' NOT NULL,
+    		certificate BLOB NOT NULL,
+    		linked_at INTEGER NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS attachments (
+    		chat_id INTEGER NOT NULL,
+    		message_id INTEGER NOT NULL,
+    		sender_id INTEGER NOT NULL,
+    		mime_type TEXT DEFAULT '' NOT NULL,
+    		content BLOB NOT NULL,
+    		created_at INTEGER NOT NULL,
+    		PRIMARY KEY (chat_id, message_id),
+    		FOREIGN KEY(chat_id) REFERENCES chats(chat_id) ON DELETE CASCADE
+	);`,
 	//`CREATE TABLE IF NOT EXISTS config (
 	//		user_id INTEGER PRIMARY KEY,
 	//		username TEXT NOT NULL,
@@ -45,138 +126,391 @@ var initSqls = []string{
 	`CREATE INDEX IF NOT EXISTS messages_chat_id ON messages (chat_id);`,
 }
 
+// migrationSqls upgrade databases created by older versions. They are applied on every start,
+// so each one has to be idempotent or fail with an error accepted by isAppliedMigrationError.
+var migrationSqls = []string{
+	`ALTER TABLE messages ADD COLUMN reply_to INTEGER DEFAULT 0 NOT NULL;`,
+	`ALTER TABLE messages ADD COLUMN edited INTEGER DEFAULT 0 NOT NULL;`,
+	`ALTER TABLE messages ADD COLUMN deleted INTEGER DEFAULT 0 NOT NULL;`,
+	`ALTER TABLE messages ADD COLUMN status TEXT DEFAULT '' NOT NULL;`,
+	`ALTER TABLE chats ADD COLUMN message_ttl INTEGER DEFAULT 0 NOT NULL;`,
+	`ALTER TABLE messages ADD COLUMN expires_at INTEGER DEFAULT 0 NOT NULL;`,
+	`CREATE INDEX IF NOT EXISTS messages_expires_at ON messages (expires_at);`,
+	`ALTER TABLE chats ADD COLUMN state TEXT DEFAULT '' NOT NULL;`,
+	// chats from before the handshake state machine
+	`UPDATE chats SET state = 'accepted' WHERE state = '' AND accepted = 1;`,
+	`UPDATE chats SET state = 'requested' WHERE state = '' AND am_i_initiator = 1;`,
+	`UPDATE chats SET state = 'pending' WHERE state = '';`,
+	`ALTER TABLE chats ADD COLUMN mirrored_from INTEGER DEFAULT 0 NOT NULL;`,
+	`ALTER TABLE chats ADD COLUMN last_activity_at INTEGER DEFAULT 0 NOT NULL;`,
+	`CREATE INDEX IF NOT EXISTS chats_last_activity_at ON chats (last_activity_at);`,
+	`ALTER TABLE attachments ADD COLUMN expires_at INTEGER DEFAULT 0 NOT NULL;`,
+	`ALTER TABLE group_members ADD COLUMN skipped_keys BLOB;`,
+	// last_message_id was never maintained before last_activity_at, older chats only get it back
+	`UPDATE chats SET last_message_id = (SELECT MAX(m.message_id) FROM messages m WHERE m.chat_id = chats.chat_id)
+		WHERE last_message_id = 0 AND EXISTS (SELECT 1 FROM messages m WHERE m.chat_id = chats.chat_id);`,
+}
+
+func isAppliedMigrationError(err error) bool {
+	return strings.Contains(err.Error(), "duplicate column name")
+}
+
+func initDatabase(db *sql.DB) error {
+	_, err := db.Exec("PRAGMA journal_mode = WAL;")
+	if err != nil {
+		return err
+	}
+	for _, sqlq := range initSqls {
+		_, err = db.Exec(sqlq)
+		if err != nil {
+			return err
+		}
+	}
+	for _, sqlq := range migrationSqls {
+		_, err = db.Exec(sqlq)
+		if err != nil && !isAppliedMigrationError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqlConn is a *sql.DB, or a *sql.Tx for the SqliteDB handed out by WithTx.
+type sqlConn interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 type SqliteDB struct {
-	db *sql.DB
+	db   *sql.DB
+	conn sqlConn
 }
 
 func NewSqliteDB(filename string) (*SqliteDB, error) {
-	db, err := sql.Open("sqlite3", filename)
+	db, err := sql.Open(sqliteDriver, filename)
 	if err != nil {
 		return nil, err
 	}
-	_, err = db.Exec("PRAGMA foreign_keys = ON;")
+	err = initDatabase(db)
+	if err != nil {
+		return nil, err
+	}
+	return &SqliteDB{db: db, conn: db}, nil
+}
+func NewSqliteDBWithPassword(filename string, password string) (*SqliteDB, error) {
+	password = strings.ToUpper(password)
+	key := url.QueryEscape(password)
+	ur := fmt.Sprintf("%s?_pragma_key=%s&_pragma_cipher_page_size=4096", filename, key)
+	db, err := sql.Open(sqliteDriver, ur)
 	if err != nil {
 		return nil, err
 	}
-	_, err = db.Exec("PRAGMA journal_mode = WAL;")
+	err = initDatabase(db)
 	if err != nil {
 		return nil, err
 	}
-	for _, sqlq := range initSqls {
-		_, err = db.Exec(sqlq)
-		if err != nil {
-			return nil, err
+	return &SqliteDB{db: db, conn: db}, nil
+}
+
+func (s *SqliteDB) Close() error {
+	return s.db.Close()
+}
+
+func (s *SqliteDB) WithTx(fn func(tx Tx) error) error {
+	sqlTx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = sqlTx.Rollback()
+			panic(p)
 		}
+	}()
+	if err = fn(&SqliteDB{db: s.db, conn: sqlTx}); err != nil {
+		_ = sqlTx.Rollback()
+		return err
 	}
-	return &SqliteDB{db: db}, nil
+	return sqlTx.Commit()
 }
-func NewSqliteDBWithPassword(filename string, password string) (*SqliteDB, error) {
-	password = strings.ToUpper(password)
-	key := url.QueryEscape(password)
-	ur := fmt.Sprintf("%s?_pragma_key=%s&_pragma_cipher_page_size=4096", filename, key)
-	db, err := sql.Open("sqlite3", ur)
+
+func (s *SqliteDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return s.conn.Exec(query, args...)
+}
+
+func (s *SqliteDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.conn.Query(query, args...)
+}
+
+func (s *SqliteDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return s.conn.QueryRow(query, args...)
+}
+
+// chatColumns selects a chat joined with the cached info of the other user.
+const chatColumns = "c.chat_id, c.other_user_id, c.last_message_id, c.last_activity_at, c.am_i_initiator, c.accepted, c.other_user_rsa_public, c.other_user_ecdsa_public, c.my_rsa_private, c.title, c.message_ttl, c.state, c.mirrored_from, COALESCE(u.username, '')"
+
+const chatsFrom = " FROM chats c LEFT JOIN user_infos u ON u.user_id = c.other_user_id"
+
+func (s *SqliteDB) scanChat(row interface {
+	Scan(dest ...interface{}) error
+}) (*Chat, error) {
+	chat := &Chat{}
+	err := row.Scan(&chat.ChatId, &chat.OtherUserId, &chat.LastMessageId, &chat.LastActivityAt, &chat.AmIInitiator, &chat.Accepted, &chat.OtherUserRsaPublic, &chat.OtherUserEcdsaPublic, &chat.MyRsaPrivate, &chat.Title, &chat.MessageTtl, &chat.State, &chat.MirroredFrom, &chat.OtherUsername)
 	if err != nil {
 		return nil, err
 	}
-	_, err = db.Exec("PRAGMA foreign_keys = ON;")
+	chatMessages, err := s.GetMessages(chat.ChatId)
 	if err != nil {
 		return nil, err
 	}
-	_, err = db.Exec("PRAGMA journal_mode = WAL;")
+	chat.Messages = chatMessages
+	return chat, nil
+}
+
+func (s *SqliteDB) queryChats(query string) ([]*Chat, error) {
+	rows, err := s.Query(query)
 	if err != nil {
 		return nil, err
 	}
-	for _, sqlq := range initSqls {
-		_, err = db.Exec(sqlq)
+	defer rows.Close()
+	chats := make([]*Chat, 0)
+	for rows.Next() {
+		chat, err := s.scanChat(rows)
 		if err != nil {
 			return nil, err
 		}
+		chats = append(chats, chat)
 	}
-	return &SqliteDB{db: db}, nil
+	return chats, rows.Err()
 }
 
-func (s *SqliteDB) Close() error {
-	return s.db.Close()
+func (s *SqliteDB) GetAllChats() ([]*Chat, error) {
+	return s.queryChats("SELECT " + chatColumns + chatsFrom)
 }
 
-func (s *SqliteDB) Exec(query string, args ...interface{}) (sql.Result, error) {
-	return s.db.Exec(query, args...)
+// GetChatsSortedByActivity returns the chats with the most recent message or creation first.
+func (s *SqliteDB) GetChatsSortedByActivity() ([]*Chat, error) {
+	return s.queryChats("SELECT " + chatColumns + chatsFrom + " ORDER BY c.last_activity_at DESC, c.last_message_id DESC, c.chat_id DESC")
 }
 
-func (s *SqliteDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	return s.db.Query(query, args...)
+func (s *SqliteDB) GetChat(chatId uint64) (*Chat, error) {
+	chat, err := s.scanChat(s.QueryRow("SELECT "+chatColumns+chatsFrom+" WHERE c.chat_id = ?", chatId))
+	if err == sql.ErrNoRows {
+		return nil, ErrChatNotFound
+	}
+	return chat, err
 }
 
-func (s *SqliteDB) QueryRow(query string, args ...interface{}) *sql.Row {
-	return s.db.QueryRow(query, args...)
+// SaveChat stores a new chat, LastActivityAt defaults to now.
+func (s *SqliteDB) SaveChat(c *Chat) error {
+	if c.LastActivityAt == 0 {
+		c.LastActivityAt = time.Now().Unix()
+	}
+	_, err := s.Exec(
+		"INSERT INTO chats (chat_id, other_user_id, last_message_id, last_activity_at, am_i_initiator, accepted, other_user_rsa_public, other_user_ecdsa_public, my_rsa_private, title, message_ttl, state, mirrored_from) VALUES (?, ?, ?, ?, ?, ?, ?, ?, COALESCE(?, X''), ?, ?, ?, ?)",
+		c.ChatId, c.OtherUserId, c.LastMessageId, c.LastActivityAt, c.AmIInitiator, c.Accepted, c.OtherUserRsaPublic, c.OtherUserEcdsaPublic, c.MyRsaPrivate, c.Title, c.MessageTtl, c.State, c.MirroredFrom,
+	)
+	return err
 }
 
-func (s *SqliteDB) NewChat() *Chat {
-	return &Chat{db: s}
+// UpdateChat leaves LastMessageId and LastActivityAt alone, they only move with stored messages.
+func (s *SqliteDB) UpdateChat(c *Chat) error {
+	_, err := s.Exec(
+		"UPDATE chats SET other_user_id = ?, am_i_initiator = ?, accepted = ?, other_user_rsa_public = ?, other_user_ecdsa_public = ?, my_rsa_private = COALESCE(?, X''), title = ?, message_ttl = ?, state = ?, mirrored_from = ? WHERE chat_id = ?",
+		c.OtherUserId, c.AmIInitiator, c.Accepted, c.OtherUserRsaPublic, c.OtherUserEcdsaPublic, c.MyRsaPrivate, c.Title, c.MessageTtl, c.State, c.MirroredFrom, c.ChatId,
+	)
+	return err
 }
 
-func (s *SqliteDB) NewMessage() *Message {
-	return &Message{db: s}
+func (s *SqliteDB) DeleteChat(chatId uint64) error {
+	_, err := s.Exec("DELETE FROM chats WHERE chat_id = ?", chatId)
+	return err
 }
 
-func (s *SqliteDB) GetAllChats() ([]*Chat, error) {
-	rows, err := s.Query("SELECT chat_id, other_user_id, last_message_id, am_i_initiator, accepted, other_user_rsa_public, other_user_ecdsa_public, my_rsa_private, title FROM chats")
+func (s *SqliteDB) SaveMessage(m *Message) error {
+	_, err := s.Exec(
+		"INSERT INTO messages (message_id, chat_id, sender_id, content, reply_to, edited, deleted, status, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		m.MessageId, m.ChatId, m.SenderId, m.Content, m.ReplyTo, m.Edited, m.Deleted, m.Status, m.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+	return s.touchChat(m.ChatId, m.MessageId, time.Now().Unix())
+}
+
+// touchChat records a new message in the chat's last_message_id and last_activity_at.
+func (s *SqliteDB) touchChat(chatId uint64, messageId uint64, at int64) error {
+	_, err := s.Exec("UPDATE chats SET last_message_id = MAX(last_message_id, ?), last_activity_at = MAX(last_activity_at, ?) WHERE chat_id = ?", messageId, at, chatId)
+	return err
+}
+
+func (s *SqliteDB) UpdateMessage(m *Message) error {
+	_, err := s.Exec(
+		"UPDATE messages SET sender_id = ?, content = ?, reply_to = ?, edited = ?, deleted = ?, status = ?, expires_at = ? WHERE chat_id = ? AND message_id = ?",
+		m.SenderId, m.Content, m.ReplyTo, m.Edited, m.Deleted, m.Status, m.ExpiresAt, m.ChatId, m.MessageId,
+	)
+	return err
+}
+
+// DeleteMessage deletes a message with its reactions, like DeleteExpiredMessages.
+func (s *SqliteDB) DeleteMessage(chatId uint64, messageId uint64) error {
+	_, err := s.Exec("DELETE FROM message_reactions WHERE chat_id = ? AND message_id = ?", chatId, messageId)
+	if err != nil {
+		return err
+	}
+	_, err = s.Exec("DELETE FROM messages WHERE chat_id = ? AND message_id = ?", chatId, messageId)
+	return err
+}
+
+func (s *SqliteDB) GetMessages(chatId uint64) ([]*Message, error) {
+	rows, err := s.Query("SELECT message_id, chat_id, sender_id, content, reply_to, edited, deleted, status, expires_at FROM messages WHERE chat_id = ?", chatId)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	chats := make([]*Chat, 0)
+	messages := make([]*Message, 0)
 	for rows.Next() {
-		chat := &Chat{
-			db: s,
-		}
-		err = rows.Scan(&chat.ChatId, &chat.OtherUserId, &chat.LastMessageId, &chat.AmIInitiator, &chat.Accepted, &chat.OtherUserRsaPublic, &chat.OtherUserEcdsaPublic, &chat.MyRsaPrivate, &chat.Title)
+		message := &Message{}
+		err = rows.Scan(&message.MessageId, &message.ChatId, &message.SenderId, &message.Content, &message.ReplyTo, &message.Edited, &message.Deleted, &message.Status, &message.ExpiresAt)
 		if err != nil {
 			return nil, err
 		}
-		chatMessages, err := s.GetMessages(chat.ChatId)
+		messages = append(messages, message)
+	}
+	rows.Close()
+	reactions, err := s.getChatReactions(chatId)
+	if err != nil {
+		return nil, err
+	}
+	for _, message := range messages {
+		message.Reactions = reactions[message.MessageId]
+	}
+	return messages, nil
+}
+
+// GetMessage returns nil if the message does not exist.
+func (s *SqliteDB) GetMessage(chatId uint64, messageId uint64) (*Message, error) {
+	message := &Message{}
+	err := s.QueryRow("SELECT message_id, chat_id, sender_id, content, reply_to, edited, deleted, status, expires_at FROM messages WHERE chat_id = ? AND message_id = ?", chatId, messageId).
+		Scan(&message.MessageId, &message.ChatId, &message.SenderId, &message.Content, &message.ReplyTo, &message.Edited, &message.Deleted, &message.Status, &message.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	reactions, err := s.getChatReactions(chatId)
+	if err != nil {
+		return nil, err
+	}
+	message.Reactions = reactions[messageId]
+	return message, nil
+}
+
+func (s *SqliteDB) getChatReactions(chatId uint64) (map[uint64][]*Reaction, error) {
+	rows, err := s.Query("SELECT message_id, user_id, reaction FROM message_reactions WHERE chat_id = ?", chatId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reactions := make(map[uint64][]*Reaction)
+	for rows.Next() {
+		var messageId uint64
+		reaction := &Reaction{}
+		err = rows.Scan(&messageId, &reaction.UserId, &reaction.Reaction)
 		if err != nil {
 			return nil, err
 		}
-		chat.Messages = chatMessages
-		chats = append(chats, chat)
+		reactions[messageId] = append(reactions[messageId], reaction)
 	}
-	return chats, nil
+	return reactions, nil
 }
 
-func (s *SqliteDB) GetChat(chatId uint64) (*Chat, error) {
-	row := s.QueryRow("SELECT chat_id, other_user_id, last_message_id, am_i_initiator, accepted, other_user_rsa_public, other_user_ecdsa_public, my_rsa_private, title FROM chats WHERE chat_id = ?", chatId)
-	chat := &Chat{
-		db: s,
+// SetReaction stores the reaction of userId to a message, an empty reaction removes it.
+func (s *SqliteDB) SetReaction(chatId uint64, messageId uint64, userId uint64, reaction string) error {
+	_, err := s.Exec("DELETE FROM message_reactions WHERE chat_id = ? AND message_id = ? AND user_id = ?", chatId, messageId, userId)
+	if err != nil || reaction == "" {
+		return err
+	}
+	_, err = s.Exec("INSERT INTO message_reactions (chat_id, message_id, user_id, reaction) VALUES (?, ?, ?, ?)", chatId, messageId, userId, reaction)
+	return err
+}
+
+// GetAcceptedChatWithUser returns the most recent accepted chat with userId, or nil if there is none.
+func (s *SqliteDB) GetAcceptedChatWithUser(userId uint64) (*Chat, error) {
+	var chatId uint64
+	err := s.QueryRow("SELECT chat_id FROM chats WHERE other_user_id = ? AND accepted = 1 ORDER BY chat_id DESC LIMIT 1", userId).Scan(&chatId)
+	if err == sql.ErrNoRows {
+		return nil, nil
 	}
-	err := row.Scan(&chat.ChatId, &chat.OtherUserId, &chat.LastMessageId, &chat.AmIInitiator, &chat.Accepted, &chat.OtherUserRsaPublic, &chat.OtherUserEcdsaPublic, &chat.MyRsaPrivate, &chat.Title)
 	if err != nil {
 		return nil, err
 	}
-	chatMessages, err := s.GetMessages(chatId)
+	return s.GetChat(chatId)
+}
+
+// GetUnreadMessageIds returns the ids of messages in chatId that were received from the other
+// user and not marked as read yet.
+func (s *SqliteDB) GetUnreadMessageIds(chatId uint64, myUserId uint64) ([]uint64, error) {
+	rows, err := s.Query("SELECT message_id FROM messages WHERE chat_id = ? AND sender_id != ? AND status != ?", chatId, myUserId, MessageStatusRead)
 	if err != nil {
 		return nil, err
 	}
-	chat.Messages = chatMessages
-	return chat, nil
+	defer rows.Close()
+	ids := make([]uint64, 0)
+	for rows.Next() {
+		var id uint64
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
 }
 
-func (s *SqliteDB) GetMessages(chatId uint64) ([]*Message, error) {
-	rows, err := s.Query("SELECT message_id, chat_id, sender_id, content FROM messages WHERE chat_id = ?", chatId)
+func (s *SqliteDB) SetMessageStatus(chatId uint64, messageId uint64, status MessageStatus) error {
+	_, err := s.Exec("UPDATE messages SET status = ? WHERE chat_id = ? AND message_id = ?", status, chatId, messageId)
+	return err
+}
+
+// DeleteExpiredMessages removes messages and attachments whose expires_at passed and returns their
+// ids by chat.
+func (s *SqliteDB) DeleteExpiredMessages(now int64) (map[uint64][]uint64, error) {
+	rows, err := s.Query(`SELECT chat_id, message_id FROM messages WHERE expires_at != 0 AND expires_at <= ?
+		UNION ALL SELECT chat_id, message_id FROM attachments WHERE expires_at != 0 AND expires_at <= ?`, now, now)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	messages := make([]*Message, 0)
+	expired := make(map[uint64][]uint64)
 	for rows.Next() {
-		message := &Message{
-			db: s,
-		}
-		err = rows.Scan(&message.MessageId, &message.ChatId, &message.SenderId, &message.Content)
-		if err != nil {
+		var chatId, messageId uint64
+		if err = rows.Scan(&chatId, &messageId); err != nil {
 			return nil, err
 		}
-		messages = append(messages, message)
+		expired[chatId] = append(expired[chatId], messageId)
 	}
-	return messages, nil
+	rows.Close()
+	if len(expired) == 0 {
+		return expired, nil
+	}
+	_, err = s.Exec("DELETE FROM message_reactions WHERE EXISTS (SELECT 1 FROM messages m WHERE m.chat_id = message_reactions.chat_id AND m.message_id = message_reactions.message_id AND m.expires_at != 0 AND m.expires_at <= ?)", now)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.Exec("DELETE FROM messages WHERE expires_at != 0 AND expires_at <= ?", now)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.Exec("DELETE FROM attachments WHERE expires_at != 0 AND expires_at <= ?", now)
+	if err != nil {
+		return nil, err
+	}
+	// deleted pages may still be in the write-ahead log
+	_, err = s.Exec("PRAGMA wal_checkpoint(TRUNCATE);")
+	if err != nil {
+		return nil, err
+	}
+	return expired, nil
 }
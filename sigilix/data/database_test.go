@@ -0,0 +1,34 @@
+package data
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestPragmasOnEveryConnection(t *testing.T) {
+	db, err := NewSqliteDBWithPassword(filepath.Join(t.TempDir(), "test.db"), "00112233445566778899aabbccddeeff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	// holding the first connection makes the pool open a second one
+	for i := 0; i < 2; i++ {
+		conn, err := db.db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		for _, pragma := range []string{"secure_delete", "foreign_keys"} {
+			var value int
+			if err = conn.QueryRowContext(ctx, "PRAGMA "+pragma).Scan(&value); err != nil {
+				t.Fatal(err)
+			}
+			if value != 1 {
+				t.Fatalf("connection %d: %s = %d, want 1", i, pragma, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package data
+
+import "database/sql"
+
+// LinkedDevice is another identity of the user, linked to this (primary) device.
+type LinkedDevice struct {
+	DeviceUserId uint64 `json:"device_user_id"`
+	// ChatId is the chat between the primary and the device that carries the sync traffic.
+	ChatId uint64 `json:"chat_id"`
+	Name   string `json:"name"`
+	// Certificate is the signed device certificate as sent to the device.
+	Certificate []byte `json:"-"`
+	LinkedAt    int64  `json:"linked_at"`
+}
+
+func (s *SqliteDB) SaveLinkedDevice(d *LinkedDevice) error {
+	return s.execUpsert(
+		"UPDATE linked_devices SET chat_id = ?, name = ?, certificate = ?, linked_at = ? WHERE device_user_id = ?",
+		[]interface{}{d.ChatId, d.Name, d.Certificate, d.LinkedAt, d.DeviceUserId},
+		"INSERT INTO linked_devices (device_user_id, chat_id, name, certificate, linked_at) VALUES (?, ?, ?, ?, ?)",
+		[]interface{}{d.DeviceUserId, d.ChatId, d.Name, d.Certificate, d.LinkedAt},
+	)
+}
+
+func (s *SqliteDB) DeleteLinkedDevice(deviceUserId uint64) error {
+	_, err := s.Exec("DELETE FROM linked_devices WHERE device_user_id = ?", deviceUserId)
+	return err
+}
+
+// GetLinkedDevice returns nil if deviceUserId is not linked.
+func (s *SqliteDB) GetLinkedDevice(deviceUserId uint64) (*LinkedDevice, error) {
+	device := &LinkedDevice{}
+	err := s.QueryRow("SELECT device_user_id, chat_id, name, certificate, linked_at FROM linked_devices WHERE device_user_id = ?", deviceUserId).
+		Scan(&device.DeviceUserId, &device.ChatId, &device.Name, &device.Certificate, &device.LinkedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+func (s *SqliteDB) GetLinkedDevices() ([]*LinkedDevice, error) {
+	rows, err := s.Query("SELECT device_user_id, chat_id, name, certificate, linked_at FROM linked_devices ORDER BY linked_at")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	devices := make([]*LinkedDevice, 0)
+	for rows.Next() {
+		device := &LinkedDevice{}
+		err = rows.Scan(&device.DeviceUserId, &device.ChatId, &device.Name, &device.Certificate, &device.LinkedAt)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// DeleteMirroredChats removes the chats mirrored from a primary device, with their messages.
+func (s *SqliteDB) DeleteMirroredChats(primaryUserId uint64) error {
+	_, err := s.Exec("DELETE FROM chats WHERE mirrored_from = ?", primaryUserId)
+	return err
+}
@@ -0,0 +1,198 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+type Group struct {
+	GroupId string `json:"group_id"`
+	Title   string `json:"title"`
+	OwnerId uint64 `json:"owner_id"`
+	// Left is set once we were removed from the group, it is kept for the history.
+	Left        bool   `json:"left"`
+	MyChainKey  []byte `json:"-"`
+	MyIteration uint32 `json:"-"`
+
+	Members []*GroupMember `json:"members"`
+}
+
+func (g *Group) Member(userId uint64) *GroupMember {
+	for _, member := range g.Members {
+		if member.UserId == userId {
+			return member
+		}
+	}
+	return nil
+}
+
+type GroupMember struct {
+	GroupId string `json:"group_id"`
+	UserId  uint64 `json:"user_id"`
+	// ChainKey is the member's sender key, nil until it has been distributed to us.
+	ChainKey  []byte `json:"-"`
+	Iteration uint32 `json:"-"`
+	// SkippedKeys are the message keys of iterations below Iteration whose messages did not arrive
+	// yet, by iteration.
+	SkippedKeys map[uint32][]byte `json:"-"`
+}
+
+type GroupMessage struct {
+	Id        uint64 `json:"id"`
+	GroupId   string `json:"group_id"`
+	SenderId  uint64 `json:"sender_id"`
+	Iteration uint32 `json:"iteration"`
+	Content   string `json:"content"`
+}
+
+// execUpsert runs update and falls back to insert if no row was updated. The bundled SQLite is
+// too old for ON CONFLICT DO UPDATE, and INSERT OR REPLACE would cascade-delete child rows.
+func (s *SqliteDB) execUpsert(update string, updateArgs []interface{}, insert string, insertArgs []interface{}) error {
+	res, err := s.Exec(update, updateArgs...)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+	_, err = s.Exec(insert, insertArgs...)
+	return err
+}
+
+func (s *SqliteDB) SaveGroup(g *Group) error {
+	return s.execUpsert(
+		"UPDATE chat_groups SET title = ?, owner_id = ?, left_group = ?, my_chain_key = ?, my_iteration = ? WHERE group_id = ?",
+		[]interface{}{g.Title, g.OwnerId, g.Left, g.MyChainKey, g.MyIteration, g.GroupId},
+		"INSERT INTO chat_groups (group_id, title, owner_id, left_group, my_chain_key, my_iteration) VALUES (?, ?, ?, ?, ?, ?)",
+		[]interface{}{g.GroupId, g.Title, g.OwnerId, g.Left, g.MyChainKey, g.MyIteration},
+	)
+}
+
+func (s *SqliteDB) DeleteGroup(groupId string) error {
+	_, err := s.Exec("DELETE FROM chat_groups WHERE group_id = ?", groupId)
+	return err
+}
+
+func (s *SqliteDB) SaveGroupMember(m *GroupMember) error {
+	skipped, err := json.Marshal(m.SkippedKeys)
+	if err != nil {
+		return err
+	}
+	return s.execUpsert(
+		"UPDATE group_members SET chain_key = ?, iteration = ?, skipped_keys = ? WHERE group_id = ? AND user_id = ?",
+		[]interface{}{m.ChainKey, m.Iteration, skipped, m.GroupId, m.UserId},
+		"INSERT INTO group_members (group_id, user_id, chain_key, iteration, skipped_keys) VALUES (?, ?, ?, ?, ?)",
+		[]interface{}{m.GroupId, m.UserId, m.ChainKey, m.Iteration, skipped},
+	)
+}
+
+func (s *SqliteDB) DeleteGroupMember(groupId string, userId uint64) error {
+	_, err := s.Exec("DELETE FROM group_members WHERE group_id = ? AND user_id = ?", groupId, userId)
+	return err
+}
+
+func (s *SqliteDB) GetGroup(groupId string) (*Group, error) {
+	group := &Group{}
+	err := s.QueryRow("SELECT group_id, title, owner_id, left_group, my_chain_key, my_iteration FROM chat_groups WHERE group_id = ?", groupId).
+		Scan(&group.GroupId, &group.Title, &group.OwnerId, &group.Left, &group.MyChainKey, &group.MyIteration)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	group.Members, err = s.getGroupMembers(groupId)
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+func (s *SqliteDB) GetGroups() ([]*Group, error) {
+	rows, err := s.Query("SELECT group_id, title, owner_id, left_group, my_chain_key, my_iteration FROM chat_groups")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	groups := make([]*Group, 0)
+	for rows.Next() {
+		group := &Group{}
+		err = rows.Scan(&group.GroupId, &group.Title, &group.OwnerId, &group.Left, &group.MyChainKey, &group.MyIteration)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		group.Members, err = s.getGroupMembers(group.GroupId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+func (s *SqliteDB) getGroupMembers(groupId string) ([]*GroupMember, error) {
+	rows, err := s.Query("SELECT group_id, user_id, chain_key, iteration, skipped_keys FROM group_members WHERE group_id = ?", groupId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := make([]*GroupMember, 0)
+	for rows.Next() {
+		member := &GroupMember{}
+		var skipped []byte
+		err = rows.Scan(&member.GroupId, &member.UserId, &member.ChainKey, &member.Iteration, &skipped)
+		if err != nil {
+			return nil, err
+		}
+		if len(skipped) > 0 {
+			if err = json.Unmarshal(skipped, &member.SkippedKeys); err != nil {
+				return nil, err
+			}
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+func (s *SqliteDB) SaveGroupMessage(m *GroupMessage) error {
+	res, err := s.Exec(
+		"INSERT INTO group_messages (group_id, sender_id, iteration, content) VALUES (?, ?, ?, ?)",
+		m.GroupId, m.SenderId, m.Iteration, m.Content,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	m.Id = uint64(id)
+	return nil
+}
+
+func (s *SqliteDB) GetGroupMessages(groupId string) ([]*GroupMessage, error) {
+	rows, err := s.Query("SELECT id, group_id, sender_id, iteration, content FROM group_messages WHERE group_id = ? ORDER BY id", groupId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	messages := make([]*GroupMessage, 0)
+	for rows.Next() {
+		message := &GroupMessage{}
+		err = rows.Scan(&message.Id, &message.GroupId, &message.SenderId, &message.Iteration, &message.Content)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
@@ -0,0 +1,717 @@
+package data
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps everything in memory, for tests and for clients that must not
+// leave a history behind. It follows the semantics of SqliteDB, including the cascades.
+type MemoryStore struct {
+	mu sync.Mutex
+
+	chats     map[uint64]*Chat
+	messages  map[uint64][]*Message
+	reactions map[reactionKey]string
+	// attachments are keyed like messages
+	attachments map[messageKey]*Attachment
+
+	contacts  map[uint64]*Contact
+	userInfos map[uint64]*UserInfo
+	devices   map[uint64]*LinkedDevice
+
+	groups           map[string]*Group
+	groupMembers     map[string][]*GroupMember
+	groupMessages    []*GroupMessage
+	lastGroupMessage uint64
+}
+
+type messageKey struct {
+	chatId    uint64
+	messageId uint64
+}
+
+type reactionKey struct {
+	messageKey
+	userId uint64
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		chats:        make(map[uint64]*Chat),
+		messages:     make(map[uint64][]*Message),
+		reactions:    make(map[reactionKey]string),
+		attachments:  make(map[messageKey]*Attachment),
+		contacts:     make(map[uint64]*Contact),
+		userInfos:    make(map[uint64]*UserInfo),
+		devices:      make(map[uint64]*LinkedDevice),
+		groups:       make(map[string]*Group),
+		groupMembers: make(map[string][]*GroupMember),
+	}
+}
+
+func (s *MemoryStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replace(NewMemoryStore())
+	return nil
+}
+
+// WithTx runs fn on a copy of the store and keeps the copy if fn succeeds. The store stays locked
+// meanwhile, so that no change made next to the transaction is lost.
+func (s *MemoryStore) WithTx(fn func(tx Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := s.clone()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	s.replace(tx)
+	return nil
+}
+
+// clone copies the maps and slices of s. Stored values are shared, they are replaced rather than
+// modified. Callers must hold s.mu.
+func (s *MemoryStore) clone() *MemoryStore {
+	c := NewMemoryStore()
+	for k, v := range s.chats {
+		c.chats[k] = v
+	}
+	for k, v := range s.messages {
+		c.messages[k] = append([]*Message(nil), v...)
+	}
+	for k, v := range s.reactions {
+		c.reactions[k] = v
+	}
+	for k, v := range s.attachments {
+		c.attachments[k] = v
+	}
+	for k, v := range s.contacts {
+		c.contacts[k] = v
+	}
+	for k, v := range s.userInfos {
+		c.userInfos[k] = v
+	}
+	for k, v := range s.devices {
+		c.devices[k] = v
+	}
+	for k, v := range s.groups {
+		c.groups[k] = v
+	}
+	for k, v := range s.groupMembers {
+		c.groupMembers[k] = append([]*GroupMember(nil), v...)
+	}
+	c.groupMessages = append([]*GroupMessage(nil), s.groupMessages...)
+	c.lastGroupMessage = s.lastGroupMessage
+	return c
+}
+
+// replace takes over the content of other. Callers must hold s.mu.
+func (s *MemoryStore) replace(other *MemoryStore) {
+	s.chats = other.chats
+	s.messages = other.messages
+	s.reactions = other.reactions
+	s.attachments = other.attachments
+	s.contacts = other.contacts
+	s.userInfos = other.userInfos
+	s.devices = other.devices
+	s.groups = other.groups
+	s.groupMembers = other.groupMembers
+	s.groupMessages = other.groupMessages
+	s.lastGroupMessage = other.lastGroupMessage
+}
+
+func (s *MemoryStore) SaveChat(c *Chat) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.chats[c.ChatId]; ok {
+		return errConstraint("chats.chat_id")
+	}
+	if c.LastActivityAt == 0 {
+		c.LastActivityAt = time.Now().Unix()
+	}
+	s.chats[c.ChatId] = copyChat(c)
+	return nil
+}
+
+func (s *MemoryStore) UpdateChat(c *Chat) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored, ok := s.chats[c.ChatId]; ok {
+		chat := copyChat(c)
+		chat.LastMessageId = stored.LastMessageId
+		chat.LastActivityAt = stored.LastActivityAt
+		s.chats[c.ChatId] = chat
+	}
+	return nil
+}
+
+func (s *MemoryStore) touchChat(chatId uint64, messageId uint64, at int64) {
+	stored, ok := s.chats[chatId]
+	if !ok {
+		return
+	}
+	chat := *stored
+	chat.LastMessageId = max(chat.LastMessageId, messageId)
+	chat.LastActivityAt = max(chat.LastActivityAt, at)
+	s.chats[chatId] = &chat
+}
+
+func (s *MemoryStore) DeleteChat(chatId uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteChat(chatId)
+	return nil
+}
+
+func (s *MemoryStore) deleteChat(chatId uint64) {
+	delete(s.chats, chatId)
+	delete(s.messages, chatId)
+	for key := range s.reactions {
+		if key.chatId == chatId {
+			delete(s.reactions, key)
+		}
+	}
+	for key := range s.attachments {
+		if key.chatId == chatId {
+			delete(s.attachments, key)
+		}
+	}
+}
+
+func (s *MemoryStore) GetChat(chatId uint64) (*Chat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chat, ok := s.chats[chatId]
+	if !ok {
+		return nil, ErrChatNotFound
+	}
+	return s.loadChat(chat), nil
+}
+
+// loadChat copies a chat, joins the cached username and loads the messages, like chatColumns.
+func (s *MemoryStore) loadChat(stored *Chat) *Chat {
+	chat := copyChat(stored)
+	chat.OtherUsername = ""
+	if info, ok := s.userInfos[chat.OtherUserId]; ok {
+		chat.OtherUsername = info.Username
+	}
+	chat.Messages = s.getMessages(chat.ChatId)
+	return chat
+}
+
+func (s *MemoryStore) GetAllChats() ([]*Chat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chats := make([]*Chat, 0, len(s.chats))
+	for _, chat := range s.chats {
+		chats = append(chats, s.loadChat(chat))
+	}
+	sort.Slice(chats, func(i, j int) bool { return chats[i].ChatId < chats[j].ChatId })
+	return chats, nil
+}
+
+func (s *MemoryStore) GetChatsSortedByActivity() ([]*Chat, error) {
+	chats, err := s.GetAllChats()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(chats, func(i, j int) bool {
+		a, b := chats[i], chats[j]
+		if a.LastActivityAt != b.LastActivityAt {
+			return a.LastActivityAt > b.LastActivityAt
+		}
+		if a.LastMessageId != b.LastMessageId {
+			return a.LastMessageId > b.LastMessageId
+		}
+		return a.ChatId > b.ChatId
+	})
+	return chats, nil
+}
+
+func (s *MemoryStore) GetAcceptedChatWithUser(userId uint64) (*Chat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var found *Chat
+	for _, chat := range s.chats {
+		if chat.OtherUserId == userId && chat.Accepted && (found == nil || chat.ChatId > found.ChatId) {
+			found = chat
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+	return s.loadChat(found), nil
+}
+
+func (s *MemoryStore) DeleteMirroredChats(primaryUserId uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for chatId, chat := range s.chats {
+		if chat.MirroredFrom == primaryUserId {
+			s.deleteChat(chatId)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) SaveMessage(m *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.chats[m.ChatId]; !ok {
+		return errConstraint("messages.chat_id")
+	}
+	if s.findMessage(m.ChatId, m.MessageId) >= 0 {
+		return errConstraint("messages.chat_id, messages.message_id")
+	}
+	s.messages[m.ChatId] = append(s.messages[m.ChatId], copyMessage(m))
+	s.touchChat(m.ChatId, m.MessageId, time.Now().Unix())
+	return nil
+}
+
+func (s *MemoryStore) UpdateMessage(m *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.findMessage(m.ChatId, m.MessageId); i >= 0 {
+		s.messages[m.ChatId][i] = copyMessage(m)
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteMessage(chatId uint64, messageId uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteMessage(chatId, messageId)
+	return nil
+}
+
+// deleteMessage removes a message, its reactions go with it like in DeleteExpiredMessages.
+func (s *MemoryStore) deleteMessage(chatId uint64, messageId uint64) {
+	i := s.findMessage(chatId, messageId)
+	if i < 0 {
+		return
+	}
+	messages := s.messages[chatId]
+	s.messages[chatId] = append(messages[:i:i], messages[i+1:]...)
+	for key := range s.reactions {
+		if key.chatId == chatId && key.messageId == messageId {
+			delete(s.reactions, key)
+		}
+	}
+}
+
+func (s *MemoryStore) findMessage(chatId uint64, messageId uint64) int {
+	for i, message := range s.messages[chatId] {
+		if message.MessageId == messageId {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *MemoryStore) GetMessage(chatId uint64, messageId uint64) (*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findMessage(chatId, messageId)
+	if i < 0 {
+		return nil, nil
+	}
+	message := copyMessage(s.messages[chatId][i])
+	message.Reactions = s.getReactions(chatId, messageId)
+	return message, nil
+}
+
+func (s *MemoryStore) GetMessages(chatId uint64) ([]*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.getMessages(chatId), nil
+}
+
+func (s *MemoryStore) getMessages(chatId uint64) []*Message {
+	messages := make([]*Message, 0, len(s.messages[chatId]))
+	for _, stored := range s.messages[chatId] {
+		message := copyMessage(stored)
+		message.Reactions = s.getReactions(chatId, message.MessageId)
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+func (s *MemoryStore) getReactions(chatId uint64, messageId uint64) []*Reaction {
+	var reactions []*Reaction
+	for key, reaction := range s.reactions {
+		if key.chatId == chatId && key.messageId == messageId {
+			reactions = append(reactions, &Reaction{UserId: key.userId, Reaction: reaction})
+		}
+	}
+	sort.Slice(reactions, func(i, j int) bool { return reactions[i].UserId < reactions[j].UserId })
+	return reactions
+}
+
+func (s *MemoryStore) SetReaction(chatId uint64, messageId uint64, userId uint64, reaction string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := reactionKey{messageKey{chatId, messageId}, userId}
+	if reaction == "" {
+		delete(s.reactions, key)
+		return nil
+	}
+	if _, ok := s.chats[chatId]; !ok {
+		return errConstraint("message_reactions.chat_id")
+	}
+	s.reactions[key] = reaction
+	return nil
+}
+
+func (s *MemoryStore) GetUnreadMessageIds(chatId uint64, myUserId uint64) ([]uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]uint64, 0)
+	for _, message := range s.messages[chatId] {
+		if message.SenderId != myUserId && message.Status != MessageStatusRead {
+			ids = append(ids, message.MessageId)
+		}
+	}
+	return ids, nil
+}
+
+func (s *MemoryStore) SetMessageStatus(chatId uint64, messageId uint64, status MessageStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.findMessage(chatId, messageId); i >= 0 {
+		message := *s.messages[chatId][i]
+		message.Status = status
+		s.messages[chatId][i] = &message
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteExpiredMessages(now int64) (map[uint64][]uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expired := make(map[uint64][]uint64)
+	for chatId, messages := range s.messages {
+		for _, message := range messages {
+			if message.ExpiresAt != 0 && message.ExpiresAt <= now {
+				expired[chatId] = append(expired[chatId], message.MessageId)
+			}
+		}
+	}
+	for chatId, messageIds := range expired {
+		for _, messageId := range messageIds {
+			s.deleteMessage(chatId, messageId)
+		}
+	}
+	for key, attachment := range s.attachments {
+		if attachment.ExpiresAt != 0 && attachment.ExpiresAt <= now {
+			expired[key.chatId] = append(expired[key.chatId], key.messageId)
+			delete(s.attachments, key)
+		}
+	}
+	return expired, nil
+}
+
+func (s *MemoryStore) SaveAttachment(a *Attachment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.chats[a.ChatId]; !ok {
+		return errConstraint("attachments.chat_id")
+	}
+	stored := *a
+	stored.Content = bytes.Clone(a.Content)
+	stored.Size = len(stored.Content)
+	s.attachments[messageKey{a.ChatId, a.MessageId}] = &stored
+	s.touchChat(a.ChatId, a.MessageId, a.CreatedAt)
+	return nil
+}
+
+func (s *MemoryStore) GetAttachment(chatId uint64, messageId uint64) (*Attachment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.attachments[messageKey{chatId, messageId}]
+	if !ok {
+		return nil, nil
+	}
+	attachment := *stored
+	attachment.Content = bytes.Clone(stored.Content)
+	return &attachment, nil
+}
+
+func (s *MemoryStore) GetAttachments(chatId uint64) ([]*Attachment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attachments := make([]*Attachment, 0)
+	for key, stored := range s.attachments {
+		if key.chatId == chatId {
+			attachment := *stored
+			attachment.Content = nil
+			attachments = append(attachments, &attachment)
+		}
+	}
+	sort.Slice(attachments, func(i, j int) bool { return attachments[i].MessageId < attachments[j].MessageId })
+	return attachments, nil
+}
+
+func (s *MemoryStore) SaveContact(c *Contact) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *c
+	stored.EcdsaPublic = bytes.Clone(c.EcdsaPublic)
+	stored.RsaPublic = bytes.Clone(c.RsaPublic)
+	s.contacts[c.UserId] = &stored
+	return nil
+}
+
+func (s *MemoryStore) DeleteContact(userId uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.contacts, userId)
+	return nil
+}
+
+func (s *MemoryStore) GetContact(userId uint64) (*Contact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.contacts[userId]
+	if !ok {
+		return nil, nil
+	}
+	contact := *stored
+	return &contact, nil
+}
+
+func (s *MemoryStore) GetContacts() ([]*Contact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	contacts := make([]*Contact, 0, len(s.contacts))
+	for _, stored := range s.contacts {
+		contact := *stored
+		contacts = append(contacts, &contact)
+	}
+	sort.Slice(contacts, func(i, j int) bool { return contacts[i].UserId < contacts[j].UserId })
+	return contacts, nil
+}
+
+func (s *MemoryStore) IsBlocked(userId uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	contact, ok := s.contacts[userId]
+	return ok && contact.Blocked, nil
+}
+
+func (s *MemoryStore) SaveUserInfo(u *UserInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *u
+	stored.EcdsaPublic = bytes.Clone(u.EcdsaPublic)
+	stored.RsaPublic = bytes.Clone(u.RsaPublic)
+	s.userInfos[u.UserId] = &stored
+	return nil
+}
+
+func (s *MemoryStore) GetUserInfo(userId uint64) (*UserInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.userInfos[userId]
+	if !ok {
+		return nil, nil
+	}
+	info := *stored
+	return &info, nil
+}
+
+func (s *MemoryStore) SaveLinkedDevice(d *LinkedDevice) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *d
+	stored.Certificate = bytes.Clone(d.Certificate)
+	s.devices[d.DeviceUserId] = &stored
+	return nil
+}
+
+func (s *MemoryStore) DeleteLinkedDevice(deviceUserId uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.devices, deviceUserId)
+	return nil
+}
+
+func (s *MemoryStore) GetLinkedDevice(deviceUserId uint64) (*LinkedDevice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.devices[deviceUserId]
+	if !ok {
+		return nil, nil
+	}
+	device := *stored
+	return &device, nil
+}
+
+func (s *MemoryStore) GetLinkedDevices() ([]*LinkedDevice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	devices := make([]*LinkedDevice, 0, len(s.devices))
+	for _, stored := range s.devices {
+		device := *stored
+		devices = append(devices, &device)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].LinkedAt < devices[j].LinkedAt })
+	return devices, nil
+}
+
+func (s *MemoryStore) SaveGroup(g *Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *g
+	stored.MyChainKey = bytes.Clone(g.MyChainKey)
+	stored.Members = nil
+	s.groups[g.GroupId] = &stored
+	return nil
+}
+
+func (s *MemoryStore) DeleteGroup(groupId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.groups, groupId)
+	delete(s.groupMembers, groupId)
+	kept := s.groupMessages[:0]
+	for _, message := range s.groupMessages {
+		if message.GroupId != groupId {
+			kept = append(kept, message)
+		}
+	}
+	s.groupMessages = kept
+	return nil
+}
+
+func (s *MemoryStore) SaveGroupMember(m *GroupMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.groups[m.GroupId]; !ok {
+		return errConstraint("group_members.group_id")
+	}
+	stored := *m
+	stored.ChainKey = bytes.Clone(m.ChainKey)
+	stored.SkippedKeys = cloneSkippedKeys(m.SkippedKeys)
+	members := s.groupMembers[m.GroupId]
+	for i, member := range members {
+		if member.UserId == m.UserId {
+			members[i] = &stored
+			return nil
+		}
+	}
+	s.groupMembers[m.GroupId] = append(members, &stored)
+	return nil
+}
+
+func (s *MemoryStore) DeleteGroupMember(groupId string, userId uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	members := s.groupMembers[groupId]
+	for i, member := range members {
+		if member.UserId == userId {
+			s.groupMembers[groupId] = append(members[:i:i], members[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetGroup(groupId string) (*Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.groups[groupId]
+	if !ok {
+		return nil, nil
+	}
+	return s.loadGroup(stored), nil
+}
+
+func (s *MemoryStore) loadGroup(stored *Group) *Group {
+	group := *stored
+	group.Members = make([]*GroupMember, 0, len(s.groupMembers[group.GroupId]))
+	for _, stored := range s.groupMembers[group.GroupId] {
+		member := *stored
+		member.SkippedKeys = cloneSkippedKeys(stored.SkippedKeys)
+		group.Members = append(group.Members, &member)
+	}
+	return &group
+}
+
+func cloneSkippedKeys(keys map[uint32][]byte) map[uint32][]byte {
+	if keys == nil {
+		return nil
+	}
+	cloned := make(map[uint32][]byte, len(keys))
+	for iteration, key := range keys {
+		cloned[iteration] = bytes.Clone(key)
+	}
+	return cloned
+}
+
+func (s *MemoryStore) GetGroups() ([]*Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	groups := make([]*Group, 0, len(s.groups))
+	for _, stored := range s.groups {
+		groups = append(groups, s.loadGroup(stored))
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].GroupId < groups[j].GroupId })
+	return groups, nil
+}
+
+func (s *MemoryStore) SaveGroupMessage(m *GroupMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.groups[m.GroupId]; !ok {
+		return errConstraint("group_messages.group_id")
+	}
+	s.lastGroupMessage++
+	m.Id = s.lastGroupMessage
+	stored := *m
+	s.groupMessages = append(s.groupMessages, &stored)
+	return nil
+}
+
+func (s *MemoryStore) GetGroupMessages(groupId string) ([]*GroupMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := make([]*GroupMessage, 0)
+	for _, stored := range s.groupMessages {
+		if stored.GroupId == groupId {
+			message := *stored
+			messages = append(messages, &message)
+		}
+	}
+	return messages, nil
+}
+
+func copyChat(c *Chat) *Chat {
+	chat := *c
+	chat.OtherUserRsaPublic = bytes.Clone(c.OtherUserRsaPublic)
+	chat.OtherUserEcdsaPublic = bytes.Clone(c.OtherUserEcdsaPublic)
+	chat.MyRsaPrivate = bytes.Clone(c.MyRsaPrivate)
+	chat.Preview = nil
+	chat.Messages = nil
+	return &chat
+}
+
+func copyMessage(m *Message) *Message {
+	message := *m
+	message.Reactions = nil
+	return &message
+}
+
+type constraintError string
+
+func (e constraintError) Error() string {
+	return "constraint failed: " + string(e)
+}
+
+func errConstraint(columns string) error {
+	return constraintError(columns)
+}
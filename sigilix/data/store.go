@@ -0,0 +1,96 @@
+package data
+
+import "errors"
+
+// The client works against Store, so that it can run on the encrypted SQLite database
+// (SqliteDB) or on memory (MemoryStore). Getters return copies: changes are only persisted by
+// the Save/Update methods.
+//
+// Lookups of single rows return nil without an error when the row does not exist, except
+// GetChat, which returns ErrChatNotFound.
+
+var ErrChatNotFound = errors.New("chat not found")
+
+type ChatStore interface {
+	SaveChat(c *Chat) error
+	UpdateChat(c *Chat) error
+	// DeleteChat deletes the chat with its messages, reactions and attachments.
+	DeleteChat(chatId uint64) error
+	GetChat(chatId uint64) (*Chat, error)
+	GetAllChats() ([]*Chat, error)
+	GetChatsSortedByActivity() ([]*Chat, error)
+	GetAcceptedChatWithUser(userId uint64) (*Chat, error)
+	DeleteMirroredChats(primaryUserId uint64) error
+}
+
+type MessageStore interface {
+	// SaveMessage, like SaveAttachment, moves the chat's LastMessageId and LastActivityAt.
+	SaveMessage(m *Message) error
+	UpdateMessage(m *Message) error
+	DeleteMessage(chatId uint64, messageId uint64) error
+	GetMessage(chatId uint64, messageId uint64) (*Message, error)
+	GetMessages(chatId uint64) ([]*Message, error)
+	SetReaction(chatId uint64, messageId uint64, userId uint64, reaction string) error
+	GetUnreadMessageIds(chatId uint64, myUserId uint64) ([]uint64, error)
+	SetMessageStatus(chatId uint64, messageId uint64, status MessageStatus) error
+	DeleteExpiredMessages(now int64) (map[uint64][]uint64, error)
+}
+
+type AttachmentStore interface {
+	SaveAttachment(a *Attachment) error
+	GetAttachment(chatId uint64, messageId uint64) (*Attachment, error)
+	GetAttachments(chatId uint64) ([]*Attachment, error)
+}
+
+type ContactStore interface {
+	SaveContact(c *Contact) error
+	DeleteContact(userId uint64) error
+	GetContact(userId uint64) (*Contact, error)
+	GetContacts() ([]*Contact, error)
+	IsBlocked(userId uint64) (bool, error)
+}
+
+type UserInfoStore interface {
+	SaveUserInfo(u *UserInfo) error
+	GetUserInfo(userId uint64) (*UserInfo, error)
+}
+
+type GroupStore interface {
+	SaveGroup(g *Group) error
+	DeleteGroup(groupId string) error
+	SaveGroupMember(m *GroupMember) error
+	DeleteGroupMember(groupId string, userId uint64) error
+	GetGroup(groupId string) (*Group, error)
+	GetGroups() ([]*Group, error)
+	SaveGroupMessage(m *GroupMessage) error
+	GetGroupMessages(groupId string) ([]*GroupMessage, error)
+}
+
+type DeviceStore interface {
+	SaveLinkedDevice(d *LinkedDevice) error
+	DeleteLinkedDevice(deviceUserId uint64) error
+	GetLinkedDevice(deviceUserId uint64) (*LinkedDevice, error)
+	GetLinkedDevices() ([]*LinkedDevice, error)
+}
+
+// Tx is what WithTx hands to its function: every store operation, applied together or not at all.
+type Tx interface {
+	ChatStore
+	MessageStore
+	AttachmentStore
+	ContactStore
+	UserInfoStore
+	GroupStore
+	DeviceStore
+}
+
+type Store interface {
+	Tx
+	// WithTx runs fn in a transaction that is committed if fn returns nil and rolled back
+	// otherwise. fn must only use tx: other calls on the store wait for the transaction or, on
+	// SQLite, fail once the busy timeout expires.
+	WithTx(fn func(tx Tx) error) error
+	Close() error
+}
+
+var _ Store = (*SqliteDB)(nil)
@@ -0,0 +1,272 @@
+package data
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// stores returns an empty store of every implementation, the tests run against each of them.
+func stores(t *testing.T) map[string]Store {
+	t.Helper()
+	db, err := NewSqliteDBWithPassword(filepath.Join(t.TempDir(), "test.db"), "00112233445566778899aabbccddeeff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return map[string]Store{"sqlite": db, "memory": NewMemoryStore()}
+}
+
+func saveTestChat(t *testing.T, s Store, chatId uint64) {
+	t.Helper()
+	if err := s.SaveChat(&Chat{ChatId: chatId, OtherUserId: 100 + chatId, State: ChatAccepted, Accepted: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteExpiredMessagesRemovesAttachments(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			saveTestChat(t, s, 1)
+			if err := s.SaveMessage(&Message{ChatId: 1, MessageId: 1, SenderId: 101, Content: "gone", ExpiresAt: 10}); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SaveMessage(&Message{ChatId: 1, MessageId: 2, SenderId: 101, Content: "kept"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SaveAttachment(&Attachment{ChatId: 1, MessageId: 3, SenderId: 101, Content: []byte("gone"), ExpiresAt: 10}); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SaveAttachment(&Attachment{ChatId: 1, MessageId: 4, SenderId: 101, Content: []byte("kept")}); err != nil {
+				t.Fatal(err)
+			}
+
+			expired, err := s.DeleteExpiredMessages(20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := expired[1]; len(ids) != 2 || ids[0]+ids[1] != 4 {
+				t.Fatalf("expired %v, want messages 1 and 3", expired)
+			}
+			if a, _ := s.GetAttachment(1, 3); a != nil {
+				t.Fatal("expired attachment is still stored")
+			}
+			if a, _ := s.GetAttachment(1, 4); a == nil {
+				t.Fatal("attachment without expiry was deleted")
+			}
+			if messages, _ := s.GetMessages(1); len(messages) != 1 || messages[0].MessageId != 2 {
+				t.Fatalf("messages %v, want only message 2", messages)
+			}
+		})
+	}
+}
+
+func TestChats(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, err := s.GetChat(1); !errors.Is(err, ErrChatNotFound) {
+				t.Fatalf("missing chat: got %v, want ErrChatNotFound", err)
+			}
+			if chat, err := s.GetAcceptedChatWithUser(101); err != nil || chat != nil {
+				t.Fatalf("accepted chat with nobody: got %v, %v", chat, err)
+			}
+			saveTestChat(t, s, 1)
+			if err := s.SaveChat(&Chat{ChatId: 1, OtherUserId: 101}); err == nil {
+				t.Fatal("saved chat 1 twice")
+			}
+			if err := s.SaveChat(&Chat{ChatId: 2, OtherUserId: 101, State: ChatPending}); err != nil {
+				t.Fatal(err)
+			}
+
+			chat, err := s.GetChat(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chat.Title = "renamed"
+			if stored, _ := s.GetChat(1); stored.Title == "renamed" {
+				t.Fatal("changing a returned chat changed the store")
+			}
+			if err = s.UpdateChat(chat); err != nil {
+				t.Fatal(err)
+			}
+			if stored, _ := s.GetChat(1); stored.Title != "renamed" {
+				t.Fatalf("title is %q after the update", stored.Title)
+			}
+			if accepted, err := s.GetAcceptedChatWithUser(101); err != nil || accepted == nil || accepted.ChatId != 1 {
+				t.Fatalf("accepted chat with 101: got %v, %v, want chat 1", accepted, err)
+			}
+			if chats, err := s.GetAllChats(); err != nil || len(chats) != 2 {
+				t.Fatalf("got %d chats (%v), want 2", len(chats), err)
+			}
+
+			if err = s.SaveMessage(&Message{ChatId: 1, MessageId: 7, SenderId: 101, Content: "hi"}); err != nil {
+				t.Fatal(err)
+			}
+			if err = s.SaveAttachment(&Attachment{ChatId: 1, MessageId: 8, SenderId: 101, Content: []byte("file")}); err != nil {
+				t.Fatal(err)
+			}
+			if err = s.SetReaction(1, 7, 101, "+1"); err != nil {
+				t.Fatal(err)
+			}
+			if err = s.DeleteChat(1); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = s.GetChat(1); !errors.Is(err, ErrChatNotFound) {
+				t.Fatalf("deleted chat: got %v, want ErrChatNotFound", err)
+			}
+			if message, _ := s.GetMessage(1, 7); message != nil {
+				t.Fatal("message of a deleted chat is still stored")
+			}
+			if attachment, _ := s.GetAttachment(1, 8); attachment != nil {
+				t.Fatal("attachment of a deleted chat is still stored")
+			}
+		})
+	}
+}
+
+func TestMessages(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := s.SaveMessage(&Message{ChatId: 1, MessageId: 1, SenderId: 101}); err == nil {
+				t.Fatal("saved a message to a missing chat")
+			}
+			saveTestChat(t, s, 1)
+			for id, sender := range map[uint64]uint64{1: 101, 2: 1, 3: 101} {
+				if err := s.SaveMessage(&Message{ChatId: 1, MessageId: id, SenderId: sender, Content: "text"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.SaveMessage(&Message{ChatId: 1, MessageId: 1, SenderId: 101}); err == nil {
+				t.Fatal("saved message 1 twice")
+			}
+			if chat, _ := s.GetChat(1); chat.LastMessageId != 3 {
+				t.Fatalf("last message id is %d, want 3", chat.LastMessageId)
+			}
+			if message, err := s.GetMessage(1, 4); err != nil || message != nil {
+				t.Fatalf("missing message: got %v, %v", message, err)
+			}
+
+			message, err := s.GetMessage(1, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			message.Content, message.Edited = "edited", true
+			if err = s.UpdateMessage(message); err != nil {
+				t.Fatal(err)
+			}
+			if stored, _ := s.GetMessage(1, 1); stored.Content != "edited" || !stored.Edited {
+				t.Fatalf("message is %+v after the update", stored)
+			}
+
+			for _, reaction := range []struct {
+				userId   uint64
+				reaction string
+			}{{101, "+1"}, {1, "+1"}, {101, "heart"}, {1, ""}} {
+				if err = s.SetReaction(1, 1, reaction.userId, reaction.reaction); err != nil {
+					t.Fatal(err)
+				}
+			}
+			reactions := func() []*Reaction {
+				stored, _ := s.GetMessage(1, 1)
+				return stored.Reactions
+			}
+			if r := reactions(); len(r) != 1 || r[0].UserId != 101 || r[0].Reaction != "heart" {
+				t.Fatalf("reactions %v, want only heart from 101", r)
+			}
+
+			unread, err := s.GetUnreadMessageIds(1, 1)
+			if err != nil || len(unread) != 2 {
+				t.Fatalf("unread %v (%v), want messages 1 and 3", unread, err)
+			}
+			if err = s.SetMessageStatus(1, 3, MessageStatusRead); err != nil {
+				t.Fatal(err)
+			}
+			if unread, _ = s.GetUnreadMessageIds(1, 1); len(unread) != 1 || unread[0] != 1 {
+				t.Fatalf("unread %v, want message 1", unread)
+			}
+
+			if err = s.DeleteMessage(1, 1); err != nil {
+				t.Fatal(err)
+			}
+			if messages, _ := s.GetMessages(1); len(messages) != 2 {
+				t.Fatalf("%d messages left, want 2", len(messages))
+			}
+			// the reactions went with the message
+			if err = s.SaveMessage(&Message{ChatId: 1, MessageId: 1, SenderId: 101}); err != nil {
+				t.Fatal(err)
+			}
+			if r := reactions(); len(r) != 0 {
+				t.Fatalf("reactions %v survived the deleted message", r)
+			}
+		})
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			saveTestChat(t, s, 1)
+			rollback := errors.New("rollback")
+			err := s.WithTx(func(tx Tx) error {
+				if err := tx.SaveMessage(&Message{ChatId: 1, MessageId: 1, SenderId: 101}); err != nil {
+					return err
+				}
+				if message, _ := tx.GetMessage(1, 1); message == nil {
+					t.Error("the transaction does not see its own message")
+				}
+				if err := tx.SaveContact(&Contact{UserId: 101, Blocked: true}); err != nil {
+					return err
+				}
+				return rollback
+			})
+			if err != rollback {
+				t.Fatalf("got %v, want the error of fn", err)
+			}
+			if message, _ := s.GetMessage(1, 1); message != nil {
+				t.Fatal("message of a rolled back transaction is stored")
+			}
+			if blocked, _ := s.IsBlocked(101); blocked {
+				t.Fatal("contact of a rolled back transaction is stored")
+			}
+
+			err = s.WithTx(func(tx Tx) error {
+				if err := tx.SaveMessage(&Message{ChatId: 1, MessageId: 2, SenderId: 101}); err != nil {
+					return err
+				}
+				return tx.SaveContact(&Contact{UserId: 101, Blocked: true})
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if message, _ := s.GetMessage(1, 2); message == nil {
+				t.Fatal("message of a committed transaction is missing")
+			}
+			if blocked, _ := s.IsBlocked(101); !blocked {
+				t.Fatal("contact of a committed transaction is missing")
+			}
+		})
+	}
+}
+
+func TestGroupMemberSkippedKeys(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := s.SaveGroup(&Group{GroupId: "group", OwnerId: 1, MyChainKey: []byte{1}}); err != nil {
+				t.Fatal(err)
+			}
+			member := &GroupMember{GroupId: "group", UserId: 2, ChainKey: []byte{2}, Iteration: 5, SkippedKeys: map[uint32][]byte{3: {3}}}
+			if err := s.SaveGroupMember(member); err != nil {
+				t.Fatal(err)
+			}
+			group, err := s.GetGroup("group")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := group.Member(2)
+			if got == nil || len(got.SkippedKeys) != 1 || !bytes.Equal(got.SkippedKeys[3], []byte{3}) {
+				t.Fatalf("got member %+v, want the skipped key of iteration 3", got)
+			}
+		})
+	}
+}
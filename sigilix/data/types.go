@@ -15,20 +15,57 @@ import (
 	"os"
 )
 
+// ChatState is the handshake state of a chat, see messenger_client/handshake.go for the transitions.
+type ChatState string
+
+const (
+	// ChatRequested is a chat we initiated that the other user did not accept yet.
+	ChatRequested ChatState = "requested"
+	// ChatPending is an incoming chat request we did not accept yet.
+	ChatPending    ChatState = "pending"
+	ChatAccepted   ChatState = "accepted"
+	ChatKeyRotated ChatState = "key_rotated"
+	ChatClosed     ChatState = "closed"
+)
+
 type Chat struct {
-	ChatId               uint64 `json:"chat_id"`
-	OtherUserId          uint64 `json:"other_user_id"`
-	LastMessageId        uint64 `json:"last_message_id"`
-	AmIInitiator         bool   `json:"am_i_initiator"`
-	Accepted             bool   `json:"accepted"`
+	ChatId        uint64 `json:"chat_id"`
+	OtherUserId   uint64 `json:"other_user_id"`
+	LastMessageId uint64 `json:"last_message_id"`
+	// LastActivityAt is the unix time of the last stored message, or of the creation of the chat.
+	LastActivityAt       int64 `json:"last_activity_at"`
+	AmIInitiator         bool  `json:"am_i_initiator"`
+	Accepted             bool  `json:"accepted"`
 	OtherUserRsaPublic   []byte
 	OtherUserEcdsaPublic []byte
-	MyRsaPrivate         []byte
-	Title                string `json:"title"`
+	// MyRsaPrivate is only set on rows from before the keys were kept in a crypto_utils.Keyring, the
+	// client moves it to Config.ChatRsaPrivateKeys at unlock and blanks it.
+	MyRsaPrivate []byte `json:"-"`
+	Title        string `json:"title"`
+	// MessageTtl is the disappearing messages timer in seconds, 0 keeps messages forever.
+	MessageTtl uint64 `json:"message_ttl"`
+	// State is the handshake state, Accepted is kept in sync with it.
+	State ChatState `json:"state"`
+	// MirroredFrom is set on a linked device for chats of the primary device, messages are sent
+	// through the primary.
+	MirroredFrom uint64 `json:"mirrored_from"`
+	// OtherUsername comes from the user info cache, it is not stored with the chat.
+	OtherUsername string `json:"other_username"`
+	// Preview is only set in chat lists, see MessengerClient.GetChats.
+	Preview *MessagePreview `json:"preview,omitempty"`
 
 	Messages []*Message `json:"messages"`
+}
 
-	db *SqliteDB
+// MessagePreview is the last message of a chat as shown in the chat list.
+type MessagePreview struct {
+	MessageId uint64 `json:"message_id"`
+	SenderId  uint64 `json:"sender_id"`
+	// Text is shortened, empty for deleted messages and files.
+	Text    string `json:"text"`
+	Deleted bool   `json:"deleted"`
+	// MimeType is set when the last message is a file.
+	MimeType string `json:"mime_type,omitempty"`
 }
 
 func (c *Chat) OtherUserRsaPublicKey() (*rsa.PublicKey, error) {
@@ -39,29 +76,33 @@ func (c *Chat) OtherUserEcdsaPublicKey() (*ecdsa.PublicKey, error) {
 	return crypto_utils.PublicECDSAKeyFromBytes(c.OtherUserEcdsaPublic)
 }
 
-func (c *Chat) MyRsaPrivateKey() (*rsa.PrivateKey, error) {
-	return crypto_utils.RsaPrivateFromBytes(c.MyRsaPrivate)
+type Reaction struct {
+	UserId   uint64 `json:"user_id"`
+	Reaction string `json:"reaction"`
 }
 
-func (c *Chat) Save() error {
-	_, err := c.db.Exec(
-		"INSERT INTO chats (chat_id, other_user_id, last_message_id, am_i_initiator, accepted, other_user_rsa_public, other_user_ecdsa_public, my_rsa_private, title) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
-		c.ChatId, c.OtherUserId, c.LastMessageId, c.AmIInitiator, c.Accepted, c.OtherUserRsaPublic, c.OtherUserEcdsaPublic, c.MyRsaPrivate, c.Title,
-	)
-	return err
-}
+type MessageStatus string
 
-func (c *Chat) Update() error {
-	_, err := c.db.Exec(
-		"UPDATE chats SET other_user_id = ?, last_message_id = ?, am_i_initiator = ?, accepted = ?, other_user_rsa_public = ?, other_user_ecdsa_public = ?, my_rsa_private = ?, title = ? WHERE chat_id = ?",
-		c.OtherUserId, c.LastMessageId, c.AmIInitiator, c.Accepted, c.OtherUserRsaPublic, c.OtherUserEcdsaPublic, c.MyRsaPrivate, c.Title, c.ChatId,
-	)
-	return err
-}
+const (
+	// MessageStatusSent, Delivered and Read describe our own messages, as reported by receipts.
+	MessageStatusSent      MessageStatus = "sent"
+	MessageStatusDelivered MessageStatus = "delivered"
+	MessageStatusRead      MessageStatus = "read"
+	// MessageStatusReceived is an incoming message that was not marked as read yet.
+	MessageStatusReceived MessageStatus = "received"
+)
 
-func (c *Chat) Delete() error {
-	_, err := c.db.Exec("DELETE FROM chats WHERE chat_id = ?", c.ChatId)
-	return err
+// Rank orders statuses of outgoing messages, receipts may only move a status forward.
+func (s MessageStatus) Rank() int {
+	switch s {
+	case MessageStatusSent:
+		return 1
+	case MessageStatusDelivered:
+		return 2
+	case MessageStatusRead:
+		return 3
+	}
+	return 0
 }
 
 type Message struct {
@@ -69,30 +110,14 @@ type Message struct {
 	ChatId    uint64 `json:"chat_id"`
 	SenderId  uint64 `json:"sender_id"`
 	Content   string `json:"content"`
-
-	db *SqliteDB
-}
-
-func (m *Message) Save() error {
-	_, err := m.db.Exec(
-		"INSERT INTO messages (message_id, chat_id, sender_id, content) VALUES (?, ?, ?, ?)",
-		m.MessageId, m.ChatId, m.SenderId, m.Content,
-	)
-
-	return err
-}
-
-func (m *Message) Update() error {
-	_, err := m.db.Exec(
-		"UPDATE messages SET chat_id = ?, sender_id = ?, content = ? WHERE message_id = ?",
-		m.ChatId, m.SenderId, m.Content, m.MessageId,
-	)
-	return err
-}
-
-func (m *Message) Delete() error {
-	_, err := m.db.Exec("DELETE FROM messages WHERE message_id = ?", m.MessageId)
-	return err
+	ReplyTo   uint64 `json:"reply_to"`
+	Edited    bool   `json:"edited"`
+	// Deleted messages are kept as tombstones with empty content, so that replies still resolve.
+	Deleted   bool          `json:"deleted"`
+	Status    MessageStatus `json:"status"`
+	Reactions []*Reaction   `json:"reactions"`
+	// ExpiresAt is the unix time the message disappears at, 0 if it never does.
+	ExpiresAt int64 `json:"expires_at"`
 }
 
 type Config struct {
@@ -101,7 +126,31 @@ type Config struct {
 	SearchByUsername       bool                     `json:"search_by_username"`
 	InitialRsaRivateKey    custom_types.Base64Bytes `json:"initial_rsa_rivate_key"`
 	InitialECDSAPrivateKey custom_types.Base64Bytes `json:"initial_ecdsa_private_key"`
-	PaswordHash            custom_types.Base64Bytes `json:"pasword_hash"`
+	// ChatRsaPrivateKeys are the keys of chats from before the keyring that do not use the identity
+	// key, by chat id. They were kept in Chat.MyRsaPrivate.
+	ChatRsaPrivateKeys  map[uint64]custom_types.Base64Bytes `json:"chat_rsa_private_keys,omitempty"`
+	PaswordHash         custom_types.Base64Bytes            `json:"pasword_hash"`
+	DisableReadReceipts bool                                `json:"disable_read_receipts"`
+	ChatRequestPolicy   ChatRequestPolicy                   `json:"chat_request_policy"`
+	// AutoLockMinutes locks the client after that many idle minutes, 0 never does.
+	AutoLockMinutes int `json:"auto_lock_minutes"`
+	// UserIdVersion is the derivation of UserId, 0 for configs written before it was recorded
+	// (always crypto_utils.UserIdLegacy).
+	UserIdVersion crypto_utils.UserIdVersion `json:"user_id_version"`
+	// PrimaryUserId and DeviceCertificate are set when this identity is linked to a primary device.
+	PrimaryUserId     uint64                   `json:"primary_user_id,omitempty"`
+	DeviceCertificate custom_types.Base64Bytes `json:"device_certificate,omitempty"`
+}
+
+// ChatRequestPolicy decides what happens to incoming chat requests, the zero value keeps every
+// request pending.
+type ChatRequestPolicy struct {
+	// OnlyContacts drops requests from users that are not in the contact book.
+	OnlyContacts bool `json:"only_contacts"`
+	// AutoAcceptVerified accepts requests from verified contacts whose keys did not change.
+	AutoAcceptVerified bool `json:"auto_accept_verified"`
+	// MaxRequestsPerSender limits requests from one user per day, 0 means no limit.
+	MaxRequestsPerSender int `json:"max_requests_per_sender"`
 }
 
 func EncryptDataWithBytes(data []byte, password []byte) ([]byte, error) {
@@ -167,6 +216,7 @@ func LoadConfigFromFiles(filename string, password []byte) (*Config, error) {
 	var config *Config
 
 	err = json.Unmarshal(decryptedBytes, &config)
+	crypto_utils.Wipe(decryptedBytes)
 
 	if err != nil {
 		return nil, err
@@ -181,6 +231,7 @@ func (c *Config) SaveToFile(filename string) error {
 		return err
 	}
 	encryptedBytes, err := EncryptDataWithBytes(jsonBytes, c.PaswordHash)
+	crypto_utils.Wipe(jsonBytes)
 	if err != nil {
 		return err
 	}
@@ -190,51 +241,3 @@ func (c *Config) SaveToFile(filename string) error {
 	}
 	return nil
 }
-
-func (c *Config) RsaPrivateKey() (*rsa.PrivateKey, error) {
-	return crypto_utils.RsaPrivateFromBytes(c.InitialRsaRivateKey)
-}
-
-func (c *Config) EcdsaPrivateKey() (*ecdsa.PrivateKey, error) {
-	return crypto_utils.PrivateKeyFromBytes(c.InitialECDSAPrivateKey)
-}
-
-func (c *Config) MustRsaPrivateKey() *rsa.PrivateKey {
-	key, err := c.RsaPrivateKey()
-	if err != nil {
-		panic(err)
-	}
-	return key
-}
-
-func (c *Config) MustEcdsaPrivateKey() *ecdsa.PrivateKey {
-	key, err := c.EcdsaPrivateKey()
-	if err != nil {
-		panic(err)
-	}
-	return key
-}
-
-func (c *Config) RsaPublicKey() (*rsa.PublicKey, error) {
-	k, err := c.RsaPrivateKey()
-	if err != nil {
-		return nil, err
-	}
-	return k.Public().(*rsa.PublicKey), nil
-}
-
-func (c *Config) EcdsaPublicKey() (*ecdsa.PublicKey, error) {
-	k, err := c.EcdsaPrivateKey()
-	if err != nil {
-		return nil, err
-	}
-	return k.Public().(*ecdsa.PublicKey), nil
-}
-
-func (c *Config) MustRsaPublicKey() *rsa.PublicKey {
-	return c.MustRsaPrivateKey().Public().(*rsa.PublicKey)
-}
-
-func (c *Config) MustEcdsaPublicKey() *ecdsa.PublicKey {
-	return c.MustEcdsaPrivateKey().Public().(*ecdsa.PublicKey)
-}
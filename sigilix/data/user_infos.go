@@ -0,0 +1,36 @@
+package data
+
+import "database/sql"
+
+// UserInfo is the cached public info of another user, as last seen from the server.
+type UserInfo struct {
+	UserId      uint64 `json:"user_id"`
+	Username    string `json:"username"`
+	EcdsaPublic []byte `json:"ecdsa_public_key"`
+	RsaPublic   []byte `json:"rsa_public_key"`
+	// UpdatedAt is the unix time the info was last received from the server.
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func (s *SqliteDB) SaveUserInfo(u *UserInfo) error {
+	return s.execUpsert(
+		"UPDATE user_infos SET username = ?, ecdsa_public = ?, rsa_public = ?, updated_at = ? WHERE user_id = ?",
+		[]interface{}{u.Username, u.EcdsaPublic, u.RsaPublic, u.UpdatedAt, u.UserId},
+		"INSERT INTO user_infos (user_id, username, ecdsa_public, rsa_public, updated_at) VALUES (?, ?, ?, ?, ?)",
+		[]interface{}{u.UserId, u.Username, u.EcdsaPublic, u.RsaPublic, u.UpdatedAt},
+	)
+}
+
+// GetUserInfo returns nil if nothing is cached for userId.
+func (s *SqliteDB) GetUserInfo(userId uint64) (*UserInfo, error) {
+	info := &UserInfo{}
+	err := s.QueryRow("SELECT user_id, username, ecdsa_public, rsa_public, updated_at FROM user_infos WHERE user_id = ?", userId).
+		Scan(&info.UserId, &info.Username, &info.EcdsaPublic, &info.RsaPublic, &info.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
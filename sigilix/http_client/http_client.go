@@ -14,18 +14,18 @@ import (
 )
 
 type SigilixHttpClient struct {
-	httpClient   *http.Client
-	baseUrl      string
-	ecdsaPrivate *ecdsa.PrivateKey
-	userId       uint64
+	httpClient *http.Client
+	baseUrl    string
+	signer     crypto_utils.Signer
+	userId     uint64
 }
 
-func NewSigilixHttpClient(baseUrl string, ecdsaPrivate *ecdsa.PrivateKey, userId uint64) *SigilixHttpClient {
+func NewSigilixHttpClient(baseUrl string, signer crypto_utils.Signer, userId uint64) *SigilixHttpClient {
 	return &SigilixHttpClient{
-		httpClient:   &http.Client{},
-		baseUrl:      baseUrl,
-		ecdsaPrivate: ecdsaPrivate,
-		userId:       userId,
+		httpClient: &http.Client{},
+		baseUrl:    baseUrl,
+		signer:     signer,
+		userId:     userId,
 	}
 }
 
@@ -47,7 +47,7 @@ func (c *SigilixHttpClient) makeRequest(url string, body custom_types.SigilixStr
 		return err
 	}
 
-	signature, err := crypto_utils.SignMessageBase64(c.ecdsaPrivate, encoded)
+	signature, err := c.signer.Sign(encoded)
 	if err != nil {
 		return err
 	}
@@ -57,7 +57,7 @@ func (c *SigilixHttpClient) makeRequest(url string, body custom_types.SigilixStr
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Sigilix-Signature", signature)
+	req.Header.Set("X-Sigilix-Signature", crypto_utils.BytesToBase64(signature))
 	req.Header.Set("X-Sigilix-User-Id", fmt.Sprintf("%d", c.userId))
 
 	resp, err := c.httpClient.Do(req)
@@ -96,14 +96,10 @@ func (c *SigilixHttpClient) makeRequest(url string, body custom_types.SigilixStr
 }
 
 func (c *SigilixHttpClient) Login(ecdsaPublicKey *ecdsa.PublicKey, rsaPublicKey *rsa.PublicKey) (*custom_types.LoginResponse, error) {
-	rsaBytes, err := crypto_utils.PublicRSAKeyToBytes(rsaPublicKey)
+	req, err := NewLoginRequest(ecdsaPublicKey, rsaPublicKey)
 	if err != nil {
 		return nil, err
 	}
-	req := &custom_types.LoginRequest{
-		ClientEcdaPublicKey: crypto_utils.PublicECDSAKeyToBytes(ecdsaPublicKey),
-		ClientRsaPublicKey:  rsaBytes,
-	}
 
 	resp := &custom_types.LoginResponse{}
 
@@ -186,14 +182,10 @@ func (c *SigilixHttpClient) InitChatFromReceiver(chatId uint64) (*custom_types.I
 }
 
 func (c *SigilixHttpClient) UpdateChatRsaKey(chatId uint64, rsaPublicKey *rsa.PublicKey) (*custom_types.UpdateChatRsaKeyResponse, error) {
-	rsaBytes, err := crypto_utils.PublicRSAKeyToBytes(rsaPublicKey)
+	req, err := NewUpdateChatRsaKeyRequest(chatId, rsaPublicKey)
 	if err != nil {
 		return nil, err
 	}
-	req := &custom_types.UpdateChatRsaKeyRequest{
-		ChatId:       chatId,
-		RsaPublicKey: rsaBytes,
-	}
 
 	resp := &custom_types.UpdateChatRsaKeyResponse{}
 
@@ -207,26 +199,31 @@ func (c *SigilixHttpClient) UpdateChatRsaKey(chatId uint64, rsaPublicKey *rsa.Pu
 }
 
 func (c *SigilixHttpClient) SendMessage(chatId uint64, message string, rsaPublicKey *rsa.PublicKey) (*custom_types.SendMessageResponse, error) {
-
-	messageBytes := []byte(message)
-	ecdsaSignature, err := crypto_utils.SignMessage(c.ecdsaPrivate, messageBytes)
+	req, err := NewSendMessageRequest(c.signer, chatId, message, rsaPublicKey)
 	if err != nil {
 		return nil, err
 	}
-	rsaEncryptedMessage, err := crypto_utils.EncryptMessage(rsaPublicKey, messageBytes)
+
+	resp := &custom_types.SendMessageResponse{}
+
+	err = c.makeRequest("messages/send_message", req, resp)
+
 	if err != nil {
 		return nil, err
 	}
 
-	req := &custom_types.SendMessageRequest{
-		ChatId:                chatId,
-		EncryptedMessage:      rsaEncryptedMessage,
-		MessageEcdsaSignature: ecdsaSignature,
+	return resp, nil
+}
+
+func (c *SigilixHttpClient) SendFile(chatId uint64, file []byte, mimeType string, rsaPublicKey *rsa.PublicKey) (*custom_types.SendFileResponse, error) {
+	req, err := NewSendFileRequest(c.signer, chatId, file, mimeType, rsaPublicKey)
+	if err != nil {
+		return nil, err
 	}
 
-	resp := &custom_types.SendMessageResponse{}
+	resp := &custom_types.SendFileResponse{}
 
-	err = c.makeRequest("messages/send_message", req, resp)
+	err = c.makeRequest("messages/send_file", req, resp)
 
 	if err != nil {
 		return nil, err
@@ -250,3 +247,35 @@ func (c *SigilixHttpClient) FetchNotifications(limit uint32) ([]*custom_types.In
 
 	return resp.Notifications, nil
 }
+
+func (c *SigilixHttpClient) DeleteAccount(farewells []*custom_types.SendMessageRequest) (*custom_types.DeleteAccountResponse, error) {
+	req := &custom_types.DeleteAccountRequest{
+		Farewells: farewells,
+	}
+
+	resp := &custom_types.DeleteAccountResponse{}
+
+	err := c.makeRequest("users/delete_account", req, resp)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (c *SigilixHttpClient) CloseChat(chatId uint64) (*custom_types.CloseChatResponse, error) {
+	req := &custom_types.CloseChatRequest{
+		ChatId: chatId,
+	}
+
+	resp := &custom_types.CloseChatResponse{}
+
+	err := c.makeRequest("messages/close_chat", req, resp)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
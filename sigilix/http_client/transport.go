@@ -0,0 +1,101 @@
+package http_client
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/crypto_utils"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/custom_types"
+)
+
+// Transport is the server API as the messenger client uses it. SigilixHttpClient talks to a server
+// over HTTP, mock_server.Loopback calls an in-process mock server directly.
+type Transport interface {
+	Login(ecdsaPublicKey *ecdsa.PublicKey, rsaPublicKey *rsa.PublicKey) (*custom_types.LoginResponse, error)
+	SetUsernameConfig(setUsername string, searchable bool) (*custom_types.SetUsernameConfigResponse, error)
+	// SearchByUsername returns nil when no searchable user has the username.
+	SearchByUsername(searchUsername string) (*custom_types.SearchByUsernameResponse, error)
+	InitChatFromInitializer(userId uint64) (*custom_types.InitChatFromInitializerResponse, error)
+	InitChatFromReceiver(chatId uint64) (*custom_types.InitChatFromReceiverResponse, error)
+	UpdateChatRsaKey(chatId uint64, rsaPublicKey *rsa.PublicKey) (*custom_types.UpdateChatRsaKeyResponse, error)
+	SendMessage(chatId uint64, message string, rsaPublicKey *rsa.PublicKey) (*custom_types.SendMessageResponse, error)
+	SendFile(chatId uint64, file []byte, mimeType string, rsaPublicKey *rsa.PublicKey) (*custom_types.SendFileResponse, error)
+	FetchNotifications(limit uint32) ([]*custom_types.IncomingNotification, error)
+	DeleteAccount(farewells []*custom_types.SendMessageRequest) (*custom_types.DeleteAccountResponse, error)
+	CloseChat(chatId uint64) (*custom_types.CloseChatResponse, error)
+}
+
+// TransportFactory creates the transport of an identity once it is unlocked.
+type TransportFactory func(signer crypto_utils.Signer, userId uint64) Transport
+
+var _ Transport = (*SigilixHttpClient)(nil)
+
+// HttpTransport returns a TransportFactory for the server at baseUrl.
+func HttpTransport(baseUrl string) TransportFactory {
+	return func(signer crypto_utils.Signer, userId uint64) Transport {
+		return NewSigilixHttpClient(baseUrl, signer, userId)
+	}
+}
+
+// The requests that are signed or encrypted on the client are built here, so that every transport
+// sends the same bytes.
+
+func NewLoginRequest(ecdsaPublicKey *ecdsa.PublicKey, rsaPublicKey *rsa.PublicKey) (*custom_types.LoginRequest, error) {
+	rsaBytes, err := crypto_utils.PublicRSAKeyToBytes(rsaPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &custom_types.LoginRequest{
+		ClientEcdaPublicKey: crypto_utils.PublicECDSAKeyToBytes(ecdsaPublicKey),
+		ClientRsaPublicKey:  rsaBytes,
+	}, nil
+}
+
+func NewUpdateChatRsaKeyRequest(chatId uint64, rsaPublicKey *rsa.PublicKey) (*custom_types.UpdateChatRsaKeyRequest, error) {
+	rsaBytes, err := crypto_utils.PublicRSAKeyToBytes(rsaPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &custom_types.UpdateChatRsaKeyRequest{
+		ChatId:       chatId,
+		RsaPublicKey: rsaBytes,
+	}, nil
+}
+
+func NewSendMessageRequest(signer crypto_utils.Signer, chatId uint64, message string, rsaPublicKey *rsa.PublicKey) (*custom_types.SendMessageRequest, error) {
+	messageBytes := []byte(message)
+	ecdsaSignature, err := signer.Sign(messageBytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaEncryptedMessage, err := crypto_utils.EncryptMessage(rsaPublicKey, messageBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &custom_types.SendMessageRequest{
+		ChatId:                chatId,
+		EncryptedMessage:      rsaEncryptedMessage,
+		MessageEcdsaSignature: ecdsaSignature,
+	}, nil
+}
+
+func NewSendFileRequest(signer crypto_utils.Signer, chatId uint64, file []byte, mimeType string, rsaPublicKey *rsa.PublicKey) (*custom_types.SendFileRequest, error) {
+	ecdsaSignature, err := signer.Sign(file)
+	if err != nil {
+		return nil, err
+	}
+	rsaEncryptedFile, err := crypto_utils.EncryptMessage(rsaPublicKey, file)
+	if err != nil {
+		return nil, err
+	}
+	rsaEncryptedMimeType, err := crypto_utils.EncryptMessage(rsaPublicKey, []byte(mimeType))
+	if err != nil {
+		return nil, err
+	}
+	return &custom_types.SendFileRequest{
+		ChatId:             chatId,
+		EncryptedFile:      rsaEncryptedFile,
+		EncryptedMimeType:  rsaEncryptedMimeType,
+		FileEcdsaSignature: ecdsaSignature,
+	}, nil
+}
@@ -0,0 +1,203 @@
+package local_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+)
+
+type ApiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ApiError) Error() string {
+	return e.Message
+}
+
+func newApiError(code int, message string) *ApiError {
+	return &ApiError{Code: code, Message: message}
+}
+
+var errMethodNotAllowed = newApiError(http.StatusMethodNotAllowed, "method not allowed")
+
+type SendRequest struct {
+	ChatId  uint64 `json:"chat_id"`
+	Text    string `json:"text"`
+	ReplyTo uint64 `json:"reply_to,omitempty"`
+}
+
+// Chat is the part of data.Chat a script needs, without the public keys and the messages.
+type Chat struct {
+	ChatId        uint64 `json:"chat_id"`
+	OtherUserId   uint64 `json:"other_user_id"`
+	OtherUsername string `json:"other_username"`
+	Title         string `json:"title"`
+	State         string `json:"state"`
+	MessageTtl    uint64 `json:"message_ttl"`
+	// LastActivityAt is the unix time of the last message, chats are sorted by it.
+	LastActivityAt int64                `json:"last_activity_at"`
+	Preview        *data.MessagePreview `json:"preview,omitempty"`
+}
+
+type MeResponse struct {
+	UserId   uint64 `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// routes:
+//
+//	GET  /v1/me                        the account
+//	GET  /v1/chats                     chats, as returned by GetChats
+//	GET  /v1/messages?chat_id=<id>     messages of a chat
+//	POST /v1/send                      SendRequest, returns the sent message
+//	GET  /v1/events                    server-sent events, one per notification, named by its type
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/me", s.handle(http.MethodGet, s.me))
+	mux.HandleFunc("/v1/chats", s.handle(http.MethodGet, s.chats))
+	mux.HandleFunc("/v1/messages", s.handle(http.MethodGet, s.messages))
+	mux.HandleFunc("/v1/send", s.handle(http.MethodPost, s.send))
+	mux.HandleFunc("/v1/events", s.events)
+	return mux
+}
+
+func (s *Server) handle(method string, handler func(r *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.authorize(r); err != nil {
+			writeError(w, err)
+			return
+		}
+		if r.Method != method {
+			writeError(w, errMethodNotAllowed)
+			return
+		}
+		resp, err := handler(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func (s *Server) me(_ *http.Request) (interface{}, error) {
+	return &MeResponse{UserId: s.client.GetUserId(), Username: s.client.GetUsername()}, nil
+}
+
+func (s *Server) chats(_ *http.Request) (interface{}, error) {
+	chats, err := s.client.GetChats()
+	if err != nil {
+		return nil, err
+	}
+	resp := make([]*Chat, 0, len(chats))
+	for _, chat := range chats {
+		resp = append(resp, &Chat{
+			ChatId:         chat.ChatId,
+			OtherUserId:    chat.OtherUserId,
+			OtherUsername:  chat.OtherUsername,
+			Title:          chat.Title,
+			State:          string(chat.State),
+			MessageTtl:     chat.MessageTtl,
+			LastActivityAt: chat.LastActivityAt,
+			Preview:        chat.Preview,
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) messages(r *http.Request) (interface{}, error) {
+	chatId, err := strconv.ParseUint(r.URL.Query().Get("chat_id"), 10, 64)
+	if err != nil {
+		return nil, newApiError(http.StatusBadRequest, "invalid chat_id")
+	}
+	messages, err := s.client.GetChatMessages(chatId)
+	if err != nil {
+		return nil, newApiError(http.StatusBadRequest, err.Error())
+	}
+	return messages, nil
+}
+
+func (s *Server) send(r *http.Request) (interface{}, error) {
+	req := &SendRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20)).Decode(req); err != nil {
+		return nil, newApiError(http.StatusBadRequest, err.Error())
+	}
+	if req.Text == "" {
+		return nil, newApiError(http.StatusBadRequest, "empty text")
+	}
+	message, err := s.client.ReplyToMessage(req.ChatId, req.ReplyTo, req.Text)
+	if err != nil {
+		return nil, newApiError(http.StatusBadRequest, err.Error())
+	}
+	return message, nil
+}
+
+// events streams the notifications of every pull the app makes. Notifications are not replayed,
+// a consumer that needs the current state fetches it after connecting.
+func (s *Server) events(w http.ResponseWriter, r *http.Request) {
+	if err := s.authorize(r); err != nil {
+		writeError(w, err)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, errMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, newApiError(http.StatusInternalServerError, "streaming not supported"))
+		return
+	}
+	notifications, unsubscribe := s.client.Subscribe(eventsBuffer)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closed:
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case notification, ok := <-notifications:
+			if !ok {
+				return
+			}
+			encoded, err := json.Marshal(notification.Notification)
+			if err != nil {
+				continue
+			}
+			if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", notification.Type, encoded); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	apiErr, ok := err.(*ApiError)
+	if !ok && err == data.ErrChatNotFound {
+		apiErr = newApiError(http.StatusNotFound, err.Error())
+	} else if !ok {
+		apiErr = newApiError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Code)
+	_ = json.NewEncoder(w).Encode(apiErr)
+}
@@ -0,0 +1,178 @@
+package local_api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/messenger_client"
+)
+
+// The local API lets scripts and editor plugins on the same machine use a running client. It only
+// listens on loopback and every request needs the bearer token from the token file, which is
+// created with 0600 permissions when the server starts and removed when it stops, so the token is
+// only valid for one session.
+
+const (
+	DefaultAddr     = "127.0.0.1:7731"
+	eventsBuffer    = 64
+	eventsKeepAlive = 15 * time.Second
+)
+
+type Options struct {
+	// Addr is the loopback address to listen on, DefaultAddr if empty.
+	Addr string
+	// TokenPath is where the token file is written, DefaultTokenPath() if empty.
+	TokenPath string
+}
+
+// TokenFile is the content of the token file.
+type TokenFile struct {
+	Url   string `json:"url"`
+	Token string `json:"token"`
+}
+
+type Server struct {
+	client    *messenger_client.MessengerClient
+	token     string
+	tokenPath string
+	listener  net.Listener
+	http      *http.Server
+	// closed ends the event streams, Shutdown does not wait for them otherwise
+	closed chan struct{}
+}
+
+func DefaultTokenPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sigilix", "local_api.json"), nil
+}
+
+// Start listens on opts.Addr, writes the token file and serves the API in the background.
+func Start(client *messenger_client.MessengerClient, opts Options) (*Server, error) {
+	if opts.Addr == "" {
+		opts.Addr = DefaultAddr
+	}
+	if opts.TokenPath == "" {
+		path, err := DefaultTokenPath()
+		if err != nil {
+			return nil, err
+		}
+		opts.TokenPath = path
+	}
+	host, _, err := net.SplitHostPort(opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if !isLoopback(host) {
+		return nil, fmt.Errorf("%s is not a loopback address", host)
+	}
+
+	raw := make([]byte, 32)
+	if _, err = rand.Read(raw); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		client:    client,
+		token:     hex.EncodeToString(raw),
+		tokenPath: opts.TokenPath,
+		listener:  listener,
+		closed:    make(chan struct{}),
+	}
+	if err = s.writeTokenFile(); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	s.http = &http.Server{Handler: s.routes(), ReadHeaderTimeout: 10 * time.Second}
+	s.http.RegisterOnShutdown(func() { close(s.closed) })
+	go func() {
+		_ = s.http.Serve(listener)
+	}()
+	return s, nil
+}
+
+func (s *Server) Url() string {
+	return "http://" + s.listener.Addr().String() + "/v1/"
+}
+
+func (s *Server) TokenPath() string {
+	return s.tokenPath
+}
+
+// Close stops the server, ends the event streams and removes the token file.
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.http.Shutdown(ctx)
+	if removeErr := os.Remove(s.tokenPath); removeErr != nil && !os.IsNotExist(removeErr) && err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+func (s *Server) writeTokenFile() error {
+	if err := os.MkdirAll(filepath.Dir(s.tokenPath), 0700); err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(&TokenFile{Url: s.Url(), Token: s.token})
+	if err != nil {
+		return err
+	}
+	// a file left over from a crashed session may have other permissions, start from scratch
+	if err = os.Remove(s.tokenPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.OpenFile(s.tokenPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(encoded); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// authorize checks the token, and the Host header so that a web page can not reach the API
+// through DNS rebinding.
+func (s *Server) authorize(r *http.Request) error {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	if !isLoopback(host) {
+		return newApiError(http.StatusForbidden, "bad host")
+	}
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if len(header) <= len(prefix) || header[:len(prefix)] != prefix ||
+		subtle.ConstantTimeCompare([]byte(header[len(prefix):]), []byte(s.token)) != 1 {
+		return newApiError(http.StatusUnauthorized, "bad token")
+	}
+	if !s.client.IsUnlocked() {
+		return newApiError(http.StatusServiceUnavailable, "client is locked")
+	}
+	return nil
+}
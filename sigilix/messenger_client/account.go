@@ -0,0 +1,186 @@
+package messenger_client
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/crypto_utils"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/custom_types"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/http_client"
+)
+
+// Account deletion: DeleteAccount deletes the account on the server and wipes the local data. The
+// request carries an account_closed control message for every open chat, which the server only
+// delivers once the account is gone, and the peers close their chat with us. A duress password
+// set with SetDuressPassword wipes the local data when it is given to Unlock, which then fails
+// like for any wrong password; nothing is sent to the server or peers, the keys can not be
+// decrypted with it. Every account has a duress file, encrypted like config.json with the duress
+// password or with a random key if none is set, so it does not tell whether a duress password
+// exists.
+
+const duressFilename = "duress.bin"
+
+var duressMarker = []byte("sigilix duress")
+
+type AccountClosedNotification struct {
+	ChatId uint64 `json:"chat_id"`
+	UserId uint64 `json:"user_id"`
+}
+
+func (i *AccountClosedNotification) NotificationType() WebNotificationType { return AccountClosed }
+
+func (c *MessengerClient) duressPath() string {
+	return filepath.Join(c.dataDir, duressFilename)
+}
+
+// DeleteAccount deletes the account everywhere, password confirms it. The client is locked and
+// not signed up afterwards. If the server does not delete the account nothing is wiped.
+func (c *MessengerClient) DeleteAccount(password string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return errors.New("not unlocked")
+	}
+	if subtle.ConstantTimeCompare(Sha256x(100, []byte(password)), c.config.PaswordHash) != 1 {
+		return errors.New("wrong password")
+	}
+	farewells, err := c.farewells()
+	if err != nil {
+		return err
+	}
+	if _, err = c.http.DeleteAccount(farewells); err != nil {
+		return err
+	}
+	if err = c.lock(); err != nil {
+		log.Printf("error locking deleted account: %s", err.Error())
+	}
+	return c.wipeData()
+}
+
+// farewells are the account_closed messages of the open chats, see DeleteAccount.
+func (c *MessengerClient) farewells() ([]*custom_types.SendMessageRequest, error) {
+	chats, err := c.database.GetChatsSortedByActivity()
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := encodePayload(&Payload{Type: PayloadControl, Control: &controlMessage{Type: controlAccountClosed}}, c.keys)
+	if err != nil {
+		return nil, err
+	}
+	farewells := make([]*custom_types.SendMessageRequest, 0, len(chats))
+	for _, chat := range chats {
+		if !chatIsOpen(chat) || !chat.Accepted || chat.MirroredFrom != 0 {
+			continue
+		}
+		rsaPub, err := chat.OtherUserRsaPublicKey()
+		if err != nil {
+			log.Printf("error telling chat %d about the account deletion: %s", chat.ChatId, err.Error())
+			continue
+		}
+		farewell, err := http_client.NewSendMessageRequest(c.keys, chat.ChatId, encoded, rsaPub)
+		if err != nil {
+			return nil, err
+		}
+		farewells = append(farewells, farewell)
+	}
+	return farewells, nil
+}
+
+func (c *MessengerClient) handleAccountClosed(chat *data.Chat, senderId uint64) ([]WebNotification, error) {
+	if err := c.closeChatBy(chat, senderId); err != nil {
+		return nil, err
+	}
+	return []WebNotification{&AccountClosedNotification{ChatId: chat.ChatId, UserId: senderId}}, nil
+}
+
+// SetDuressPassword sets the password that wipes the local data at Unlock, an empty one removes it.
+func (c *MessengerClient) SetDuressPassword(password string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return errors.New("not unlocked")
+	}
+	if password != "" && subtle.ConstantTimeCompare(Sha256x(100, []byte(password)), c.config.PaswordHash) == 1 {
+		return errors.New("the duress password must differ from the password")
+	}
+	return c.writeDuressFile(password)
+}
+
+// writeDuressFile replaces the duress file, an empty password writes one that no password opens.
+func (c *MessengerClient) writeDuressFile(password string) error {
+	key := make([]byte, sha256.Size)
+	if password == "" {
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+	} else {
+		key = Sha256x(100, []byte(password))
+	}
+	encrypted, err := data.EncryptDataWithBytes(duressMarker, key)
+	crypto_utils.Wipe(key)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.duressPath(), encrypted, 0600)
+}
+
+func (c *MessengerClient) isDuressPassword(password string) bool {
+	encrypted, err := os.ReadFile(c.duressPath())
+	// nonce and tag of AES-GCM
+	if err != nil || len(encrypted) <= 12+16 {
+		return false
+	}
+	marker, err := data.DecryptDataWithBytes(encrypted, Sha256x(100, []byte(password)))
+	return err == nil && subtle.ConstantTimeCompare(marker, duressMarker) == 1
+}
+
+// wipeData removes config.json, the duress file and every database in the data directory.
+func (c *MessengerClient) wipeData() error {
+	databases, err := filepath.Glob(filepath.Join(c.dataDir, "sigilix_*.db*"))
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, path := range append([]string{c.configPath(), c.duressPath()}, databases...) {
+		if err = secureRemove(path); err != nil {
+			log.Printf("error wiping %s: %s", path, err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// secureRemove overwrites a file with random bytes before removing it. Journaling filesystems and
+// SSDs may keep old blocks, the databases are encrypted for that reason.
+func secureRemove(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err == nil {
+		_, err = io.CopyN(f, rand.Reader, info.Size())
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
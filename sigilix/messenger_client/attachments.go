@@ -0,0 +1,141 @@
+package messenger_client
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/custom_types"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+)
+
+// Files travel through the server's send_file method, RSA encrypted like messages, so they are kept
+// small. They are stored in the attachments table and share the message ids of the chat.
+
+const (
+	maxAttachmentSize = 4 << 20
+	// chunked RSA-OAEP with 2048 bit keys grows a file by about 35%, received files beyond this are
+	// dropped without decrypting them
+	maxEncryptedAttachmentSize = 2 * maxAttachmentSize
+)
+
+type FileReceivedNotification struct {
+	ChatId uint64 `json:"chat_id"`
+	// Attachment comes without content, see GetAttachment.
+	Attachment *data.Attachment `json:"attachment"`
+}
+
+func (i *FileReceivedNotification) NotificationType() WebNotificationType { return FileReceived }
+
+func (c *MessengerClient) SendFile(chatId uint64, mimeType string, content []byte) (*data.Attachment, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return nil, errors.New("not unlocked")
+	}
+	if len(content) == 0 {
+		return nil, errors.New("empty file")
+	}
+	if len(content) > maxAttachmentSize {
+		return nil, errors.New("file is too large")
+	}
+	chat, err := c.getAcceptedChat(chatId)
+	if err != nil {
+		return nil, err
+	}
+	if chat.MirroredFrom != 0 {
+		return nil, errMirroredChat
+	}
+	rsaPub, err := chat.OtherUserRsaPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.SendFile(chatId, content, mimeType, rsaPub)
+	if err != nil {
+		return nil, err
+	}
+	attachment := &data.Attachment{
+		ChatId:    chatId,
+		MessageId: resp.MessageId,
+		SenderId:  c.config.UserId,
+		MimeType:  mimeType,
+		Size:      len(content),
+		Content:   content,
+		CreatedAt: time.Now().Unix(),
+		ExpiresAt: expiresAt(chat.MessageTtl),
+	}
+	if err = c.database.SaveAttachment(attachment); err != nil {
+		return nil, err
+	}
+	attachment.Content = nil
+	return attachment, nil
+}
+
+func (c *MessengerClient) GetChatAttachments(chatId uint64) ([]*data.Attachment, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.unlocked {
+		return nil, errors.New("not unlocked")
+	}
+	return c.database.GetAttachments(chatId)
+}
+
+// GetAttachment returns an attachment with its content.
+func (c *MessengerClient) GetAttachment(chatId uint64, messageId uint64) (*data.Attachment, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.unlocked {
+		return nil, errors.New("not unlocked")
+	}
+	attachment, err := c.database.GetAttachment(chatId, messageId)
+	if err != nil {
+		return nil, err
+	}
+	if attachment == nil {
+		return nil, errors.New("attachment not found")
+	}
+	return attachment, nil
+}
+
+func (c *MessengerClient) receiveFile(notif *custom_types.SendFileNotification) ([]WebNotification, error) {
+	chat, err := c.database.GetChat(notif.ChatId)
+	if err != nil {
+		return nil, err
+	}
+	if !chatIsOpen(chat) || notif.SenderUserId != chat.OtherUserId {
+		return nil, errors.New("file from a user that is not in the chat")
+	}
+	if len(notif.EncryptedFile) > maxEncryptedAttachmentSize {
+		return nil, fmt.Errorf("file of %d bytes is too large", len(notif.EncryptedFile))
+	}
+	otherEcPub, err := chat.OtherUserEcdsaPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	decrypter, err := c.keys.ChatDecrypter(chat.ChatId)
+	if err != nil {
+		return nil, err
+	}
+	content, mimeType, err := notif.ValidateAndDecrypt(otherEcPub, decrypter)
+	if err != nil {
+		return nil, &decryptError{chatId: chat.ChatId, messageId: notif.MessageId, senderId: notif.SenderUserId, err: err}
+	}
+	if len(content) > maxAttachmentSize {
+		return nil, fmt.Errorf("file of %d bytes is too large", len(content))
+	}
+	attachment := &data.Attachment{
+		ChatId:    chat.ChatId,
+		MessageId: notif.MessageId,
+		SenderId:  notif.SenderUserId,
+		MimeType:  mimeType,
+		Size:      len(content),
+		Content:   content,
+		CreatedAt: time.Now().Unix(),
+		ExpiresAt: expiresAt(chat.MessageTtl),
+	}
+	if err = c.database.SaveAttachment(attachment); err != nil {
+		return nil, err
+	}
+	attachment.Content = nil
+	return []WebNotification{&FileReceivedNotification{ChatId: chat.ChatId, Attachment: attachment}}, nil
+}
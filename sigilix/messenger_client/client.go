@@ -12,31 +12,107 @@ import (
 	"github.com/apepenkov/wails_sigilix_interface/sigilix/http_client"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
-	"time"
+	"sync"
 )
 
 const configFilename = "config.json"
 
+// MessengerClient is safe for concurrent use. Every exported method holds mu for its whole run:
+// getters share it, everything else, including pulls and sends, runs alone. So a pull applies its
+// notifications before or after a concurrent rename or send, never in between, at the cost of
+// making that call wait for the pull's requests to the server. Subscribe and GetPresence do not
+// take mu and never wait for a pull.
+//
+// Methods must not call exported methods, mu is not reentrant: they call the unexported variant.
 type MessengerClient struct {
-	config   *data.Config
-	database *data.SqliteDB
-	http     *http_client.SigilixHttpClient
-	apiUrl   string
-	unlocked bool
+	mu     sync.RWMutex
+	config *data.Config
+	store  data.Store
+	// keys holds the private keys of config while unlocked, config itself has none
+	keys *crypto_utils.Keyring
+	// database is store, or the transaction of the notification being applied, see inTx
+	database data.Tx
+	// tx collects what applying a notification does besides writing to database, nil outside inTx
+	tx     *txState
+	http   http_client.Transport
+	apiUrl string
+	// transport creates c.http on Unlock, the HTTP client for apiUrl unless SetTransport was called
+	transport http_client.TransportFactory
+	dataDir   string
+	unlocked  bool
+	// inMemory keeps the history in a data.MemoryStore, it is gone when the process exits
+	inMemory bool
+
+	ephemeral *ephemeralState
+	expiry    *expiryState
+	requests  *requestLimiter
+	pending   *notificationQueue
+	devices   *deviceState
+	events    *subscribers
+	idle      *lockState
+	// connection is the state of the last pull in this session, see connectionChanged
+	connection ConnectionState
 }
 
 func NewClient(apiUrl string) *MessengerClient {
 	return &MessengerClient{
-		apiUrl: apiUrl,
+		apiUrl:    apiUrl,
+		ephemeral: newEphemeralState(),
+		expiry:    &expiryState{},
+		requests:  newRequestLimiter(),
+		pending:   &notificationQueue{},
+		devices:   newDeviceState(),
+		events:    newSubscribers(),
+		idle:      &lockState{},
+	}
+}
+
+// NewClientWithDataDir creates a client that keeps config.json and the databases in dataDir
+// instead of the working directory.
+func NewClientWithDataDir(apiUrl string, dataDir string) *MessengerClient {
+	return &MessengerClient{
+		apiUrl:    apiUrl,
+		dataDir:   dataDir,
+		ephemeral: newEphemeralState(),
+		expiry:    &expiryState{},
+		requests:  newRequestLimiter(),
+		pending:   &notificationQueue{},
+		devices:   newDeviceState(),
+		events:    newSubscribers(),
+		idle:      &lockState{},
 	}
 }
 
+func (c *MessengerClient) configPath() string {
+	return filepath.Join(c.dataDir, configFilename)
+}
+
+func (c *MessengerClient) databasePath(userId uint64) string {
+	return filepath.Join(c.dataDir, fmt.Sprintf("sigilix_%d.db", userId))
+}
+
+// saveConfig writes config with the keys of the keyring to config.json.
+func (c *MessengerClient) saveConfig() error {
+	return c.keys.WriteKeys(func(ecdsaPrivate []byte, rsaPrivate []byte, chatKeys map[uint64][]byte) error {
+		conf := *c.config
+		conf.InitialECDSAPrivateKey = ecdsaPrivate
+		conf.InitialRsaRivateKey = rsaPrivate
+		conf.ChatRsaPrivateKeys = make(map[uint64]custom_types.Base64Bytes, len(chatKeys))
+		for chatId, key := range chatKeys {
+			conf.ChatRsaPrivateKeys[chatId] = key
+		}
+		return conf.SaveToFile(c.configPath())
+	})
+}
+
 func (c *MessengerClient) connectSqlite(filename string) error {
 	db, err := data.NewSqliteDB(filename)
 	if err != nil {
 		return err
 	}
+	c.store = db
 	c.database = db
 	return nil
 }
@@ -46,12 +122,29 @@ func (c *MessengerClient) connectSqlitePassword(filename string, passwordHash []
 	if err != nil {
 		return err
 	}
+	c.store = db
 	c.database = db
 	return nil
 }
 
+// SetTransport replaces the HTTP client used after the next Unlock, e.g. with the loopback of a
+// mock_server.Server.
+func (c *MessengerClient) SetTransport(transport http_client.TransportFactory) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.transport = transport
+}
+
+// UseInMemoryStore makes the next Unlock keep chats and messages in memory instead of the database.
+// Only config.json is read from disk, the history is lost when the process exits.
+func (c *MessengerClient) UseInMemoryStore() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inMemory = true
+}
+
 func (c *MessengerClient) IsSignedUp() bool {
-	_, err := os.Stat(configFilename)
+	_, err := os.Stat(c.configPath())
 	if err != nil {
 		return false
 	}
@@ -59,6 +152,8 @@ func (c *MessengerClient) IsSignedUp() bool {
 }
 
 func (c *MessengerClient) IsUnlocked() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.unlocked
 }
 
@@ -70,7 +165,17 @@ func Sha256x(x int, data []byte) []byte {
 	return data
 }
 
+// SignUp creates an identity with a wide user id, see crypto_utils.UserIdWide.
 func (c *MessengerClient) SignUp(password string) error {
+	return c.SignUpWithIdVersion(password, crypto_utils.UserIdWide)
+}
+
+// SignUpWithIdVersion creates an identity whose user id uses the given derivation. Wide ids are
+// only accepted by servers that verify them with crypto_utils.VerifyUserId, legacy ones are for
+// servers that do not.
+func (c *MessengerClient) SignUpWithIdVersion(password string, version crypto_utils.UserIdVersion) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	passHash := Sha256x(100, []byte(password))
 
 	conf := &data.Config{}
@@ -85,54 +190,209 @@ func (c *MessengerClient) SignUp(password string) error {
 
 	conf.Username = ""
 	conf.SearchByUsername = false
-	conf.UserId = crypto_utils.GenerateUserIdByPublicKey(ecdsaPrivate.Public().(*ecdsa.PublicKey))
+	conf.UserId, err = crypto_utils.DeriveUserId(ecdsaPrivate.Public().(*ecdsa.PublicKey), version)
+	if err != nil {
+		return err
+	}
+	conf.UserIdVersion = version
 	conf.InitialRsaRivateKey = crypto_utils.RsaPrivateToBytes(rsa)
 	conf.InitialECDSAPrivateKey = crypto_utils.PrivateKeyToBytes(ecdsaPrivate)
 	conf.PaswordHash = passHash
 
-	err = conf.SaveToFile(configFilename)
+	err = conf.SaveToFile(c.configPath())
+	crypto_utils.Wipe(conf.InitialRsaRivateKey)
+	crypto_utils.Wipe(conf.InitialECDSAPrivateKey)
 	if err != nil {
 		return err
 	}
-	return nil
+	return c.writeDuressFile("")
 }
 
 func (c *MessengerClient) Unlock(password string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// a second session would leak the keyring and the database of the first, see Lock
+	if c.unlocked {
+		return errors.New("already unlocked")
+	}
 	if !c.IsSignedUp() {
 		return errors.New("not signed up")
 	}
 	passHash := Sha256x(100, []byte(password))
-	conf, err := data.LoadConfigFromFiles(configFilename, passHash)
+	conf, err := data.LoadConfigFromFiles(c.configPath(), passHash)
+	if err != nil {
+		if c.isDuressPassword(password) {
+			_ = c.wipeData()
+		}
+		return err
+	}
+	keys, err := crypto_utils.NewKeyring(conf.InitialECDSAPrivateKey, conf.InitialRsaRivateKey)
+	crypto_utils.Wipe(conf.InitialECDSAPrivateKey)
+	crypto_utils.Wipe(conf.InitialRsaRivateKey)
+	conf.InitialECDSAPrivateKey = nil
+	conf.InitialRsaRivateKey = nil
 	if err != nil {
 		return err
 	}
+	unlocked := false
+	defer func() {
+		if !unlocked {
+			keys.Wipe()
+		}
+	}()
+	for chatId, key := range conf.ChatRsaPrivateKeys {
+		err = keys.AddChatKey(chatId, key)
+		crypto_utils.Wipe(key)
+		if err != nil {
+			return err
+		}
+	}
+	conf.ChatRsaPrivateKeys = nil
+	if !crypto_utils.VerifyUserId(conf.UserId, keys.EcdsaPublicKey()) {
+		return errors.New("user id does not match the identity key")
+	}
+	if conf.UserIdVersion == 0 {
+		conf.UserIdVersion = crypto_utils.UserIdLegacy
+	}
 	c.config = conf
-	c.http = http_client.NewSigilixHttpClient(c.apiUrl, conf.MustEcdsaPrivateKey(), conf.UserId)
+	c.keys = keys
+	if c.transport == nil {
+		c.transport = http_client.HttpTransport(c.apiUrl)
+	}
+	c.http = c.transport(keys, conf.UserId)
 
-	login, err := c.http.Login(conf.MustEcdsaPublicKey(), conf.MustRsaPublicKey())
+	login, err := c.http.Login(keys.EcdsaPublicKey(), keys.RsaPublicKey())
 	if err != nil {
 		return err
 	}
 	if login.UserId != conf.UserId {
 		return errors.New("wrong user id")
 	}
-	//err = c.connectSqlite(fmt.Sprintf("sigilix_%d.db", conf.UserId))
-	err = c.connectSqlitePassword(fmt.Sprintf("sigilix_%d.db", conf.UserId), passHash)
-	if err != nil {
-		return err
+	if c.inMemory {
+		c.store = data.NewMemoryStore()
+		c.database = c.store
+	} else {
+		//err = c.connectSqlite(fmt.Sprintf("sigilix_%d.db", conf.UserId))
+		err = c.connectSqlitePassword(c.databasePath(conf.UserId), passHash)
+		if err != nil {
+			return err
+		}
 	}
 	c.unlocked = true
+	unlocked = true
+	if err = c.moveChatKeysToKeyring(); err != nil {
+		log.Printf("error moving chat keys out of the database: %s", err.Error())
+	}
+	// accounts from before duress passwords get their duress file now, see SetDuressPassword
+	if _, err = os.Stat(c.duressPath()); os.IsNotExist(err) {
+		if err = c.writeDuressFile(""); err != nil {
+			log.Printf("error writing duress file: %s", err.Error())
+		}
+	}
+	c.startJanitor()
+	c.startIdleLock(conf)
 	return nil
 }
 
+// moveChatKeysToKeyring moves the private keys of chats from before the keyring out of the database
+// into the keyring, which keeps them in the encrypted config. The config is written before the
+// column is blanked, a failure leaves the key in both and is retried at the next unlock.
+func (c *MessengerClient) moveChatKeysToKeyring() error {
+	chats, err := c.database.GetAllChats()
+	if err != nil {
+		return err
+	}
+	moved := make([]*data.Chat, 0)
+	for _, chat := range chats {
+		if len(chat.MyRsaPrivate) == 0 {
+			continue
+		}
+		if err = c.keys.AddChatKey(chat.ChatId, chat.MyRsaPrivate); err != nil {
+			return err
+		}
+		moved = append(moved, chat)
+	}
+	if len(moved) == 0 {
+		return nil
+	}
+	if err = c.saveConfig(); err != nil {
+		return err
+	}
+	return c.inTx(func() error {
+		for _, chat := range moved {
+			crypto_utils.Wipe(chat.MyRsaPrivate)
+			chat.MyRsaPrivate = nil
+			if err := c.database.UpdateChat(chat); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetChats returns every chat except incoming requests, see GetPendingChatRequests, and the chats
+// that link devices. The most recently active chats come first, each with a preview of its last
+// message.
 func (c *MessengerClient) GetChats() ([]*data.Chat, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.getChats()
+}
+
+func (c *MessengerClient) getChats() ([]*data.Chat, error) {
 	if !c.unlocked {
 		return nil, errors.New("not unlocked")
 	}
-	return c.database.GetAllChats()
+	chats, err := c.database.GetChatsSortedByActivity()
+	if err != nil {
+		return nil, err
+	}
+	filtered := make([]*data.Chat, 0, len(chats))
+	for _, chat := range chats {
+		if !isPendingRequest(chat) && !c.isLinkChat(chat) {
+			if chat.Preview, err = c.chatPreview(chat); err != nil {
+				return nil, err
+			}
+			filtered = append(filtered, chat)
+		}
+	}
+	return filtered, nil
+}
+
+const previewLength = 100
+
+// chatPreview describes the last message of a chat, nil if the chat has none.
+func (c *MessengerClient) chatPreview(chat *data.Chat) (*data.MessagePreview, error) {
+	var last *data.Message
+	for _, message := range chat.Messages {
+		if last == nil || message.MessageId > last.MessageId {
+			last = message
+		}
+	}
+	// files share the message ids, and the last message may be gone after all
+	if last == nil || last.MessageId < chat.LastMessageId {
+		attachments, err := c.database.GetAttachments(chat.ChatId)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(attachments); n > 0 && (last == nil || attachments[n-1].MessageId > last.MessageId) {
+			attachment := attachments[n-1]
+			return &data.MessagePreview{MessageId: attachment.MessageId, SenderId: attachment.SenderId, MimeType: attachment.MimeType}, nil
+		}
+	}
+	if last == nil {
+		return nil, nil
+	}
+	text := []rune(last.Content)
+	if len(text) > previewLength {
+		text = append(text[:previewLength], '…')
+	}
+	return &data.MessagePreview{MessageId: last.MessageId, SenderId: last.SenderId, Text: string(text), Deleted: last.Deleted}, nil
 }
 
 func (c *MessengerClient) GetChatMessages(chatId uint64) ([]*data.Message, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	if !c.unlocked {
 		return nil, errors.New("not unlocked")
 	}
@@ -140,47 +400,182 @@ func (c *MessengerClient) GetChatMessages(chatId uint64) ([]*data.Message, error
 }
 
 func (c *MessengerClient) SendMessage(chatId uint64, text string) (*data.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sendText(chatId, text, 0)
+}
+
+func (c *MessengerClient) ReplyToMessage(chatId uint64, replyTo uint64, text string) (*data.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sendText(chatId, text, replyTo)
+}
+
+func (c *MessengerClient) sendText(chatId uint64, text string, replyTo uint64) (*data.Message, error) {
 	if !c.unlocked {
 		return nil, errors.New("not unlocked")
 	}
 	chat, err := c.database.GetChat(chatId)
-
-	if chat == nil {
-		return nil, errors.New("chat not found")
+	if err != nil {
+		return nil, err
 	}
 
 	if !chat.Accepted {
 		return nil, errors.New("chat not accepted")
 	}
 
-	if err != nil {
-		return nil, err
+	if replyTo != 0 {
+		original, err := c.database.GetMessage(chatId, replyTo)
+		if err != nil {
+			return nil, err
+		}
+		if original == nil {
+			return nil, errors.New("message to reply to not found")
+		}
 	}
 
-	rsaPub, err := chat.OtherUserRsaPublicKey()
-	if err != nil {
-		return nil, err
+	if chat.MirroredFrom != 0 {
+		return c.relayText(chat, text, replyTo)
 	}
 
-	msg, err := c.http.SendMessage(chatId, text, rsaPub)
+	msg, err := c.sendPayload(chat, &Payload{Type: PayloadText, Text: text, ReplyTo: replyTo, ExpiresIn: chat.MessageTtl})
 	if err != nil {
 		return nil, err
 	}
 
-	message := c.database.NewMessage()
+	message := &data.Message{}
 	message.ChatId = chatId
 	message.Content = text
 	message.MessageId = msg.MessageId
 	message.SenderId = c.config.UserId
+	message.ReplyTo = replyTo
+	message.Status = data.MessageStatusSent
+	message.ExpiresAt = expiresAt(chat.MessageTtl)
+
+	err = c.database.SaveMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	c.mirrorMessage(chat, message)
+	return message, nil
+}
+
+func (c *MessengerClient) getAcceptedChat(chatId uint64) (*data.Chat, error) {
+	chat, err := c.database.GetChat(chatId)
+	if err != nil {
+		return nil, err
+	}
+	if !chat.Accepted {
+		return nil, errors.New("chat not accepted")
+	}
+	return chat, nil
+}
 
-	err = message.Save()
+func (c *MessengerClient) EditMessage(chatId uint64, messageId uint64, text string) (*data.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return nil, errors.New("not unlocked")
+	}
+	chat, err := c.getAcceptedChat(chatId)
+	if err != nil {
+		return nil, err
+	}
+	message, err := c.getOwnMessage(chatId, messageId, c.config.UserId)
 	if err != nil {
 		return nil, err
 	}
+	_, err = c.sendPayload(chat, &Payload{Type: PayloadEdit, EditOf: messageId, Text: text})
+	if err != nil {
+		return nil, err
+	}
+	message.Content = text
+	message.Edited = true
+	err = c.database.UpdateMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	c.mirrorMessage(chat, message)
 	return message, nil
 }
 
+// DeleteMessage deletes one of our messages for both users, see DeleteMessageForMe.
+func (c *MessengerClient) DeleteMessage(chatId uint64, messageId uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return errors.New("not unlocked")
+	}
+	chat, err := c.getAcceptedChat(chatId)
+	if err != nil {
+		return err
+	}
+	message, err := c.getOwnMessage(chatId, messageId, c.config.UserId)
+	if err != nil {
+		return err
+	}
+	_, err = c.sendPayload(chat, &Payload{Type: PayloadDelete, DeleteOf: messageId})
+	if err != nil {
+		return err
+	}
+	markDeleted(message)
+	if err = c.database.UpdateMessage(message); err != nil {
+		return err
+	}
+	c.mirrorMessage(chat, message)
+	return nil
+}
+
+// DeleteMessageForMe deletes a message of either user from our history only, DeleteMessage deletes
+// one of ours for both sides.
+func (c *MessengerClient) DeleteMessageForMe(chatId uint64, messageId uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return errors.New("not unlocked")
+	}
+	message, err := c.database.GetMessage(chatId, messageId)
+	if err != nil {
+		return err
+	}
+	if message == nil {
+		return errors.New("message not found")
+	}
+	return c.database.DeleteMessage(chatId, messageId)
+}
+
+// ReactToMessage sets our reaction to a message, an empty reaction removes it.
+func (c *MessengerClient) ReactToMessage(chatId uint64, messageId uint64, reaction string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return errors.New("not unlocked")
+	}
+	chat, err := c.getAcceptedChat(chatId)
+	if err != nil {
+		return err
+	}
+	message, err := c.database.GetMessage(chatId, messageId)
+	if err != nil {
+		return err
+	}
+	if message == nil {
+		return errors.New("message not found")
+	}
+	_, err = c.sendPayload(chat, &Payload{Type: PayloadReaction, ReactionTo: messageId, Reaction: reaction})
+	if err != nil {
+		return err
+	}
+	return c.database.SetReaction(chatId, messageId, c.config.UserId, reaction)
+}
+
 func (c *MessengerClient) InitChatFromInitializer(userId uint64) (*data.Chat, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.initChatFromInitializer(userId)
+}
+
+func (c *MessengerClient) initChatFromInitializer(userId uint64) (*data.Chat, error) {
 	if !c.unlocked {
 		return nil, errors.New("not unlocked")
 	}
@@ -189,18 +584,28 @@ func (c *MessengerClient) InitChatFromInitializer(userId uint64) (*data.Chat, er
 		return nil, err
 	}
 
-	chatBucket := c.database.NewChat()
+	chatBucket := &data.Chat{}
 	chatBucket.ChatId = chat.ChatId
 	chatBucket.OtherUserId = userId
 	chatBucket.LastMessageId = 0
 	chatBucket.AmIInitiator = true
-	chatBucket.Accepted = false
 	chatBucket.OtherUserRsaPublic = nil
 	chatBucket.OtherUserEcdsaPublic = nil
-	chatBucket.MyRsaPrivate = c.config.InitialRsaRivateKey
-
-	chatBucket.Title = fmt.Sprintf("Chat with %d, %s", userId, time.Now().Format("2006-01-02 15:04:05"))
-	err = chatBucket.Save()
+	if err = transitionChat(chatBucket, data.ChatRequested); err != nil {
+		return nil, err
+	}
+	// keys seen in a username search are pinned now and checked again on acceptance
+	known, err := c.database.GetUserInfo(userId)
+	if err != nil {
+		return nil, err
+	}
+	if known != nil && validateUserKeys(userId, known.EcdsaPublic, known.RsaPublic) == nil {
+		chatBucket.OtherUserEcdsaPublic = known.EcdsaPublic
+		chatBucket.OtherUserRsaPublic = known.RsaPublic
+		chatBucket.OtherUsername = known.Username
+	}
+	chatBucket.Title = defaultChatTitle(userId, chatBucket.OtherUsername)
+	err = c.database.SaveChat(chatBucket)
 	if err != nil {
 		return nil, err
 	}
@@ -209,22 +614,30 @@ func (c *MessengerClient) InitChatFromInitializer(userId uint64) (*data.Chat, er
 }
 
 func (c *MessengerClient) InitChatFromReceiver(chatId uint64) (*data.Chat, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.initChatFromReceiver(chatId)
+}
+
+func (c *MessengerClient) initChatFromReceiver(chatId uint64) (*data.Chat, error) {
 	if !c.unlocked {
 		return nil, errors.New("not unlocked")
 	}
-	chat, err := c.http.InitChatFromReceiver(chatId)
+	existingChat, err := c.database.GetChat(chatId)
 	if err != nil {
 		return nil, err
 	}
-	existingChat, err := c.database.GetChat(chat.ChatId)
-	if err != nil {
+	if existingChat.AmIInitiator {
+		return nil, errors.New("can not accept own chat request")
+	}
+	if err = transitionChat(existingChat, data.ChatAccepted); err != nil {
 		return nil, err
 	}
-	if existingChat == nil {
-		return nil, errors.New("chat not found")
+	_, err = c.http.InitChatFromReceiver(chatId)
+	if err != nil {
+		return nil, err
 	}
-	existingChat.Accepted = true
-	err = existingChat.Update()
+	err = c.database.UpdateChat(existingChat)
 	if err != nil {
 		return nil, err
 	}
@@ -232,6 +645,12 @@ func (c *MessengerClient) InitChatFromReceiver(chatId uint64) (*data.Chat, error
 }
 
 func (c *MessengerClient) SearchByUsername(username string) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.searchByUsername(username)
+}
+
+func (c *MessengerClient) searchByUsername(username string) (uint64, error) {
 	if !c.unlocked {
 		return 0, errors.New("not unlocked")
 	}
@@ -239,13 +658,18 @@ func (c *MessengerClient) SearchByUsername(username string) (uint64, error) {
 	if err != nil {
 		return 0, err
 	}
-	if search.PublicInfo == nil {
+	if search == nil {
 		return 0, nil
 	}
+	if _, err = c.ingestUserInfo(search.PublicInfo, 0); err != nil {
+		return 0, err
+	}
 	return search.PublicInfo.UserId, nil
 }
 
 func (c *MessengerClient) GetChat(chatId uint64) (*data.Chat, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	if !c.unlocked {
 		return nil, errors.New("not unlocked")
 	}
@@ -258,6 +682,29 @@ const (
 	NewIncomingChat WebNotificationType = "new_incoming_chat"
 	NewMessage      WebNotificationType = "new_message"
 	ChatAccepted    WebNotificationType = "chat_accepted"
+	NewGroup        WebNotificationType = "new_group"
+	GroupUpdated    WebNotificationType = "group_updated"
+	NewGroupMessage WebNotificationType = "new_group_message"
+	MessageStatus   WebNotificationType = "message_status"
+	MessageEdited   WebNotificationType = "message_edited"
+	MessageDeleted  WebNotificationType = "message_deleted"
+	MessageReaction WebNotificationType = "message_reaction"
+	MessagesExpired WebNotificationType = "messages_expired"
+	ChatTimer       WebNotificationType = "chat_timer"
+	SecurityAlert   WebNotificationType = "security_alert"
+	DeviceLinked    WebNotificationType = "device_linked"
+	DeviceUnlinked  WebNotificationType = "device_unlinked"
+	DeviceHistory   WebNotificationType = "device_history"
+	FileReceived    WebNotificationType = "file_received"
+	ChatClosed      WebNotificationType = "chat_closed"
+	AccountClosed   WebNotificationType = "account_closed"
+	KeyChanged      WebNotificationType = "key_changed"
+	DecryptFailed   WebNotificationType = "decrypt_failed"
+	UsernameChanged WebNotificationType = "username_changed"
+	// ConnectionStateChanged is sent when pulling from the server starts or stops failing.
+	ConnectionStateChanged WebNotificationType = "connection_state"
+	// Presence is transient: typing and online state changes, including expiries.
+	Presence WebNotificationType = "presence"
 )
 
 type WebNotification interface {
@@ -271,145 +718,366 @@ type IncomingChatNotification struct {
 func (i *IncomingChatNotification) NotificationType() WebNotificationType { return NewIncomingChat }
 
 type NewMessageNotification struct {
-	ChatId  uint64        `json:"chat_id,omitempty"`
-	Message *data.Message `json:"message,omitempty"`
+	ChatId         uint64        `json:"chat_id,omitempty"`
+	Message        *data.Message `json:"message,omitempty"`
+	SenderUsername string        `json:"sender_username,omitempty"`
 }
 
 func (i *NewMessageNotification) NotificationType() WebNotificationType { return NewMessage }
 
+type MessageEditedNotification struct {
+	ChatId  uint64        `json:"chat_id"`
+	Message *data.Message `json:"message"`
+}
+
+func (i *MessageEditedNotification) NotificationType() WebNotificationType { return MessageEdited }
+
+type MessageDeletedNotification struct {
+	ChatId    uint64 `json:"chat_id"`
+	MessageId uint64 `json:"message_id"`
+}
+
+func (i *MessageDeletedNotification) NotificationType() WebNotificationType { return MessageDeleted }
+
+type MessageReactionNotification struct {
+	ChatId    uint64 `json:"chat_id"`
+	MessageId uint64 `json:"message_id"`
+	UserId    uint64 `json:"user_id"`
+	// Reaction is empty when the reaction was removed.
+	Reaction string `json:"reaction"`
+}
+
+func (i *MessageReactionNotification) NotificationType() WebNotificationType { return MessageReaction }
+
+type MessageStatusNotification struct {
+	ChatId     uint64             `json:"chat_id"`
+	MessageIds []uint64           `json:"message_ids"`
+	Status     data.MessageStatus `json:"status"`
+}
+
+func (i *MessageStatusNotification) NotificationType() WebNotificationType { return MessageStatus }
+
+type ChatClosedNotification struct {
+	ChatId uint64 `json:"chat_id"`
+	UserId uint64 `json:"user_id"`
+}
+
+func (i *ChatClosedNotification) NotificationType() WebNotificationType { return ChatClosed }
+
+type MessagesExpiredNotification struct {
+	ChatId     uint64   `json:"chat_id"`
+	MessageIds []uint64 `json:"message_ids"`
+}
+
+func (i *MessagesExpiredNotification) NotificationType() WebNotificationType { return MessagesExpired }
+
+type ChatTimerNotification struct {
+	ChatId uint64 `json:"chat_id"`
+	// UserId is the user who changed the timer.
+	UserId uint64 `json:"user_id"`
+	Ttl    uint64 `json:"ttl"`
+}
+
+func (i *ChatTimerNotification) NotificationType() WebNotificationType { return ChatTimer }
+
+type PresenceNotification struct {
+	Presence *ChatPresence `json:"presence"`
+}
+
+func (i *PresenceNotification) NotificationType() WebNotificationType { return Presence }
+
 type ChatAcceptedNotification struct {
 	Chat *data.Chat `json:"chat"`
 }
 
 func (i *ChatAcceptedNotification) NotificationType() WebNotificationType { return ChatAccepted }
 
+type NewGroupNotification struct {
+	Group *data.Group `json:"group"`
+}
+
+func (i *NewGroupNotification) NotificationType() WebNotificationType { return NewGroup }
+
+type GroupUpdatedNotification struct {
+	Group *data.Group `json:"group"`
+}
+
+func (i *GroupUpdatedNotification) NotificationType() WebNotificationType { return GroupUpdated }
+
+type NewGroupMessageNotification struct {
+	GroupId string             `json:"group_id"`
+	Message *data.GroupMessage `json:"message"`
+}
+
+func (i *NewGroupMessageNotification) NotificationType() WebNotificationType { return NewGroupMessage }
+
+// notificationQueue holds notifications raised outside of PullNotificationsAndUpdateData, they are
+// returned by the next pull.
+type notificationQueue struct {
+	mu            sync.Mutex
+	notifications []WebNotification
+}
+
+func (q *notificationQueue) push(notifications ...WebNotification) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.notifications = append(q.notifications, notifications...)
+}
+
+func (q *notificationQueue) take() []WebNotification {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	notifications := q.notifications
+	q.notifications = nil
+	return notifications
+}
+
 type WebNotificationWithTypeInfo struct {
 	Notification WebNotification     `json:"notification"`
 	Type         WebNotificationType `json:"type"`
 }
 
+var errUnknownNotification = errors.New("unknown notification type")
+
+// appliedNotification is what applying one notification yields, kept aside until its transaction
+// is committed.
+type appliedNotification struct {
+	notifications      []WebNotification
+	deliveredChatId    uint64
+	deliveredMessageId uint64
+}
+
+// txState holds the effects of a notification that can not be rolled back: requests to the
+// server and notifications for the UI. They run once its transaction is committed, and are dropped
+// with it.
+type txState struct {
+	effects []func()
+}
+
+// inTx runs fn with c.database set to one transaction, so that a notification is applied
+// completely or not at all. The caller holds mu, nothing else sees the transaction.
+func (c *MessengerClient) inTx(fn func() error) error {
+	tx := &txState{}
+	err := c.store.WithTx(func(database data.Tx) error {
+		c.database, c.tx = database, tx
+		defer func() { c.database, c.tx = c.store, nil }()
+		return fn()
+	})
+	if err != nil {
+		return err
+	}
+	for _, effect := range tx.effects {
+		effect()
+	}
+	return nil
+}
+
+// afterCommit runs effect once the transaction of the notification being applied is committed,
+// or right away outside inTx.
+func (c *MessengerClient) afterCommit(effect func()) {
+	if c.tx == nil {
+		effect()
+		return
+	}
+	c.tx.effects = append(c.tx.effects, effect)
+}
+
+// queueNotifications hands notifications to the next pull, see afterCommit.
+func (c *MessengerClient) queueNotifications(notifications ...WebNotification) {
+	c.afterCommit(func() { c.pending.push(notifications...) })
+}
+
+// applyNotification applies one server notification. Errors say why the notification is dropped,
+// the transaction it runs in is rolled back then.
+func (c *MessengerClient) applyNotification(inner custom_types.SomeNotification, applied *appliedNotification) error {
+	switch notif := inner.(type) {
+	case *custom_types.InitChatFromInitializerNotification:
+		initializer, err := c.ingestUserInfo(notif.InitializerUserInfo, notif.ChatId)
+		if err != nil {
+			return fmt.Errorf("dropping chat request %d: %w", notif.ChatId, err)
+		}
+		decision, err := c.decideChatRequest(notif.ChatId, notif.InitializerUserInfo)
+		if decision == requestDropped {
+			return fmt.Errorf("dropping chat request from user %d: %w", notif.InitializerUserInfo.UserId, err)
+		}
+		chat := &data.Chat{}
+		chat.ChatId = notif.ChatId
+		chat.OtherUserId = notif.InitializerUserInfo.UserId
+		chat.LastMessageId = 0
+		chat.AmIInitiator = false
+		chat.OtherUserRsaPublic = notif.InitializerUserInfo.InitialRsaPublicKey
+		chat.OtherUserEcdsaPublic = notif.InitializerUserInfo.EcdsaPublicKey
+		if err = transitionChat(chat, data.ChatPending); err != nil {
+			return fmt.Errorf("error receiving chat request: %w", err)
+		}
+		chat.OtherUsername = initializer.Username
+		chat.Title = defaultChatTitle(chat.OtherUserId, chat.OtherUsername)
+		if err = c.database.SaveChat(chat); err != nil {
+			return fmt.Errorf("error saving chat: %w", err)
+		}
+		if decision == requestAutoAccepted {
+			// accepted on the server once the request is saved, the notification shows the result
+			c.afterCommit(func() { c.autoAcceptChat(chat) })
+		}
+		applied.notifications = append(applied.notifications, &IncomingChatNotification{
+			Chat: chat,
+		})
+	case *custom_types.InitChatFromReceiverNotification:
+		chat, err := c.database.GetChat(notif.ChatId)
+		if err != nil {
+			return fmt.Errorf("error getting chat: %w", err)
+		}
+		if !chat.AmIInitiator {
+			return fmt.Errorf("chat %d was accepted by the initiator", chat.ChatId)
+		}
+		if err = transitionChat(chat, data.ChatAccepted); err != nil {
+			return fmt.Errorf("error accepting chat: %w", err)
+		}
+		receiver, err := c.ingestUserInfo(notif.ReceiverUserInfo, chat.ChatId)
+		if err != nil {
+			return fmt.Errorf("rejecting keys for chat %d: %w", chat.ChatId, err)
+		}
+		if err = learnOtherUserKeys(chat, notif.ReceiverUserInfo); err != nil {
+			err = c.securityAlert(SecurityKeyMismatch, notif.ReceiverUserInfo.UserId, chat.ChatId, err)
+			return fmt.Errorf("rejecting keys for chat %d: %w", chat.ChatId, err)
+		}
+		chat.OtherUsername = receiver.Username
+		retitleWithUsername(chat, chat.OtherUsername)
+		if err = c.database.UpdateChat(chat); err != nil {
+			return fmt.Errorf("error updating chat: %w", err)
+		}
+		applied.notifications = append(applied.notifications, &ChatAcceptedNotification{
+			Chat: chat,
+		})
+		device, err := c.completeDeviceLink(chat)
+		if err != nil {
+			log.Printf("error linking device: %s", err.Error())
+		} else if device != nil {
+			applied.notifications = append(applied.notifications, &DeviceLinkedNotification{PrimaryUserId: c.config.UserId, DeviceUserId: device.DeviceUserId})
+		}
+	case *custom_types.UpdateChatRsaKeyNotification:
+		chat, err := c.database.GetChat(notif.ChatId)
+		if err != nil {
+			return fmt.Errorf("error getting chat: %w", err)
+		}
+		if notif.UserId != chat.OtherUserId {
+			return fmt.Errorf("rsa key update for chat %d from user %d, not a member", chat.ChatId, notif.UserId)
+		}
+		if _, err = crypto_utils.PublicRSAKeyFromBytes(notif.RsaPublicKey); err != nil {
+			return fmt.Errorf("invalid rsa key for chat %d: %w", chat.ChatId, err)
+		}
+		if err = transitionChat(chat, data.ChatKeyRotated); err != nil {
+			return fmt.Errorf("error rotating chat key: %w", err)
+		}
+		chat.OtherUserRsaPublic = notif.RsaPublicKey
+		if err = c.database.UpdateChat(chat); err != nil {
+			return fmt.Errorf("error updating chat: %w", err)
+		}
+		applied.notifications = append(applied.notifications, &KeyChangedNotification{ChatId: chat.ChatId, UserId: notif.UserId})
+	case *custom_types.SendMessageNotification:
+		if err := c.checkNotBlocked(notif.SenderUserId); err != nil {
+			return fmt.Errorf("dropping message: %w", err)
+		}
+		chat, err := c.database.GetChat(notif.ChatId)
+		if err != nil {
+			return fmt.Errorf("error getting chat: %w", err)
+		}
+		otherEcPub, err := chat.OtherUserEcdsaPublicKey()
+		if err != nil {
+			return fmt.Errorf("error getting other user ecdsa public key: %w", err)
+		}
+		decrypter, err := c.keys.ChatDecrypter(chat.ChatId)
+		if err != nil {
+			return fmt.Errorf("error getting my rsa private key: %w", err)
+		}
+		messageContent, err := notif.ValidateAndDecrypt(otherEcPub, decrypter)
+		if err != nil {
+			return &decryptError{chatId: chat.ChatId, messageId: notif.MessageId, senderId: notif.SenderUserId, err: err}
+		}
+		payload, err := decodePayload(messageContent, otherEcPub)
+		if err != nil {
+			return &decryptError{chatId: chat.ChatId, messageId: notif.MessageId, senderId: notif.SenderUserId, err: err}
+		}
+		if c.isLinkCandidate(chat.ChatId) && (payload.Type != PayloadControl || payload.Control == nil || payload.Control.Type != controlDeviceLink) {
+			return fmt.Errorf("dropping %s payload in device link chat %d before the proof", payload.Type, chat.ChatId)
+		}
+		payloadNotifications, err := c.applyPayload(chat, notif.MessageId, notif.SenderUserId, payload)
+		if err != nil {
+			return fmt.Errorf("error applying %s payload: %w", payload.Type, err)
+		}
+		applied.notifications = append(applied.notifications, payloadNotifications...)
+		if payload.Type == PayloadText {
+			applied.deliveredChatId = chat.ChatId
+			applied.deliveredMessageId = notif.MessageId
+		}
+	case *custom_types.SendFileNotification:
+		if err := c.checkNotBlocked(notif.SenderUserId); err != nil {
+			return fmt.Errorf("dropping file: %w", err)
+		}
+		if c.isLinkCandidate(notif.ChatId) {
+			return fmt.Errorf("dropping file in device link chat %d before the proof", notif.ChatId)
+		}
+		fileNotifications, err := c.receiveFile(notif)
+		if err != nil {
+			return fmt.Errorf("error receiving file: %w", err)
+		}
+		applied.notifications = append(applied.notifications, fileNotifications...)
+	default:
+		return errUnknownNotification
+	}
+	return nil
+}
+
 func (c *MessengerClient) PullNotificationsAndUpdateData() ([]*WebNotificationWithTypeInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if !c.unlocked {
 		return nil, errors.New("not unlocked")
 	}
 	notifications, err := c.http.FetchNotifications(100)
 	if err != nil {
+		if offline := c.connectionChanged(ConnectionOffline, err); offline != nil {
+			c.broadcast([]*WebNotificationWithTypeInfo{{Notification: offline, Type: offline.NotificationType()}})
+		}
 		return nil, err
 	}
 	toReturn := make([]WebNotification, 0, len(notifications))
+	delivered := make(map[uint64][]uint64)
 	for _, notification := range notifications {
-		inner := notification.Notification
-		switch inner.(type) {
-		case *custom_types.InitChatFromInitializerNotification:
-			notif := inner.(*custom_types.InitChatFromInitializerNotification)
-			chat := c.database.NewChat()
-			chat.ChatId = notif.ChatId
-			chat.OtherUserId = notif.InitializerUserInfo.UserId
-			chat.LastMessageId = 0
-			chat.AmIInitiator = false
-			chat.Accepted = false
-			chat.OtherUserRsaPublic = notif.InitializerUserInfo.InitialRsaPublicKey
-			chat.OtherUserEcdsaPublic = notif.InitializerUserInfo.EcdsaPublicKey
-			chat.MyRsaPrivate = c.config.InitialRsaRivateKey
-			chat.Title = fmt.Sprintf("Chat with %d, %s", notif.InitializerUserInfo.UserId, time.Now().Format("2006-01-02 15:04:05"))
-			err = chat.Save()
-			toReturn = append(toReturn, &IncomingChatNotification{
-				Chat: chat,
-			})
-			break
-		case *custom_types.InitChatFromReceiverNotification:
-			notif := inner.(*custom_types.InitChatFromReceiverNotification)
-			chat, err := c.database.GetChat(notif.ChatId)
-			if err != nil {
-				log.Printf("error getting chat: %s", err.Error())
-				continue
-			}
-			if chat == nil {
-				log.Printf("chat not found")
-				continue
-			}
-			chat.Accepted = true
-			chat.OtherUserEcdsaPublic = notif.ReceiverUserInfo.EcdsaPublicKey
-			chat.OtherUserRsaPublic = notif.ReceiverUserInfo.InitialRsaPublicKey
-			err = chat.Update()
-			if err != nil {
-				log.Printf("error updating chat: %s", err.Error())
-				continue
-			}
-			toReturn = append(toReturn, &ChatAcceptedNotification{
-				Chat: chat,
-			})
-
-			break
-		case *custom_types.UpdateChatRsaKeyNotification:
-			notif := inner.(*custom_types.UpdateChatRsaKeyNotification)
-			chat, err := c.database.GetChat(notif.ChatId)
-			if err != nil {
-				log.Printf("error getting chat: %s", err.Error())
-				continue
-			}
-			if chat == nil {
-				log.Printf("chat not found")
-				continue
-			}
-			chat.OtherUserRsaPublic = notif.RsaPublicKey
-			err = chat.Update()
-			if err != nil {
-				log.Printf("error updating chat: %s", err.Error())
-				continue
-			}
-			break
-		case *custom_types.SendMessageNotification:
-			notif := inner.(*custom_types.SendMessageNotification)
-			chat, err := c.database.GetChat(notif.ChatId)
-			if err != nil {
-				log.Printf("error getting chat: %s", err.Error())
-				continue
-			}
-			if chat == nil {
-				log.Printf("chat not found")
-				continue
-			}
-
-			otherEcPub, err := chat.OtherUserEcdsaPublicKey()
-			if err != nil {
-				log.Printf("error getting other user ecdsa public key: %s", err.Error())
-				continue
-			}
-			myRsaPriv, err := chat.MyRsaPrivateKey()
-			if err != nil {
-				log.Printf("error getting my rsa private key: %s", err.Error())
-				continue
-			}
-
-			messageContent, err := notif.ValidateAndDecrypt(otherEcPub, myRsaPriv)
-			if err != nil {
-				log.Printf("error decrypting message: %s", err.Error())
-				continue
+		applied := &appliedNotification{}
+		err = c.inTx(func() error {
+			return c.applyNotification(notification.Notification, applied)
+		})
+		if errors.Is(err, errUnknownNotification) {
+			return nil, err
+		}
+		if err != nil {
+			log.Printf("%s", err.Error())
+			var decryptErr *decryptError
+			if errors.As(err, &decryptErr) {
+				toReturn = append(toReturn, decryptErr.notification())
 			}
-			message := c.database.NewMessage()
-			message.ChatId = notif.ChatId
-			message.Content = string(messageContent)
-			message.MessageId = notif.MessageId
-			message.SenderId = notif.SenderUserId
-			err = message.Save()
-			if err != nil {
-				log.Printf("error saving message: %s", err.Error())
-				continue
+			var alertErr *securityAlertError
+			if errors.As(err, &alertErr) {
+				toReturn = append(toReturn, alertErr.alert)
 			}
-
-			toReturn = append(toReturn, &NewMessageNotification{
-				ChatId:  notif.ChatId,
-				Message: message,
-			})
-			break
-		case *custom_types.SendFileNotification:
-			break
-		default:
-			return nil, errors.New("unknown notification type")
-
+			continue
+		}
+		toReturn = append(toReturn, applied.notifications...)
+		if applied.deliveredMessageId != 0 {
+			delivered[applied.deliveredChatId] = append(delivered[applied.deliveredChatId], applied.deliveredMessageId)
 		}
 	}
+	c.sendDeliveredReceipts(delivered)
+	toReturn = append(toReturn, c.pending.take()...)
+	toReturn = append(toReturn, c.expireEphemeral()...)
+	if online := c.connectionChanged(ConnectionOnline, nil); online != nil {
+		toReturn = append(toReturn, online)
+	}
+	if err = c.announcePresence(); err != nil {
+		log.Printf("error announcing presence: %s", err.Error())
+	}
+
 	newToreturn := make([]*WebNotificationWithTypeInfo, 0, len(toReturn))
 	for _, notif := range toReturn {
 		newToreturn = append(newToreturn, &WebNotificationWithTypeInfo{
@@ -417,18 +1085,31 @@ func (c *MessengerClient) PullNotificationsAndUpdateData() ([]*WebNotificationWi
 			Type:         notif.NotificationType(),
 		})
 	}
+	c.broadcast(newToreturn)
 	return newToreturn, nil
 }
 
 func (c *MessengerClient) GetUsername() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.config == nil {
+		return ""
+	}
 	return c.config.Username
 }
 
 func (c *MessengerClient) GetUserId() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.config == nil {
+		return 0
+	}
 	return c.config.UserId
 }
 
 func (c *MessengerClient) SetUsernameConfig(username string, searchable bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if !c.unlocked {
 		return errors.New("not unlocked")
 	}
@@ -438,7 +1119,7 @@ func (c *MessengerClient) SetUsernameConfig(username string, searchable bool) er
 	}
 	c.config.Username = username
 	c.config.SearchByUsername = searchable
-	err = c.config.SaveToFile(configFilename)
+	err = c.saveConfig()
 	if err != nil {
 		return err
 	}
@@ -446,18 +1127,24 @@ func (c *MessengerClient) SetUsernameConfig(username string, searchable bool) er
 }
 
 func (c *MessengerClient) TryRequestChat(userIdOrUsername string) (*data.Chat, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	asInt, err := strconv.ParseUint(userIdOrUsername, 10, 64)
 	if err == nil {
-		return c.InitChatFromInitializer(asInt)
+		return c.initChatFromInitializer(asInt)
 	}
-	asInt, err = c.SearchByUsername(userIdOrUsername)
+	asInt, err = c.searchByUsername(userIdOrUsername)
 	if err != nil {
 		return nil, err
 	}
-	return c.InitChatFromInitializer(asInt)
+	return c.initChatFromInitializer(asInt)
 }
 
+// DeleteChat deletes the chat with its history. Unless the other user closed it already, the chat
+// is left first, see leaveChat.
 func (c *MessengerClient) DeleteChat(chatId uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if !c.unlocked {
 		return errors.New("not unlocked")
 	}
@@ -465,14 +1152,49 @@ func (c *MessengerClient) DeleteChat(chatId uint64) error {
 	if err != nil {
 		return err
 	}
-	err = chat.Delete()
-	if err != nil {
+	if chat.MirroredFrom == 0 && chat.State != data.ChatClosed {
+		c.leaveChat(chat)
+	}
+	return c.database.DeleteChat(chat.ChatId)
+}
+
+// leaveChat closes the chat on the server and, if it was open, for the other user with a
+// chat_closed control message, so nothing more arrives in it. Errors are only logged, like the
+// replies of a notification, see afterCommit.
+func (c *MessengerClient) leaveChat(chat *data.Chat) {
+	if chatIsOpen(chat) {
+		if err := c.sendControlMessage(chat, &controlMessage{Type: controlChatClosed}); err != nil {
+			log.Printf("error telling user %d about closing chat %d: %s", chat.OtherUserId, chat.ChatId, err.Error())
+		}
+	}
+	c.afterCommit(func() {
+		if _, err := c.http.CloseChat(chat.ChatId); err != nil {
+			log.Printf("error closing chat %d on the server: %s", chat.ChatId, err.Error())
+		}
+	})
+}
+
+func (c *MessengerClient) handleChatClosed(chat *data.Chat, senderId uint64) ([]WebNotification, error) {
+	if err := c.closeChatBy(chat, senderId); err != nil {
+		return nil, err
+	}
+	return []WebNotification{&ChatClosedNotification{ChatId: chat.ChatId, UserId: senderId}}, nil
+}
+
+// closeChatBy closes a chat because the other user left it.
+func (c *MessengerClient) closeChatBy(chat *data.Chat, senderId uint64) error {
+	if senderId != chat.OtherUserId {
+		return errors.New("chat closed by a user that is not in the chat")
+	}
+	if err := transitionChat(chat, data.ChatClosed); err != nil {
 		return err
 	}
-	return nil
+	return c.database.UpdateChat(chat)
 }
 
 func (c *MessengerClient) RenameChat(chatId uint64, newName string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if !c.unlocked {
 		return errors.New("not unlocked")
 	}
@@ -481,7 +1203,7 @@ func (c *MessengerClient) RenameChat(chatId uint64, newName string) error {
 		return err
 	}
 	chat.Title = newName
-	err = chat.Update()
+	err = c.database.UpdateChat(chat)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,332 @@
+package messenger_client
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/crypto_utils"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/mock_server"
+)
+
+const testPassword = "password"
+
+func newTestServer(t *testing.T) *mock_server.Server {
+	t.Helper()
+	server, err := mock_server.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+// newTestClient signs up a client that talks to server through its loopback and keeps its history
+// in memory.
+func newTestClient(t *testing.T, server *mock_server.Server) *MessengerClient {
+	t.Helper()
+	c := NewClientWithDataDir("", t.TempDir())
+	c.UseInMemoryStore()
+	return signUpTestClient(t, server, c)
+}
+
+// newTestClientOnDisk is newTestClient with the history in the database, it survives Lock.
+func newTestClientOnDisk(t *testing.T, server *mock_server.Server) *MessengerClient {
+	t.Helper()
+	return signUpTestClient(t, server, NewClientWithDataDir("", t.TempDir()))
+}
+
+func signUpTestClient(t *testing.T, server *mock_server.Server, c *MessengerClient) *MessengerClient {
+	t.Helper()
+	c.SetTransport(server.Transport)
+	if err := c.SignUp(testPassword); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Unlock(testPassword); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Lock() })
+	return c
+}
+
+// pull pulls once and returns the notifications by type.
+func pull(t *testing.T, c *MessengerClient) map[WebNotificationType][]WebNotification {
+	t.Helper()
+	notifications, err := c.PullNotificationsAndUpdateData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byType := make(map[WebNotificationType][]WebNotification)
+	for _, n := range notifications {
+		byType[n.Type] = append(byType[n.Type], n.Notification)
+	}
+	return byType
+}
+
+// connect opens an accepted chat between a and b and returns its id.
+func connect(t *testing.T, a, b *MessengerClient) uint64 {
+	t.Helper()
+	chat, err := a.InitChatFromInitializer(b.GetUserId())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pull(t, b)
+	if _, err = b.InitChatFromReceiver(chat.ChatId); err != nil {
+		t.Fatal(err)
+	}
+	if accepted := pull(t, a)[ChatAccepted]; len(accepted) != 1 {
+		t.Fatalf("initiator got %d chat_accepted, want 1", len(accepted))
+	}
+	return chat.ChatId
+}
+
+// TestConcurrentCalls runs the exported methods from several goroutines while one client is locked
+// and unlocked again, run it with -race.
+func TestConcurrentCalls(t *testing.T) {
+	server := newTestServer(t)
+	a := newTestClient(t, server)
+	b := newTestClientOnDisk(t, server)
+	chatId := connect(t, a, b)
+
+	const rounds = 10
+	var wg sync.WaitGroup
+	var sentByB atomic.Int32
+	run := func(name string, fn func(i int) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				// b is locked from time to time
+				if err := fn(i); err != nil && err.Error() != "not unlocked" {
+					t.Errorf("%s: %s", name, err)
+					return
+				}
+			}
+		}()
+	}
+	run("a sends", func(i int) error {
+		_, err := a.SendMessage(chatId, fmt.Sprintf("from a %d", i))
+		return err
+	})
+	run("b sends", func(i int) error {
+		_, err := b.SendMessage(chatId, fmt.Sprintf("from b %d", i))
+		if err == nil {
+			sentByB.Add(1)
+		}
+		return err
+	})
+	run("a pulls", func(int) error {
+		_, err := a.PullNotificationsAndUpdateData()
+		return err
+	})
+	run("b pulls", func(int) error {
+		_, err := b.PullNotificationsAndUpdateData()
+		return err
+	})
+	run("a renames", func(i int) error {
+		return a.RenameChat(chatId, fmt.Sprintf("chat %d", i))
+	})
+	run("a gets chats", func(int) error {
+		_, err := a.GetChats()
+		return err
+	})
+	run("b gets chats", func(int) error {
+		_, err := b.GetChats()
+		return err
+	})
+	run("b locks", func(int) error {
+		if err := b.Lock(); err != nil {
+			return err
+		}
+		return b.Unlock(testPassword)
+	})
+	wg.Wait()
+
+	pull(t, a)
+	pull(t, b)
+	want := rounds + int(sentByB.Load())
+	for _, c := range []*MessengerClient{a, b} {
+		messages, err := c.GetChatMessages(chatId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(messages) != want {
+			t.Errorf("user %d has %d messages, want %d", c.GetUserId(), len(messages), want)
+		}
+	}
+}
+
+func TestEffectsWaitForCommit(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ran := 0
+	err := c.inTx(func() error {
+		c.afterCommit(func() { ran++ })
+		c.queueNotifications(&UsernameChangedNotification{UserId: 1, Username: "rolled_back"})
+		return errors.New("dropped")
+	})
+	if err == nil || ran != 0 || len(c.pending.take()) != 0 {
+		t.Fatalf("rolled back transaction: err %v, %d effects ran", err, ran)
+	}
+
+	err = c.inTx(func() error {
+		c.afterCommit(func() { ran++ })
+		c.queueNotifications(&UsernameChangedNotification{UserId: 1, Username: "committed"})
+		if ran != 0 || len(c.pending.take()) != 0 {
+			t.Error("effects ran before the commit")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued := c.pending.take(); ran != 1 || len(queued) != 1 {
+		t.Fatalf("committed transaction: %d effects ran, %d notifications queued", ran, len(queued))
+	}
+	if c.tx != nil || c.database != c.store {
+		t.Fatal("transaction still set after inTx")
+	}
+}
+
+// TestDeviceLinkAndRelay links a device, whose certificate, history and relayed texts are all sent
+// while a notification is applied.
+func TestDeviceLinkAndRelay(t *testing.T) {
+	server := newTestServer(t)
+	primary := newTestClient(t, server)
+	device := newTestClient(t, server)
+	peer := newTestClient(t, server)
+	chatId := connect(t, primary, peer)
+	if _, err := peer.SendMessage(chatId, "before the link"); err != nil {
+		t.Fatal(err)
+	}
+	pull(t, primary)
+
+	code, err := device.StartDeviceLink()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = primary.LinkDevice(code, "laptop"); err != nil {
+		t.Fatal(err)
+	}
+	pull(t, device)
+	if linked := pull(t, primary)[DeviceLinked]; len(linked) != 1 {
+		t.Fatalf("primary got %d device_linked, want 1", len(linked))
+	}
+	pull(t, device)
+	pull(t, primary)
+	pull(t, device)
+	if device.GetPrimaryUserId() != primary.GetUserId() {
+		t.Fatal("device is not linked to the primary")
+	}
+	if messages, err := device.GetChatMessages(chatId); err != nil || len(messages) != 1 {
+		t.Fatalf("device has %d mirrored messages (%v), want 1", len(messages), err)
+	}
+
+	if _, err = device.SendMessage(chatId, "from the device"); err != nil {
+		t.Fatal(err)
+	}
+	if relayed := pull(t, primary)[NewMessage]; len(relayed) != 1 {
+		t.Fatalf("primary got %d new_message for the relayed text, want 1", len(relayed))
+	}
+	received := pull(t, peer)[NewMessage]
+	if len(received) != 1 || received[0].(*NewMessageNotification).Message.Content != "from the device" {
+		t.Fatalf("peer got %v, want the relayed text", received)
+	}
+}
+
+// TestDeviceLinkStranger has a stranger request a chat with a device waiting for its primary: the
+// stranger's chat is accepted as a candidate, but only the primary's proof links the device.
+func TestDeviceLinkStranger(t *testing.T) {
+	server := newTestServer(t)
+	primary := newTestClient(t, server)
+	device := newTestClient(t, server)
+	stranger := newTestClient(t, server)
+
+	code, err := device.StartDeviceLink()
+	if err != nil {
+		t.Fatal(err)
+	}
+	strangerChat, err := stranger.InitChatFromInitializer(device.GetUserId())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pull(t, device)
+	pull(t, stranger)
+	if _, err = stranger.SendMessage(strangerChat.ChatId, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if messages := pull(t, device)[NewMessage]; len(messages) != 0 {
+		t.Fatalf("device got %d messages from the stranger before the proof, want 0", len(messages))
+	}
+
+	if err = primary.LinkDevice(code, "laptop"); err != nil {
+		t.Fatal(err)
+	}
+	pull(t, device)
+	pull(t, primary)
+	if linked := pull(t, device)[DeviceLinked]; len(linked) != 1 {
+		t.Fatalf("device got %d device_linked, want 1", len(linked))
+	}
+	if device.GetPrimaryUserId() != primary.GetUserId() {
+		t.Fatal("device is not linked to the primary")
+	}
+	if _, err = device.GetChat(strangerChat.ChatId); !errors.Is(err, data.ErrChatNotFound) {
+		t.Fatalf("stranger's chat: got %v, want ErrChatNotFound", err)
+	}
+	if closed := pull(t, stranger)[ChatClosed]; len(closed) != 1 {
+		t.Fatalf("stranger got %d chat_closed, want 1", len(closed))
+	}
+}
+
+func TestSignUpWideId(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	if version := crypto_utils.UserIdVersionOf(c.GetUserId()); version != crypto_utils.UserIdWide {
+		t.Fatalf("signed up with user id version %d, want wide", version)
+	}
+}
+
+// TestChatKeyMovedToKeyring unlocks a database with a chat from before the keyring, whose private
+// key is in its row.
+func TestChatKeyMovedToKeyring(t *testing.T) {
+	c := newTestClientOnDisk(t, newTestServer(t))
+	rsaKey, err := crypto_utils.NewRSAKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := &data.Chat{ChatId: 1, OtherUserId: 2, State: data.ChatAccepted, Accepted: true, MyRsaPrivate: crypto_utils.RsaPrivateToBytes(rsaKey)}
+	if err = c.database.SaveChat(old); err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := crypto_utils.EncryptMessage(&rsaKey.PublicKey, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second unlock loads the key from the config
+	for i := 0; i < 2; i++ {
+		if err = c.Lock(); err != nil {
+			t.Fatal(err)
+		}
+		if err = c.Unlock(testPassword); err != nil {
+			t.Fatal(err)
+		}
+		chat, err := c.database.GetChat(old.ChatId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chat.MyRsaPrivate) != 0 {
+			t.Fatal("the private key is still in the database")
+		}
+		decrypter, err := c.keys.ChatDecrypter(old.ChatId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decrypted, err := decrypter.Decrypt(encrypted); err != nil || string(decrypted) != "secret" {
+			t.Fatalf("unlock %d: decrypted %q (%v) with the chat key", i, decrypted, err)
+		}
+	}
+}
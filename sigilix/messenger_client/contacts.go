@@ -0,0 +1,173 @@
+package messenger_client
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+)
+
+// AddContact looks the user up by username and stores it with its current public keys.
+func (c *MessengerClient) AddContact(username string, nickname string) (*data.Contact, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return nil, errors.New("not unlocked")
+	}
+	search, err := c.http.SearchByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if search == nil {
+		return nil, errors.New("user not found")
+	}
+	info := search.PublicInfo
+	if _, err = c.ingestUserInfo(info, 0); err != nil {
+		return nil, err
+	}
+	contact, err := c.database.GetContact(info.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if contact == nil {
+		contact = &data.Contact{UserId: info.UserId}
+	}
+	contact.Username = info.Username
+	contact.EcdsaPublic = info.EcdsaPublicKey
+	contact.RsaPublic = info.InitialRsaPublicKey
+	if nickname != "" {
+		contact.Nickname = nickname
+	}
+	if err = c.database.SaveContact(contact); err != nil {
+		return nil, err
+	}
+	return contact, nil
+}
+
+// AddContactFromChat stores the other user of a chat, with the keys known from the chat.
+func (c *MessengerClient) AddContactFromChat(chatId uint64, nickname string) (*data.Contact, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return nil, errors.New("not unlocked")
+	}
+	chat, err := c.database.GetChat(chatId)
+	if err != nil {
+		return nil, err
+	}
+	contact, err := c.database.GetContact(chat.OtherUserId)
+	if err != nil {
+		return nil, err
+	}
+	if contact == nil {
+		contact = &data.Contact{UserId: chat.OtherUserId}
+	}
+	if chat.OtherUsername != "" {
+		contact.Username = chat.OtherUsername
+	}
+	if chat.OtherUserEcdsaPublic != nil {
+		contact.EcdsaPublic = chat.OtherUserEcdsaPublic
+		contact.RsaPublic = chat.OtherUserRsaPublic
+	}
+	if nickname != "" {
+		contact.Nickname = nickname
+	}
+	if err = c.database.SaveContact(contact); err != nil {
+		return nil, err
+	}
+	return contact, nil
+}
+
+func (c *MessengerClient) GetContacts() ([]*data.Contact, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.unlocked {
+		return nil, errors.New("not unlocked")
+	}
+	return c.database.GetContacts()
+}
+
+func (c *MessengerClient) GetContact(userId uint64) (*data.Contact, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.unlocked {
+		return nil, errors.New("not unlocked")
+	}
+	contact, err := c.database.GetContact(userId)
+	if err != nil {
+		return nil, err
+	}
+	if contact == nil {
+		return nil, errors.New("contact not found")
+	}
+	return contact, nil
+}
+
+func (c *MessengerClient) updateContact(userId uint64, update func(contact *data.Contact)) error {
+	if !c.unlocked {
+		return errors.New("not unlocked")
+	}
+	contact, err := c.database.GetContact(userId)
+	if err != nil {
+		return err
+	}
+	if contact == nil {
+		contact = &data.Contact{UserId: userId}
+	}
+	update(contact)
+	return c.database.SaveContact(contact)
+}
+
+func (c *MessengerClient) SetContactNickname(userId uint64, nickname string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.updateContact(userId, func(contact *data.Contact) {
+		contact.Nickname = nickname
+	})
+}
+
+func (c *MessengerClient) SetContactVerified(userId uint64, verified bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.updateContact(userId, func(contact *data.Contact) {
+		contact.Verified = verified
+	})
+}
+
+// SetUserBlocked blocks or unblocks a user, users that are not contacts yet are added. Chat
+// requests and messages from blocked users are dropped when notifications are pulled.
+func (c *MessengerClient) SetUserBlocked(userId uint64, blocked bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return errors.New("not unlocked")
+	}
+	if userId == c.config.UserId {
+		return errors.New("can not block yourself")
+	}
+	return c.updateContact(userId, func(contact *data.Contact) {
+		contact.Blocked = blocked
+	})
+}
+
+func (c *MessengerClient) DeleteContact(userId uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return errors.New("not unlocked")
+	}
+	return c.database.DeleteContact(userId)
+}
+
+// checkNotBlocked returns an error if userId is blocked or the lookup fails, either drops the
+// notification from userId.
+func (c *MessengerClient) checkNotBlocked(userId uint64) error {
+	blocked, err := c.database.IsBlocked(userId)
+	if err != nil {
+		return fmt.Errorf("error checking if user %d is blocked: %w", userId, err)
+	}
+	if blocked {
+		return fmt.Errorf("user %d is blocked", userId)
+	}
+	return nil
+}
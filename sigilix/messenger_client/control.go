@@ -0,0 +1,118 @@
+package messenger_client
+
+import (
+	"errors"
+	"log"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+)
+
+// Control messages are client-to-client protocol messages. They travel as PayloadControl
+// payloads inside ordinary encrypted and signed chat messages, so the server relays them like
+// any other message, and they are never stored in the messages table.
+
+type controlMessageType string
+
+const (
+	controlGroupUpdate   controlMessageType = "group_update"
+	controlSenderKey     controlMessageType = "sender_key"
+	controlGroupMessage  controlMessageType = "group_message"
+	controlReceipt       controlMessageType = "receipt"
+	controlEphemeral     controlMessageType = "ephemeral"
+	controlChatTimer     controlMessageType = "chat_timer"
+	controlDeviceLink    controlMessageType = "device_link"
+	controlDeviceSync    controlMessageType = "device_sync"
+	controlDeviceSend    controlMessageType = "device_send"
+	controlDeviceHistory controlMessageType = "device_history"
+	controlDeviceUnlink  controlMessageType = "device_unlink"
+	controlAccountClosed controlMessageType = "account_closed"
+	controlChatClosed    controlMessageType = "chat_closed"
+)
+
+type controlMessage struct {
+	Type         controlMessageType   `json:"type"`
+	GroupUpdate  *groupUpdateControl  `json:"group_update,omitempty"`
+	SenderKey    *senderKeyControl    `json:"sender_key,omitempty"`
+	GroupMessage *groupMessageControl `json:"group_message,omitempty"`
+	Receipt      *receiptControl      `json:"receipt,omitempty"`
+	Ephemeral    *ephemeralControl    `json:"ephemeral,omitempty"`
+	ChatTimer    *chatTimerControl    `json:"chat_timer,omitempty"`
+	DeviceLink   *deviceLinkControl   `json:"device_link,omitempty"`
+	DeviceSync   *deviceSyncControl   `json:"device_sync,omitempty"`
+	DeviceSend   *deviceSendControl   `json:"device_send,omitempty"`
+}
+
+// sendControlMessage sends m to the other user of chat. Replies sent while a notification is
+// applied wait for its transaction, their errors are only logged then.
+func (c *MessengerClient) sendControlMessage(chat *data.Chat, m *controlMessage) error {
+	if c.tx != nil {
+		c.afterCommit(func() {
+			if err := c.sendControlMessage(chat, m); err != nil {
+				log.Printf("error sending %s to chat %d: %s", m.Type, chat.ChatId, err.Error())
+			}
+		})
+		return nil
+	}
+	_, err := c.sendPayload(chat, &Payload{Type: PayloadControl, Control: m})
+	return err
+}
+
+func (c *MessengerClient) handleControlMessage(chat *data.Chat, senderId uint64, m *controlMessage) ([]WebNotification, error) {
+	switch m.Type {
+	case controlGroupUpdate:
+		if m.GroupUpdate == nil {
+			return nil, errors.New("empty group update")
+		}
+		return c.handleGroupUpdate(senderId, m.GroupUpdate)
+	case controlSenderKey:
+		if m.SenderKey == nil {
+			return nil, errors.New("empty sender key")
+		}
+		return nil, c.handleSenderKey(senderId, m.SenderKey)
+	case controlGroupMessage:
+		if m.GroupMessage == nil {
+			return nil, errors.New("empty group message")
+		}
+		return c.handleGroupMessage(senderId, m.GroupMessage)
+	case controlReceipt:
+		if m.Receipt == nil {
+			return nil, errors.New("empty receipt")
+		}
+		return c.handleReceipt(chat, m.Receipt)
+	case controlEphemeral:
+		if m.Ephemeral == nil {
+			return nil, errors.New("empty ephemeral signal")
+		}
+		return c.handleEphemeral(chat, senderId, m.Ephemeral)
+	case controlChatTimer:
+		if m.ChatTimer == nil {
+			return nil, errors.New("empty chat timer")
+		}
+		return c.handleChatTimer(chat, senderId, m.ChatTimer)
+	case controlDeviceLink:
+		if m.DeviceLink == nil {
+			return nil, errors.New("empty device link")
+		}
+		return c.handleDeviceLink(chat, m.DeviceLink)
+	case controlDeviceSync:
+		if m.DeviceSync == nil {
+			return nil, errors.New("empty device sync")
+		}
+		return c.handleDeviceSync(senderId, m.DeviceSync)
+	case controlDeviceSend:
+		if m.DeviceSend == nil {
+			return nil, errors.New("empty device send")
+		}
+		return c.handleDeviceSend(chat, m.DeviceSend)
+	case controlDeviceHistory:
+		return c.handleDeviceHistory(chat)
+	case controlDeviceUnlink:
+		return c.handleDeviceUnlink(chat, senderId)
+	case controlAccountClosed:
+		return c.handleAccountClosed(chat, senderId)
+	case controlChatClosed:
+		return c.handleChatClosed(chat, senderId)
+	default:
+		return nil, errors.New("unknown control message type")
+	}
+}
@@ -0,0 +1,659 @@
+package messenger_client
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/crypto_utils"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/custom_types"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+)
+
+// Multi-device: a linked device is a separate identity on the server (the server derives user ids
+// from keys), bound to the primary by a DeviceCertificate the primary signs.
+//
+//  1. the new device calls StartDeviceLink and shows the code (its user id and a secret), e.g. as QR
+//  2. the primary calls LinkDevice with the code and requests a chat with the device, which the
+//     device accepts automatically while it waits for its primary
+//  3. once accepted, the primary sends the signed certificate with an HMAC of it keyed by the
+//     secret, so the device knows the primary is the one that read its code
+//  4. the device asks for history, the primary sends its chats and messages in batches
+//
+// From then on the primary mirrors every message of its chats to each linked device, encrypted to
+// the device over the link chat, and sends the texts the devices relay to it. Devices show the
+// primary's chats as mirrored chats and never talk to the other users directly.
+
+const (
+	deviceLinkTimeout = 10 * time.Minute
+	deviceSecretSize  = 16
+	deviceSyncBatch   = 50
+	// maxLinkCandidates bounds the chats accepted while a code is shown, see claimLinkChat.
+	maxLinkCandidates = 4
+)
+
+var deviceCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+var errMirroredChat = errors.New("chat is mirrored from the primary device")
+
+type DeviceCertificate struct {
+	PrimaryUserId     uint64                   `json:"primary_user_id"`
+	DeviceUserId      uint64                   `json:"device_user_id"`
+	DeviceEcdsaPublic custom_types.Base64Bytes `json:"device_ecdsa_public"`
+	DeviceName        string                   `json:"device_name"`
+	IssuedAt          int64                    `json:"issued_at"`
+	Signature         custom_types.Base64Bytes `json:"sig,omitempty"`
+}
+
+func (d *DeviceCertificate) signedBytes() ([]byte, error) {
+	unsigned := *d
+	unsigned.Signature = nil
+	return json.Marshal(&unsigned)
+}
+
+func (d *DeviceCertificate) Sign(signer crypto_utils.Signer) error {
+	toSign, err := d.signedBytes()
+	if err != nil {
+		return err
+	}
+	d.Signature, err = signer.Sign(toSign)
+	return err
+}
+
+func (d *DeviceCertificate) Verify(key *ecdsa.PublicKey) error {
+	signed, err := d.signedBytes()
+	if err != nil {
+		return err
+	}
+	ok, err := crypto_utils.ValidateECDSASignature(key, signed, d.Signature)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("invalid device certificate signature")
+	}
+	return nil
+}
+
+type deviceLinkControl struct {
+	Certificate *DeviceCertificate `json:"certificate"`
+	// Proof is HMAC-SHA256 of the signed certificate bytes, keyed by the link code secret.
+	Proof custom_types.Base64Bytes `json:"proof"`
+}
+
+type syncedChat struct {
+	ChatId        uint64                   `json:"chat_id"`
+	OtherUserId   uint64                   `json:"other_user_id"`
+	OtherUsername string                   `json:"other_username"`
+	Title         string                   `json:"title"`
+	EcdsaPublic   custom_types.Base64Bytes `json:"ecdsa_public"`
+	RsaPublic     custom_types.Base64Bytes `json:"rsa_public"`
+}
+
+type deviceSyncControl struct {
+	Chat     *syncedChat     `json:"chat"`
+	Messages []*data.Message `json:"messages"`
+	// History is set on batches answering a history request.
+	History bool `json:"history,omitempty"`
+}
+
+type deviceSendControl struct {
+	ChatId  uint64 `json:"chat_id"`
+	Text    string `json:"text"`
+	ReplyTo uint64 `json:"reply_to,omitempty"`
+}
+
+type DeviceLinkedNotification struct {
+	PrimaryUserId uint64 `json:"primary_user_id"`
+	// DeviceUserId is set on the primary.
+	DeviceUserId uint64 `json:"device_user_id,omitempty"`
+}
+
+func (i *DeviceLinkedNotification) NotificationType() WebNotificationType { return DeviceLinked }
+
+type DeviceUnlinkedNotification struct {
+	PrimaryUserId uint64 `json:"primary_user_id"`
+}
+
+func (i *DeviceUnlinkedNotification) NotificationType() WebNotificationType { return DeviceUnlinked }
+
+// DeviceHistoryNotification is sent on a linked device for every history batch it received.
+type DeviceHistoryNotification struct {
+	ChatId   uint64 `json:"chat_id"`
+	Messages int    `json:"messages"`
+}
+
+func (i *DeviceHistoryNotification) NotificationType() WebNotificationType { return DeviceHistory }
+
+type pendingDeviceLink struct {
+	deviceUserId uint64
+	name         string
+	secret       []byte
+	expires      time.Time
+}
+
+type deviceState struct {
+	mu sync.Mutex
+	// device side: the secret of the code shown to the user, and the chats that may be the primary's
+	secret     []byte
+	expires    time.Time
+	candidates map[uint64]bool
+	// primary side: links waiting for the device to accept the chat, by chat id
+	pending map[uint64]*pendingDeviceLink
+}
+
+func newDeviceState() *deviceState {
+	return &deviceState{candidates: make(map[uint64]bool), pending: make(map[uint64]*pendingDeviceLink)}
+}
+
+func linkProof(secret []byte, certificate *DeviceCertificate) ([]byte, error) {
+	signed, err := certificate.signedBytes()
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(signed)
+	return mac.Sum(nil), nil
+}
+
+// StartDeviceLink prepares this identity to be linked to a primary device and returns the code to
+// enter there. The code is valid for deviceLinkTimeout.
+func (c *MessengerClient) StartDeviceLink() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return "", errors.New("not unlocked")
+	}
+	if c.config.PrimaryUserId != 0 {
+		return "", errors.New("already linked to a primary device")
+	}
+	devices, err := c.database.GetLinkedDevices()
+	if err != nil {
+		return "", err
+	}
+	if len(devices) > 0 {
+		return "", errors.New("this is a primary device")
+	}
+	secret := make([]byte, deviceSecretSize)
+	if _, err = rand.Read(secret); err != nil {
+		return "", err
+	}
+	c.devices.mu.Lock()
+	c.devices.secret = secret
+	c.devices.expires = time.Now().Add(deviceLinkTimeout)
+	c.devices.candidates = make(map[uint64]bool)
+	c.devices.mu.Unlock()
+
+	code := make([]byte, 8, 8+deviceSecretSize)
+	binary.BigEndian.PutUint64(code, c.config.UserId)
+	return deviceCodeEncoding.EncodeToString(append(code, secret...)), nil
+}
+
+// claimLinkChat reports whether a chat request should be accepted as a candidate for the primary's
+// link chat. The code does not say who the primary is and the server delivers nothing before the
+// chat is accepted, so up to maxLinkCandidates requests are accepted and only the one proving the
+// secret is kept, see handleDeviceLink. Nothing but the proof is taken from a candidate.
+func (c *MessengerClient) claimLinkChat(chatId uint64) bool {
+	c.devices.mu.Lock()
+	defer c.devices.mu.Unlock()
+	if c.devices.secret == nil || time.Now().After(c.devices.expires) || len(c.devices.candidates) >= maxLinkCandidates {
+		return false
+	}
+	c.devices.candidates[chatId] = true
+	return true
+}
+
+func (c *MessengerClient) isLinkCandidate(chatId uint64) bool {
+	c.devices.mu.Lock()
+	defer c.devices.mu.Unlock()
+	return c.devices.candidates[chatId]
+}
+
+// dropLinkCandidate leaves a candidate chat that did not prove the secret, see leaveChat.
+func (c *MessengerClient) dropLinkCandidate(chatId uint64) error {
+	c.devices.mu.Lock()
+	delete(c.devices.candidates, chatId)
+	c.devices.mu.Unlock()
+	chat, err := c.database.GetChat(chatId)
+	if err != nil {
+		return err
+	}
+	c.leaveChat(chat)
+	return c.database.DeleteChat(chatId)
+}
+
+// LinkDevice links the device that shows code to this identity.
+func (c *MessengerClient) LinkDevice(code string, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return errors.New("not unlocked")
+	}
+	if c.config.PrimaryUserId != 0 {
+		return errors.New("a linked device can not link other devices")
+	}
+	raw, err := deviceCodeEncoding.DecodeString(strings.ToUpper(strings.TrimSpace(code)))
+	if err != nil || len(raw) != 8+deviceSecretSize {
+		return errors.New("invalid device code")
+	}
+	deviceUserId := binary.BigEndian.Uint64(raw[:8])
+	if deviceUserId == c.config.UserId {
+		return errors.New("can not link to yourself")
+	}
+	chat, err := c.initChatFromInitializer(deviceUserId)
+	if err != nil {
+		return err
+	}
+	c.devices.mu.Lock()
+	c.devices.pending[chat.ChatId] = &pendingDeviceLink{
+		deviceUserId: deviceUserId,
+		name:         name,
+		secret:       raw[8:],
+		expires:      time.Now().Add(deviceLinkTimeout),
+	}
+	c.devices.mu.Unlock()
+	return nil
+}
+
+// completeDeviceLink sends the certificate once the device accepted the link chat. It returns nil
+// if chat is not a pending link.
+func (c *MessengerClient) completeDeviceLink(chat *data.Chat) (*data.LinkedDevice, error) {
+	c.devices.mu.Lock()
+	pending, ok := c.devices.pending[chat.ChatId]
+	delete(c.devices.pending, chat.ChatId)
+	c.devices.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	if time.Now().After(pending.expires) || chat.OtherUserId != pending.deviceUserId {
+		return nil, errors.New("device link expired")
+	}
+	certificate := &DeviceCertificate{
+		PrimaryUserId:     c.config.UserId,
+		DeviceUserId:      pending.deviceUserId,
+		DeviceEcdsaPublic: chat.OtherUserEcdsaPublic,
+		DeviceName:        pending.name,
+		IssuedAt:          time.Now().Unix(),
+	}
+	if err := certificate.Sign(c.keys); err != nil {
+		return nil, err
+	}
+	proof, err := linkProof(pending.secret, certificate)
+	if err != nil {
+		return nil, err
+	}
+	err = c.sendControlMessage(chat, &controlMessage{
+		Type:       controlDeviceLink,
+		DeviceLink: &deviceLinkControl{Certificate: certificate, Proof: proof},
+	})
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(certificate)
+	if err != nil {
+		return nil, err
+	}
+	device := &data.LinkedDevice{
+		DeviceUserId: pending.deviceUserId,
+		ChatId:       chat.ChatId,
+		Name:         pending.name,
+		Certificate:  encoded,
+		LinkedAt:     certificate.IssuedAt,
+	}
+	return device, c.database.SaveLinkedDevice(device)
+}
+
+func (c *MessengerClient) handleDeviceLink(chat *data.Chat, link *deviceLinkControl) ([]WebNotification, error) {
+	c.devices.mu.Lock()
+	secret, expires, candidate := c.devices.secret, c.devices.expires, c.devices.candidates[chat.ChatId]
+	c.devices.mu.Unlock()
+	if secret == nil || !candidate {
+		return nil, errors.New("unexpected device link")
+	}
+	certificate := link.Certificate
+	if certificate == nil {
+		return nil, errors.New("empty device certificate")
+	}
+	proof, err := linkProof(secret, certificate)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(proof, link.Proof) || time.Now().After(expires) {
+		// someone else opened the chat, the real primary may still be among the other candidates
+		log.Printf("device link proof of user %d does not match the code, leaving chat %d", chat.OtherUserId, chat.ChatId)
+		return nil, c.dropLinkCandidate(chat.ChatId)
+	}
+	primaryKey, err := chat.OtherUserEcdsaPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if err = certificate.Verify(primaryKey); err != nil {
+		return nil, err
+	}
+	if certificate.PrimaryUserId != chat.OtherUserId || certificate.DeviceUserId != c.config.UserId ||
+		!bytes.Equal(certificate.DeviceEcdsaPublic, crypto_utils.PublicECDSAKeyToBytes(c.keys.EcdsaPublicKey())) {
+		return nil, errors.New("device certificate was issued for another device")
+	}
+	encoded, err := json.Marshal(certificate)
+	if err != nil {
+		return nil, err
+	}
+	c.devices.mu.Lock()
+	delete(c.devices.candidates, chat.ChatId)
+	others := make([]uint64, 0, len(c.devices.candidates))
+	for chatId := range c.devices.candidates {
+		others = append(others, chatId)
+	}
+	c.devices.mu.Unlock()
+	for _, chatId := range others {
+		if err = c.dropLinkCandidate(chatId); err != nil {
+			return nil, err
+		}
+	}
+	// the config is not part of the transaction, it changes once the link chat is committed
+	c.afterCommit(func() {
+		c.config.PrimaryUserId = certificate.PrimaryUserId
+		c.config.DeviceCertificate = encoded
+		if err := c.saveConfig(); err != nil {
+			log.Printf("error saving the device certificate: %s", err.Error())
+		}
+		c.devices.mu.Lock()
+		crypto_utils.Wipe(c.devices.secret)
+		c.devices.secret = nil
+		c.devices.candidates = make(map[uint64]bool)
+		c.devices.mu.Unlock()
+	})
+
+	err = c.sendControlMessage(chat, &controlMessage{Type: controlDeviceHistory})
+	if err != nil {
+		log.Printf("error requesting history from the primary device: %s", err.Error())
+	}
+	return []WebNotification{&DeviceLinkedNotification{PrimaryUserId: certificate.PrimaryUserId}}, nil
+}
+
+// linkedDeviceOf returns the linked device on the other side of chat, nil if it is not a link chat.
+func (c *MessengerClient) linkedDeviceOf(chat *data.Chat) (*data.LinkedDevice, error) {
+	device, err := c.database.GetLinkedDevice(chat.OtherUserId)
+	if err != nil || device == nil || device.ChatId != chat.ChatId {
+		return nil, err
+	}
+	return device, nil
+}
+
+// isLinkChat reports whether chat carries device sync traffic rather than a conversation.
+func (c *MessengerClient) isLinkChat(chat *data.Chat) bool {
+	if c.config.PrimaryUserId != 0 && chat.OtherUserId == c.config.PrimaryUserId {
+		return true
+	}
+	if c.isLinkCandidate(chat.ChatId) {
+		return true
+	}
+	device, err := c.linkedDeviceOf(chat)
+	return err == nil && device != nil
+}
+
+func toSyncedChat(chat *data.Chat) *syncedChat {
+	return &syncedChat{
+		ChatId:        chat.ChatId,
+		OtherUserId:   chat.OtherUserId,
+		OtherUsername: chat.OtherUsername,
+		Title:         chat.Title,
+		EcdsaPublic:   chat.OtherUserEcdsaPublic,
+		RsaPublic:     chat.OtherUserRsaPublic,
+	}
+}
+
+// mirrorMessage sends a new or changed message of one of our chats to every linked device.
+func (c *MessengerClient) mirrorMessage(chat *data.Chat, message *data.Message) {
+	if c.config.PrimaryUserId != 0 || chat.MirroredFrom != 0 {
+		return
+	}
+	devices, err := c.database.GetLinkedDevices()
+	if err != nil {
+		log.Printf("error getting linked devices: %s", err.Error())
+		return
+	}
+	for _, device := range devices {
+		if device.ChatId == chat.ChatId {
+			continue
+		}
+		err = c.sendDeviceSync(device, &deviceSyncControl{Chat: toSyncedChat(chat), Messages: []*data.Message{message}})
+		if err != nil {
+			log.Printf("error mirroring message to device %d: %s", device.DeviceUserId, err.Error())
+		}
+	}
+}
+
+func (c *MessengerClient) sendDeviceSync(device *data.LinkedDevice, sync *deviceSyncControl) error {
+	linkChat, err := c.database.GetChat(device.ChatId)
+	if err != nil {
+		return err
+	}
+	return c.sendControlMessage(linkChat, &controlMessage{Type: controlDeviceSync, DeviceSync: sync})
+}
+
+func (c *MessengerClient) handleDeviceHistory(chat *data.Chat) ([]WebNotification, error) {
+	device, err := c.linkedDeviceOf(chat)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, errors.New("history request from an unlinked device")
+	}
+	chats, err := c.database.GetAllChats()
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range chats {
+		if !chatIsOpen(other) || other.MirroredFrom != 0 || c.isLinkChat(other) {
+			continue
+		}
+		messages := other.Messages
+		for len(messages) > 0 {
+			batch := messages
+			if len(batch) > deviceSyncBatch {
+				batch = batch[:deviceSyncBatch]
+			}
+			messages = messages[len(batch):]
+			err = c.sendDeviceSync(device, &deviceSyncControl{Chat: toSyncedChat(other), Messages: batch, History: true})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (c *MessengerClient) handleDeviceSync(senderId uint64, sync *deviceSyncControl) ([]WebNotification, error) {
+	if c.config.PrimaryUserId == 0 || senderId != c.config.PrimaryUserId {
+		return nil, errors.New("device sync from a user that is not our primary device")
+	}
+	if sync.Chat == nil {
+		return nil, errors.New("device sync without chat")
+	}
+	chat, err := c.database.GetChat(sync.Chat.ChatId)
+	if err == data.ErrChatNotFound {
+		chat = &data.Chat{}
+		chat.ChatId = sync.Chat.ChatId
+		chat.OtherUserId = sync.Chat.OtherUserId
+		chat.OtherUsername = sync.Chat.OtherUsername
+		chat.Title = sync.Chat.Title
+		chat.OtherUserEcdsaPublic = sync.Chat.EcdsaPublic
+		chat.OtherUserRsaPublic = sync.Chat.RsaPublic
+		chat.AmIInitiator = true
+		chat.MirroredFrom = senderId
+		if err = transitionChat(chat, data.ChatRequested); err == nil {
+			err = transitionChat(chat, data.ChatAccepted)
+		}
+		if err == nil {
+			err = c.database.SaveChat(chat)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if chat.MirroredFrom != senderId {
+		return nil, errors.New("device sync for a chat that is not mirrored")
+	}
+
+	notifications := make([]WebNotification, 0, len(sync.Messages))
+	for _, synced := range sync.Messages {
+		existing, err := c.database.GetMessage(chat.ChatId, synced.MessageId)
+		if err != nil {
+			return nil, err
+		}
+		message := &data.Message{}
+		message.MessageId = synced.MessageId
+		message.ChatId = chat.ChatId
+		message.SenderId = synced.SenderId
+		message.Content = synced.Content
+		message.ReplyTo = synced.ReplyTo
+		message.Edited = synced.Edited
+		message.Deleted = synced.Deleted
+		message.Status = synced.Status
+		message.ExpiresAt = synced.ExpiresAt
+		if existing == nil {
+			err = c.database.SaveMessage(message)
+		} else {
+			err = c.database.UpdateMessage(message)
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case sync.History:
+		case existing == nil:
+			notifications = append(notifications, &NewMessageNotification{ChatId: chat.ChatId, Message: message, SenderUsername: chat.OtherUsername})
+		case message.Deleted:
+			notifications = append(notifications, &MessageDeletedNotification{ChatId: chat.ChatId, MessageId: message.MessageId})
+		default:
+			notifications = append(notifications, &MessageEditedNotification{ChatId: chat.ChatId, Message: message})
+		}
+	}
+	if sync.History {
+		notifications = append(notifications, &DeviceHistoryNotification{ChatId: chat.ChatId, Messages: len(sync.Messages)})
+	}
+	return notifications, nil
+}
+
+// relayText asks the primary device to send text to one of its chats. The message shows up in the
+// mirrored chat once the primary syncs it back, so the returned message has no id yet.
+func (c *MessengerClient) relayText(chat *data.Chat, text string, replyTo uint64) (*data.Message, error) {
+	linkChat, err := c.database.GetAcceptedChatWithUser(chat.MirroredFrom)
+	if err != nil {
+		return nil, err
+	}
+	if linkChat == nil {
+		return nil, errors.New("no chat with the primary device")
+	}
+	err = c.sendControlMessage(linkChat, &controlMessage{
+		Type:       controlDeviceSend,
+		DeviceSend: &deviceSendControl{ChatId: chat.ChatId, Text: text, ReplyTo: replyTo},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &data.Message{
+		ChatId:   chat.ChatId,
+		SenderId: chat.MirroredFrom,
+		Content:  text,
+		ReplyTo:  replyTo,
+		Status:   data.MessageStatusSent,
+	}, nil
+}
+
+func (c *MessengerClient) handleDeviceSend(chat *data.Chat, send *deviceSendControl) ([]WebNotification, error) {
+	device, err := c.linkedDeviceOf(chat)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, errors.New("send request from an unlinked device")
+	}
+	// the text is relayed once the request is committed, it can not be unsent
+	c.afterCommit(func() {
+		message, err := c.sendText(send.ChatId, send.Text, send.ReplyTo)
+		if err != nil {
+			log.Printf("error relaying text of device %d: %s", device.DeviceUserId, err.Error())
+			return
+		}
+		c.pending.push(&NewMessageNotification{ChatId: send.ChatId, Message: message})
+	})
+	return nil, nil
+}
+
+func (c *MessengerClient) GetLinkedDevices() ([]*data.LinkedDevice, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.unlocked {
+		return nil, errors.New("not unlocked")
+	}
+	return c.database.GetLinkedDevices()
+}
+
+// GetPrimaryUserId returns the user id of the primary device, 0 if this is not a linked device.
+func (c *MessengerClient) GetPrimaryUserId() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.config == nil {
+		return 0
+	}
+	return c.config.PrimaryUserId
+}
+
+// UnlinkDevice stops mirroring to a device and tells it to drop the mirrored chats.
+func (c *MessengerClient) UnlinkDevice(deviceUserId uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return errors.New("not unlocked")
+	}
+	device, err := c.database.GetLinkedDevice(deviceUserId)
+	if err != nil {
+		return err
+	}
+	if device == nil {
+		return errors.New("device is not linked")
+	}
+	if err = c.database.DeleteLinkedDevice(deviceUserId); err != nil {
+		return err
+	}
+	linkChat, err := c.database.GetChat(device.ChatId)
+	if err != nil {
+		return err
+	}
+	if err = c.sendControlMessage(linkChat, &controlMessage{Type: controlDeviceUnlink}); err != nil {
+		log.Printf("error telling device %d about the unlink: %s", deviceUserId, err.Error())
+	}
+	return c.database.DeleteChat(linkChat.ChatId)
+}
+
+func (c *MessengerClient) handleDeviceUnlink(chat *data.Chat, senderId uint64) ([]WebNotification, error) {
+	if c.config.PrimaryUserId == 0 || senderId != c.config.PrimaryUserId {
+		return nil, errors.New("unlink from a user that is not our primary device")
+	}
+	if err := c.database.DeleteMirroredChats(senderId); err != nil {
+		return nil, err
+	}
+	if err := c.database.DeleteChat(chat.ChatId); err != nil {
+		return nil, err
+	}
+	c.afterCommit(func() {
+		c.config.PrimaryUserId = 0
+		c.config.DeviceCertificate = nil
+		if err := c.saveConfig(); err != nil {
+			log.Printf("error saving the unlinked config: %s", err.Error())
+		}
+	})
+	return []WebNotification{&DeviceUnlinkedNotification{PrimaryUserId: senderId}}, nil
+}
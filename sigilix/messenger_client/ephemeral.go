@@ -0,0 +1,226 @@
+package messenger_client
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+)
+
+// Ephemeral signals (typing, online) are control messages that only live in memory: they are
+// never written to the database, expire on the receiver after a timeout and are dropped if they
+// arrive too late to mean anything. Sending is rate-limited per chat.
+
+type ephemeralSignal string
+
+const (
+	signalTypingStarted ephemeralSignal = "typing_started"
+	signalTypingStopped ephemeralSignal = "typing_stopped"
+	signalOnline        ephemeralSignal = "online"
+)
+
+const (
+	// typingTimeout is how long a typing indicator is shown without a refresh.
+	typingTimeout = 6 * time.Second
+	// typingResendInterval limits typing_started refreshes while the user keeps typing.
+	typingResendInterval = 3 * time.Second
+	// presenceTimeout is how long a user is considered online after an online signal.
+	presenceTimeout = 3 * time.Minute
+	// presenceInterval limits how often we announce ourselves as online.
+	presenceInterval = 2 * time.Minute
+)
+
+type ephemeralControl struct {
+	Signal ephemeralSignal `json:"signal"`
+	SentAt int64           `json:"sent_at"`
+}
+
+type ChatPresence struct {
+	ChatId uint64 `json:"chat_id"`
+	UserId uint64 `json:"user_id"`
+	Typing bool   `json:"typing"`
+	Online bool   `json:"online"`
+
+	typingUntil time.Time
+	onlineUntil time.Time
+}
+
+type ephemeralState struct {
+	mu sync.Mutex
+	// received signals per chat
+	presence map[uint64]*ChatPresence
+	// last typing_started sent per chat, zero once typing_stopped was sent
+	typingSentAt     map[uint64]time.Time
+	presenceAnnounce time.Time
+}
+
+func newEphemeralState() *ephemeralState {
+	return &ephemeralState{
+		presence:     make(map[uint64]*ChatPresence),
+		typingSentAt: make(map[uint64]time.Time),
+	}
+}
+
+func (c *MessengerClient) sendEphemeral(chat *data.Chat, signal ephemeralSignal) error {
+	return c.sendControlMessage(chat, &controlMessage{
+		Type:      controlEphemeral,
+		Ephemeral: &ephemeralControl{Signal: signal, SentAt: time.Now().Unix()},
+	})
+}
+
+// SendTyping tells the other user that we started or stopped typing. Repeated calls while typing
+// are rate-limited, so the UI may call it on every key press.
+func (c *MessengerClient) SendTyping(chatId uint64, typing bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return errors.New("not unlocked")
+	}
+	chat, err := c.getAcceptedChat(chatId)
+	if err != nil {
+		return err
+	}
+
+	c.ephemeral.mu.Lock()
+	lastSent := c.ephemeral.typingSentAt[chatId]
+	signal := signalTypingStopped
+	if typing {
+		if !lastSent.IsZero() && time.Since(lastSent) < typingResendInterval {
+			c.ephemeral.mu.Unlock()
+			return nil
+		}
+		signal = signalTypingStarted
+		c.ephemeral.typingSentAt[chatId] = time.Now()
+	} else {
+		if lastSent.IsZero() {
+			c.ephemeral.mu.Unlock()
+			return nil
+		}
+		delete(c.ephemeral.typingSentAt, chatId)
+	}
+	c.ephemeral.mu.Unlock()
+
+	return c.sendEphemeral(chat, signal)
+}
+
+// AnnouncePresence sends an online signal to every accepted chat, at most once per presenceInterval.
+func (c *MessengerClient) AnnouncePresence() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.announcePresence()
+}
+
+func (c *MessengerClient) announcePresence() error {
+	if !c.unlocked {
+		return errors.New("not unlocked")
+	}
+	c.ephemeral.mu.Lock()
+	if time.Since(c.ephemeral.presenceAnnounce) < presenceInterval {
+		c.ephemeral.mu.Unlock()
+		return nil
+	}
+	c.ephemeral.presenceAnnounce = time.Now()
+	c.ephemeral.mu.Unlock()
+
+	chats, err := c.database.GetAllChats()
+	if err != nil {
+		return err
+	}
+	for _, chat := range chats {
+		if !chat.Accepted || chat.MirroredFrom != 0 {
+			continue
+		}
+		if err = c.sendEphemeral(chat, signalOnline); err != nil {
+			log.Printf("error announcing presence in chat %d: %s", chat.ChatId, err.Error())
+		}
+	}
+	return nil
+}
+
+// GetPresence returns what we currently know about the other user of a chat.
+func (c *MessengerClient) GetPresence(chatId uint64) *ChatPresence {
+	c.ephemeral.mu.Lock()
+	defer c.ephemeral.mu.Unlock()
+	presence, ok := c.ephemeral.presence[chatId]
+	if !ok {
+		return &ChatPresence{ChatId: chatId}
+	}
+	copied := *presence
+	return &copied
+}
+
+func (c *MessengerClient) handleEphemeral(chat *data.Chat, senderId uint64, ephemeral *ephemeralControl) ([]WebNotification, error) {
+	now := time.Now()
+	sentAt := time.Unix(ephemeral.SentAt, 0)
+	// the peer's clock is not trusted to extend a signal past its timeout
+	if sentAt.After(now) {
+		sentAt = now
+	}
+
+	c.ephemeral.mu.Lock()
+	defer c.ephemeral.mu.Unlock()
+	presence, ok := c.ephemeral.presence[chat.ChatId]
+	if !ok {
+		presence = &ChatPresence{ChatId: chat.ChatId, UserId: senderId}
+		c.ephemeral.presence[chat.ChatId] = presence
+	}
+
+	switch ephemeral.Signal {
+	case signalTypingStarted:
+		if now.Sub(sentAt) > typingTimeout {
+			return nil, nil
+		}
+		presence.typingUntil = sentAt.Add(typingTimeout)
+		presence.onlineUntil = sentAt.Add(presenceTimeout)
+		wasTyping, wasOnline := presence.Typing, presence.Online
+		presence.Typing, presence.Online = true, true
+		if wasTyping && wasOnline {
+			return nil, nil
+		}
+	case signalTypingStopped:
+		if !presence.Typing {
+			return nil, nil
+		}
+		presence.Typing = false
+		presence.typingUntil = time.Time{}
+	case signalOnline:
+		if now.Sub(sentAt) > presenceTimeout {
+			return nil, nil
+		}
+		presence.onlineUntil = sentAt.Add(presenceTimeout)
+		if presence.Online {
+			return nil, nil
+		}
+		presence.Online = true
+	default:
+		return nil, errors.New("unknown ephemeral signal")
+	}
+	copied := *presence
+	return []WebNotification{&PresenceNotification{Presence: &copied}}, nil
+}
+
+// expireEphemeral clears typing and online states that timed out and reports them to the UI.
+func (c *MessengerClient) expireEphemeral() []WebNotification {
+	now := time.Now()
+	c.ephemeral.mu.Lock()
+	defer c.ephemeral.mu.Unlock()
+	expired := make([]WebNotification, 0)
+	for _, presence := range c.ephemeral.presence {
+		changed := false
+		if presence.Typing && now.After(presence.typingUntil) {
+			presence.Typing = false
+			changed = true
+		}
+		if presence.Online && now.After(presence.onlineUntil) {
+			presence.Online = false
+			changed = true
+		}
+		if changed {
+			copied := *presence
+			expired = append(expired, &PresenceNotification{Presence: &copied})
+		}
+	}
+	return expired
+}
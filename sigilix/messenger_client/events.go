@@ -0,0 +1,116 @@
+package messenger_client
+
+import (
+	"fmt"
+)
+
+//go:generate go run ../../cmd/sigilix-eventsgen -o ../../frontend/wailsjs/events.d.ts
+
+// Events lists one value of every WebNotification the client sends, by PullNotificationsAndUpdateData
+// or to subscribers. cmd/sigilix-eventsgen generates the TypeScript definitions from it, a new
+// notification type has to be added here.
+var Events = []WebNotification{
+	&IncomingChatNotification{},
+	&NewMessageNotification{},
+	&ChatAcceptedNotification{},
+	&NewGroupNotification{},
+	&GroupUpdatedNotification{},
+	&NewGroupMessageNotification{},
+	&MessageStatusNotification{},
+	&MessageEditedNotification{},
+	&MessageDeletedNotification{},
+	&MessageReactionNotification{},
+	&MessagesExpiredNotification{},
+	&ChatTimerNotification{},
+	&SecurityAlertNotification{},
+	&DeviceLinkedNotification{},
+	&DeviceUnlinkedNotification{},
+	&DeviceHistoryNotification{},
+	&FileReceivedNotification{},
+	&ChatClosedNotification{},
+	&AccountClosedNotification{},
+	&KeyChangedNotification{},
+	&DecryptFailedNotification{},
+	&UsernameChangedNotification{},
+	&ConnectionStateNotification{},
+	&PresenceNotification{},
+}
+
+// KeyChangedNotification is sent when the other user of a chat rotated their RSA key.
+type KeyChangedNotification struct {
+	ChatId uint64 `json:"chat_id"`
+	UserId uint64 `json:"user_id"`
+}
+
+func (i *KeyChangedNotification) NotificationType() WebNotificationType { return KeyChanged }
+
+// DecryptFailedNotification is sent for a message or file that failed to verify or decrypt, it is
+// dropped.
+type DecryptFailedNotification struct {
+	ChatId    uint64 `json:"chat_id"`
+	MessageId uint64 `json:"message_id"`
+	SenderId  uint64 `json:"sender_id"`
+	Reason    string `json:"reason"`
+}
+
+func (i *DecryptFailedNotification) NotificationType() WebNotificationType { return DecryptFailed }
+
+// UsernameChangedNotification is sent when a user we know showed up with another username.
+type UsernameChangedNotification struct {
+	UserId      uint64 `json:"user_id"`
+	OldUsername string `json:"old_username"`
+	Username    string `json:"username"`
+}
+
+func (i *UsernameChangedNotification) NotificationType() WebNotificationType { return UsernameChanged }
+
+type ConnectionState string
+
+const (
+	ConnectionOnline  ConnectionState = "online"
+	ConnectionOffline ConnectionState = "offline"
+)
+
+// ConnectionStateNotification is sent on the first pull of a session and whenever pulling starts or
+// stops failing. Going offline is only sent to subscribers, the pull itself returns the error.
+type ConnectionStateNotification struct {
+	State ConnectionState `json:"state"`
+	Error string          `json:"error,omitempty"`
+}
+
+func (i *ConnectionStateNotification) NotificationType() WebNotificationType {
+	return ConnectionStateChanged
+}
+
+// connectionChanged records the state of the last pull, it returns the notification to send if it
+// changed and nil otherwise.
+func (c *MessengerClient) connectionChanged(state ConnectionState, err error) *ConnectionStateNotification {
+	if c.connection == state {
+		return nil
+	}
+	c.connection = state
+	notification := &ConnectionStateNotification{State: state}
+	if err != nil {
+		notification.Error = err.Error()
+	}
+	return notification
+}
+
+// decryptError is returned while applying a message or file that could not be verified or
+// decrypted, the pull reports it as decrypt_failed.
+type decryptError struct {
+	chatId    uint64
+	messageId uint64
+	senderId  uint64
+	err       error
+}
+
+func (e *decryptError) Error() string {
+	return fmt.Sprintf("error decrypting message %d in chat %d: %s", e.messageId, e.chatId, e.err.Error())
+}
+
+func (e *decryptError) Unwrap() error { return e.err }
+
+func (e *decryptError) notification() *DecryptFailedNotification {
+	return &DecryptFailedNotification{ChatId: e.chatId, MessageId: e.messageId, SenderId: e.senderId, Reason: e.err.Error()}
+}
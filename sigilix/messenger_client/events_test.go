@@ -0,0 +1,221 @@
+package messenger_client
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/crypto_utils"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/custom_types"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/http_client"
+)
+
+// TestPullEvents applies notifications of every kind through the loopback: a does something in
+// its chat with b, then b pulls.
+func TestPullEvents(t *testing.T) {
+	rotateKey := func(t *testing.T, c *MessengerClient, chatId uint64) {
+		t.Helper()
+		rsaKey, err := crypto_utils.NewRSAKeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = c.http.UpdateChatRsaKey(chatId, &rsaKey.PublicKey); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		act  func(t *testing.T, a, b *MessengerClient, chatId uint64)
+		want WebNotificationType
+		// check is called with the notifications of type want
+		check func(t *testing.T, a *MessengerClient, chatId uint64, got []WebNotification)
+	}{
+		{
+			name: "key_changed",
+			act: func(t *testing.T, a, b *MessengerClient, chatId uint64) {
+				rotateKey(t, a, chatId)
+			},
+			want: KeyChanged,
+			check: func(t *testing.T, a *MessengerClient, chatId uint64, got []WebNotification) {
+				if n := got[0].(*KeyChangedNotification); n.ChatId != chatId || n.UserId != a.GetUserId() {
+					t.Fatalf("got %+v", n)
+				}
+			},
+		},
+		{
+			name: "file_received",
+			act: func(t *testing.T, a, b *MessengerClient, chatId uint64) {
+				if _, err := a.SendFile(chatId, "text/plain", []byte("file content")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: FileReceived,
+			check: func(t *testing.T, a *MessengerClient, chatId uint64, got []WebNotification) {
+				n := got[0].(*FileReceivedNotification)
+				if n.ChatId != chatId || n.Attachment.MimeType != "text/plain" || n.Attachment.SenderId != a.GetUserId() {
+					t.Fatalf("got %+v", n)
+				}
+			},
+		},
+		{
+			name: "decrypt_failed",
+			act: func(t *testing.T, a, b *MessengerClient, chatId uint64) {
+				// b announces a key it has no private key for, so it can not read what a sends next
+				rotateKey(t, b, chatId)
+				pull(t, a)
+				if _, err := a.SendMessage(chatId, "unreadable"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: DecryptFailed,
+			check: func(t *testing.T, a *MessengerClient, chatId uint64, got []WebNotification) {
+				if n := got[0].(*DecryptFailedNotification); n.ChatId != chatId || n.SenderId != a.GetUserId() || n.Reason == "" {
+					t.Fatalf("got %+v", n)
+				}
+			},
+		},
+		{
+			name: "chat_closed",
+			act: func(t *testing.T, a, b *MessengerClient, chatId uint64) {
+				if err := a.DeleteChat(chatId); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: ChatClosed,
+			check: func(t *testing.T, a *MessengerClient, chatId uint64, got []WebNotification) {
+				if n := got[0].(*ChatClosedNotification); n.ChatId != chatId || n.UserId != a.GetUserId() {
+					t.Fatalf("got %+v", n)
+				}
+			},
+		},
+		{
+			name: "username_changed",
+			act: func(t *testing.T, a, b *MessengerClient, chatId uint64) {
+				if err := a.SetUsernameConfig("alice_renamed", true); err != nil {
+					t.Fatal(err)
+				}
+				// a second request carries the new username
+				if _, err := a.InitChatFromInitializer(b.GetUserId()); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: UsernameChanged,
+			check: func(t *testing.T, a *MessengerClient, chatId uint64, got []WebNotification) {
+				n := got[0].(*UsernameChangedNotification)
+				if n.UserId != a.GetUserId() || n.OldUsername != "alice" || n.Username != "alice_renamed" {
+					t.Fatalf("got %+v", n)
+				}
+			},
+		},
+		{
+			name: "connection_state",
+			act: func(t *testing.T, a, b *MessengerClient, chatId uint64) {
+				// the first pull of a session reports the connection
+				if err := b.Lock(); err != nil {
+					t.Fatal(err)
+				}
+				if err := b.Unlock(testPassword); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: ConnectionStateChanged,
+			check: func(t *testing.T, a *MessengerClient, chatId uint64, got []WebNotification) {
+				if n := got[0].(*ConnectionStateNotification); n.State != ConnectionOnline {
+					t.Fatalf("got %+v", n)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t)
+			a := newTestClient(t, server)
+			b := newTestClient(t, server)
+			if err := a.SetUsernameConfig("alice", true); err != nil {
+				t.Fatal(err)
+			}
+			chatId := connect(t, a, b)
+
+			tt.act(t, a, b, chatId)
+			got := pull(t, b)[tt.want]
+			if len(got) != 1 {
+				t.Fatalf("got %d %s, want 1", len(got), tt.want)
+			}
+			tt.check(t, a, chatId, got)
+		})
+	}
+}
+
+// TestDroppedNotificationHasNoEvents checks that events raised while applying a notification that
+// is then dropped do not reach the UI.
+func TestDroppedNotificationHasNoEvents(t *testing.T) {
+	server := newTestServer(t)
+	a := newTestClient(t, server)
+	b := newTestClient(t, server)
+	if err := a.SetUsernameConfig("alice", true); err != nil {
+		t.Fatal(err)
+	}
+	connect(t, a, b)
+	if err := b.SetUserBlocked(a.GetUserId(), true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.SetUsernameConfig("alice_renamed", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.InitChatFromInitializer(b.GetUserId()); err != nil {
+		t.Fatal(err)
+	}
+	if got := pull(t, b); len(got) != 0 {
+		t.Fatalf("the dropped chat request raised %v", got)
+	}
+	info, err := b.GetUserInfo(a.GetUserId())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Username != "alice" {
+		t.Fatalf("the dropped chat request cached username %q", info.Username)
+	}
+}
+
+// failingTransport fails every pull.
+type failingTransport struct {
+	http_client.Transport
+}
+
+func (failingTransport) FetchNotifications(uint32) ([]*custom_types.IncomingNotification, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestConnectionState(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	events, unsubscribe := c.Subscribe(10)
+	defer unsubscribe()
+	if got := pull(t, c)[ConnectionStateChanged]; len(got) != 1 || got[0].(*ConnectionStateNotification).State != ConnectionOnline {
+		t.Fatalf("first pull: got %v, want online", got)
+	}
+	<-events
+
+	working := c.http
+	c.http = failingTransport{working}
+	for i := 0; i < 2; i++ {
+		if _, err := c.PullNotificationsAndUpdateData(); err == nil {
+			t.Fatal("pull succeeded without a connection")
+		}
+	}
+	offline := (<-events).Notification.(*ConnectionStateNotification)
+	if offline.State != ConnectionOffline || offline.Error == "" {
+		t.Fatalf("got %+v, want offline with the error", offline)
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("got %+v after the second failed pull, want nothing", event)
+	default:
+	}
+
+	c.http = working
+	if got := pull(t, c)[ConnectionStateChanged]; len(got) != 1 || got[0].(*ConnectionStateNotification).State != ConnectionOnline {
+		t.Fatalf("pull after reconnecting: got %v, want online", got)
+	}
+}
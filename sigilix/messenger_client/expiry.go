@@ -0,0 +1,153 @@
+package messenger_client
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+)
+
+// Disappearing messages: every chat has a timer (data.Chat.MessageTtl) that both sides agree on
+// via a chat_timer control message. Text payloads carry the sender's timer in ExpiresIn, so a
+// message expires after the same time on both sides even if the timer changes meanwhile. A
+// receiver whose own timer is shorter keeps the message only that long, see incomingTtl. The
+// janitor deletes expired rows in the background, the database runs with secure_delete.
+
+const (
+	janitorInterval = 10 * time.Second
+	maxMessageTtl   = 365 * 24 * 60 * 60
+)
+
+type chatTimerControl struct {
+	Ttl uint64 `json:"ttl"`
+}
+
+type expiryState struct {
+	mu      sync.Mutex
+	running bool
+	stop    chan struct{}
+}
+
+func expiresAt(ttl uint64) int64 {
+	if ttl == 0 {
+		return 0
+	}
+	return time.Now().Unix() + int64(ttl)
+}
+
+// incomingTtl returns the timer of a received message: the shorter of the sender's and ours when
+// either is set, a sender's timer above maxMessageTtl counts as maxMessageTtl.
+func incomingTtl(sent uint64, own uint64) uint64 {
+	if sent > maxMessageTtl {
+		sent = maxMessageTtl
+	}
+	if sent == 0 || own != 0 && own < sent {
+		return own
+	}
+	return sent
+}
+
+// SetChatExpiry sets the disappearing messages timer of a chat in seconds, 0 disables it. The
+// other user is notified and applies the same timer.
+func (c *MessengerClient) SetChatExpiry(chatId uint64, ttl uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return errors.New("not unlocked")
+	}
+	if ttl > maxMessageTtl {
+		return errors.New("timer is too long")
+	}
+	chat, err := c.getAcceptedChat(chatId)
+	if err != nil {
+		return err
+	}
+	err = c.sendControlMessage(chat, &controlMessage{
+		Type:      controlChatTimer,
+		ChatTimer: &chatTimerControl{Ttl: ttl},
+	})
+	if err != nil {
+		return err
+	}
+	chat.MessageTtl = ttl
+	return c.database.UpdateChat(chat)
+}
+
+func (c *MessengerClient) GetChatExpiry(chatId uint64) (uint64, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.unlocked {
+		return 0, errors.New("not unlocked")
+	}
+	chat, err := c.database.GetChat(chatId)
+	if err != nil {
+		return 0, err
+	}
+	return chat.MessageTtl, nil
+}
+
+func (c *MessengerClient) handleChatTimer(chat *data.Chat, senderId uint64, timer *chatTimerControl) ([]WebNotification, error) {
+	if timer.Ttl > maxMessageTtl {
+		return nil, errors.New("timer is too long")
+	}
+	chat.MessageTtl = timer.Ttl
+	if err := c.database.UpdateChat(chat); err != nil {
+		return nil, err
+	}
+	return []WebNotification{&ChatTimerNotification{ChatId: chat.ChatId, UserId: senderId, Ttl: timer.Ttl}}, nil
+}
+
+func (c *MessengerClient) startJanitor() {
+	c.expiry.mu.Lock()
+	defer c.expiry.mu.Unlock()
+	if c.expiry.running {
+		return
+	}
+	c.expiry.running = true
+	stop := make(chan struct{})
+	c.expiry.stop = stop
+	go func() {
+		ticker := time.NewTicker(janitorInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.pending.push(c.deleteExpiredMessages()...)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (c *MessengerClient) stopJanitor() {
+	c.expiry.mu.Lock()
+	defer c.expiry.mu.Unlock()
+	if !c.expiry.running {
+		return
+	}
+	close(c.expiry.stop)
+	c.expiry.running = false
+	c.expiry.stop = nil
+}
+
+func (c *MessengerClient) deleteExpiredMessages() []WebNotification {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// the tick may have waited for a Lock
+	if !c.unlocked {
+		return nil
+	}
+	expired, err := c.database.DeleteExpiredMessages(time.Now().Unix())
+	if err != nil {
+		log.Printf("error deleting expired messages: %s", err.Error())
+		return nil
+	}
+	notifications := make([]WebNotification, 0, len(expired))
+	for chatId, messageIds := range expired {
+		notifications = append(notifications, &MessagesExpiredNotification{ChatId: chatId, MessageIds: messageIds})
+	}
+	return notifications
+}
@@ -0,0 +1,72 @@
+package messenger_client
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestIncomingTtl(t *testing.T) {
+	tests := []struct {
+		sent, own, want uint64
+	}{
+		{0, 0, 0},
+		{60, 0, 60},
+		{0, 60, 60},
+		{60, 30, 30},
+		{30, 60, 30},
+		{math.MaxUint64, 0, maxMessageTtl},
+		{math.MaxUint64, 60, 60},
+	}
+	for _, tt := range tests {
+		if got := incomingTtl(tt.sent, tt.own); got != tt.want {
+			t.Errorf("incomingTtl(%d, %d) = %d, want %d", tt.sent, tt.own, got, tt.want)
+		}
+	}
+}
+
+// TestReceivedExpiry sends texts whose timers do not match the receiver's through the loopback.
+func TestReceivedExpiry(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresIn uint64
+		ownTtl    uint64
+		want      uint64
+	}{
+		{name: "too long", expiresIn: math.MaxUint64, want: maxMessageTtl},
+		{name: "only the receiver's timer", ownTtl: 60, want: 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t)
+			a := newTestClient(t, server)
+			b := newTestClient(t, server)
+			chatId := connect(t, a, b)
+			own, err := b.database.GetChat(chatId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			own.MessageTtl = tt.ownTtl
+			if err = b.database.UpdateChat(own); err != nil {
+				t.Fatal(err)
+			}
+
+			chat, err := a.database.GetChat(chatId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = a.sendPayload(chat, &Payload{Type: PayloadText, Text: "expiring", ExpiresIn: tt.expiresIn}); err != nil {
+				t.Fatal(err)
+			}
+			sent := time.Now().Unix()
+			received := pull(t, b)[NewMessage]
+			if len(received) != 1 {
+				t.Fatalf("got %d new_message, want 1", len(received))
+			}
+			expires := received[0].(*NewMessageNotification).Message.ExpiresAt
+			if expires < sent+int64(tt.want) || expires > time.Now().Unix()+int64(tt.want) {
+				t.Fatalf("message expires at %d, want %d seconds after %d", expires, tt.want, sent)
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package messenger_client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/custom_types"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+)
+
+// Exports are written unencrypted, with 0600 permissions. JSON and HTML exports embed attachments,
+// a text export writes them next to the transcript, into <name>_files.
+
+type ExportFormat string
+
+const (
+	ExportJson ExportFormat = "json"
+	ExportHtml ExportFormat = "html"
+	ExportText ExportFormat = "text"
+)
+
+func (f ExportFormat) extension() (string, error) {
+	switch f {
+	case ExportJson:
+		return ".json", nil
+	case ExportHtml:
+		return ".html", nil
+	case ExportText:
+		return ".txt", nil
+	}
+	return "", fmt.Errorf("unknown export format %q", f)
+}
+
+type ChatExport struct {
+	ExportedAt int64         `json:"exported_at"`
+	UserId     uint64        `json:"user_id"`
+	Chat       *ExportedChat `json:"chat"`
+	// Messages holds the messages and attachments of the chat, ordered by message id.
+	Messages []*ExportedMessage `json:"messages"`
+}
+
+type ExportedChat struct {
+	ChatId        uint64 `json:"chat_id"`
+	OtherUserId   uint64 `json:"other_user_id"`
+	OtherUsername string `json:"other_username,omitempty"`
+	Title         string `json:"title"`
+}
+
+type ExportedMessage struct {
+	MessageId  uint64              `json:"message_id"`
+	SenderId   uint64              `json:"sender_id"`
+	Sender     string              `json:"sender"`
+	FromMe     bool                `json:"from_me"`
+	Content    string              `json:"content,omitempty"`
+	ReplyTo    uint64              `json:"reply_to,omitempty"`
+	Edited     bool                `json:"edited,omitempty"`
+	Deleted    bool                `json:"deleted,omitempty"`
+	Status     data.MessageStatus  `json:"status,omitempty"`
+	Reactions  []*data.Reaction    `json:"reactions,omitempty"`
+	Attachment *ExportedAttachment `json:"attachment,omitempty"`
+}
+
+type ExportedAttachment struct {
+	MimeType string                   `json:"mime_type"`
+	Size     int                      `json:"size"`
+	Content  custom_types.Base64Bytes `json:"content,omitempty"`
+	// File is the path of the attachment relative to a text export.
+	File string `json:"file,omitempty"`
+}
+
+// ExportChat writes the history of a chat to path.
+func (c *MessengerClient) ExportChat(chatId uint64, format ExportFormat, path string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.unlocked {
+		return errors.New("not unlocked")
+	}
+	if _, err := format.extension(); err != nil {
+		return err
+	}
+	chat, err := c.database.GetChat(chatId)
+	if err != nil {
+		return err
+	}
+	export, err := c.buildExport(chat)
+	if err != nil {
+		return err
+	}
+	return writeExport(export, format, path)
+}
+
+// ExportAllChats writes every chat to dir, one chat_<id> file per chat, and returns the paths.
+func (c *MessengerClient) ExportAllChats(format ExportFormat, dir string) ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.unlocked {
+		return nil, errors.New("not unlocked")
+	}
+	extension, err := format.extension()
+	if err != nil {
+		return nil, err
+	}
+	chats, err := c.getChats()
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(chats))
+	for _, chat := range chats {
+		export, err := c.buildExport(chat)
+		if err != nil {
+			return paths, err
+		}
+		path := filepath.Join(dir, fmt.Sprintf("chat_%d%s", chat.ChatId, extension))
+		if err = writeExport(export, format, path); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func (c *MessengerClient) buildExport(chat *data.Chat) (*ChatExport, error) {
+	other := chat.OtherUsername
+	contact, err := c.database.GetContact(chat.OtherUserId)
+	if err != nil {
+		return nil, err
+	}
+	if contact != nil && contact.DisplayName() != "" {
+		other = contact.DisplayName()
+	}
+	if other == "" {
+		other = fmt.Sprint(chat.OtherUserId)
+	}
+	me := c.config.Username
+	if me == "" {
+		me = "me"
+	}
+	senderName := func(senderId uint64) string {
+		if senderId == c.config.UserId {
+			return me
+		}
+		if senderId == chat.OtherUserId {
+			return other
+		}
+		return fmt.Sprint(senderId)
+	}
+
+	export := &ChatExport{
+		ExportedAt: time.Now().Unix(),
+		UserId:     c.config.UserId,
+		Chat: &ExportedChat{
+			ChatId:        chat.ChatId,
+			OtherUserId:   chat.OtherUserId,
+			OtherUsername: chat.OtherUsername,
+			Title:         chat.Title,
+		},
+	}
+	for _, message := range chat.Messages {
+		export.Messages = append(export.Messages, &ExportedMessage{
+			MessageId: message.MessageId,
+			SenderId:  message.SenderId,
+			Sender:    senderName(message.SenderId),
+			FromMe:    message.SenderId == c.config.UserId,
+			Content:   message.Content,
+			ReplyTo:   message.ReplyTo,
+			Edited:    message.Edited,
+			Deleted:   message.Deleted,
+			Status:    message.Status,
+			Reactions: message.Reactions,
+		})
+	}
+	attachments, err := c.database.GetAttachments(chat.ChatId)
+	if err != nil {
+		return nil, err
+	}
+	for _, listed := range attachments {
+		attachment, err := c.database.GetAttachment(chat.ChatId, listed.MessageId)
+		if err != nil {
+			return nil, err
+		}
+		export.Messages = append(export.Messages, &ExportedMessage{
+			MessageId: attachment.MessageId,
+			SenderId:  attachment.SenderId,
+			Sender:    senderName(attachment.SenderId),
+			FromMe:    attachment.SenderId == c.config.UserId,
+			Attachment: &ExportedAttachment{
+				MimeType: attachment.MimeType,
+				Size:     attachment.Size,
+				Content:  attachment.Content,
+			},
+		})
+	}
+	sort.Slice(export.Messages, func(i, j int) bool {
+		return export.Messages[i].MessageId < export.Messages[j].MessageId
+	})
+	return export, nil
+}
+
+func writeExport(export *ChatExport, format ExportFormat, path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case ExportJson:
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(export)
+	case ExportHtml:
+		err = htmlExportTemplate.Execute(f, export)
+	case ExportText:
+		err = writeTextExport(f, export, path)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func writeTextExport(f *os.File, export *ChatExport, path string) error {
+	filesDir := strings.TrimSuffix(path, filepath.Ext(path)) + "_files"
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\nexported %s\n\n", export.Chat.Title, time.Unix(export.ExportedAt, 0).Format(time.RFC3339))
+	for _, message := range export.Messages {
+		fmt.Fprintf(&b, "[#%d] %s:", message.MessageId, message.Sender)
+		if message.ReplyTo != 0 {
+			fmt.Fprintf(&b, " (reply to #%d)", message.ReplyTo)
+		}
+		switch {
+		case message.Attachment != nil:
+			if err := os.MkdirAll(filesDir, 0700); err != nil {
+				return err
+			}
+			name := fmt.Sprintf("%d%s", message.MessageId, attachmentExtension(message.Attachment.MimeType))
+			err := os.WriteFile(filepath.Join(filesDir, name), message.Attachment.Content, 0600)
+			if err != nil {
+				return err
+			}
+			message.Attachment.File = filepath.Join(filepath.Base(filesDir), name)
+			fmt.Fprintf(&b, " <file %s, %s, %d bytes>", message.Attachment.File, message.Attachment.MimeType, message.Attachment.Size)
+		case message.Deleted:
+			b.WriteString(" <deleted>")
+		default:
+			b.WriteString(" " + message.Content)
+			if message.Edited {
+				b.WriteString(" (edited)")
+			}
+		}
+		b.WriteString("\n")
+	}
+	_, err := f.WriteString(b.String())
+	return err
+}
+
+var safeMimeType = regexp.MustCompile(`^[a-zA-Z0-9.+-]+/[a-zA-Z0-9.+-]+$`)
+
+// the mime type comes from the sender, anything unusual is exported as plain bytes
+func sanitizeMimeType(mimeType string) string {
+	if !safeMimeType.MatchString(mimeType) {
+		return "application/octet-stream"
+	}
+	return strings.ToLower(mimeType)
+}
+
+func attachmentExtension(mimeType string) string {
+	extensions, err := mime.ExtensionsByType(sanitizeMimeType(mimeType))
+	if err != nil || len(extensions) == 0 {
+		return ".bin"
+	}
+	return extensions[0]
+}
+
+var inlineImageTypes = map[string]bool{"image/png": true, "image/jpeg": true, "image/gif": true, "image/webp": true}
+
+var htmlExportTemplate = template.Must(template.New("export").Funcs(template.FuncMap{
+	"dataUrl": func(a *ExportedAttachment) template.URL {
+		return template.URL("data:" + sanitizeMimeType(a.MimeType) + ";base64," + base64.StdEncoding.EncodeToString(a.Content))
+	},
+	"isImage": func(a *ExportedAttachment) bool {
+		return inlineImageTypes[sanitizeMimeType(a.MimeType)]
+	},
+	"fileName": func(m *ExportedMessage) string {
+		return fmt.Sprintf("%d%s", m.MessageId, attachmentExtension(m.Attachment.MimeType))
+	},
+	"date": func(unix int64) string {
+		return time.Unix(unix, 0).Format(time.RFC3339)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="Content-Security-Policy" content="default-src 'none'; img-src data:; style-src 'unsafe-inline'">
+<title>{{.Chat.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 48em; margin: 2em auto; color: #222; }
+.message { margin: .5em 0; padding: .5em .75em; border-radius: .5em; background: #f0f0f0; white-space: pre-wrap; }
+.me { background: #dcecff; }
+.meta { font-size: .8em; color: #666; }
+.deleted { font-style: italic; color: #888; }
+img { max-width: 100%; }
+</style>
+</head>
+<body>
+<h1>{{.Chat.Title}}</h1>
+<p class="meta">exported {{date .ExportedAt}}</p>
+{{range .Messages}}<div class="message{{if .FromMe}} me{{end}}" id="m{{.MessageId}}">
+<div class="meta">#{{.MessageId}} {{.Sender}}{{if .ReplyTo}}, reply to <a href="#m{{.ReplyTo}}">#{{.ReplyTo}}</a>{{end}}{{if .Edited}}, edited{{end}}</div>
+{{if .Attachment}}{{if isImage .Attachment}}<img src="{{dataUrl .Attachment}}" alt="{{.Attachment.MimeType}}">{{else}}<a download="{{fileName .}}" href="{{dataUrl .Attachment}}">{{fileName .}}</a> ({{.Attachment.MimeType}}, {{.Attachment.Size}} bytes){{end}}
+{{else if .Deleted}}<div class="deleted">deleted</div>
+{{else}}<div>{{.Content}}</div>
+{{end}}{{range .Reactions}}<span class="meta">{{.Reaction}} </span>{{end}}</div>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,552 @@
+package messenger_client
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/crypto_utils"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+)
+
+// Group chats are built on top of 1:1 chats, the server never learns about them. Every member
+// owns a sender key (see crypto_utils.SenderKeyEncrypt) that it sends to the other members over
+// their pairwise chats. A group message is encrypted once with the sender key and the resulting
+// ciphertext is fanned out over the pairwise chats. Only the owner may change the membership;
+// when somebody is removed every remaining member rotates its sender key. A message that arrives
+// after a later one of the same sender is decrypted with the key kept for its iteration, see
+// keepSkippedKeys.
+//
+// Members can only be reached through an accepted 1:1 chat, so the owner has to share a chat
+// with everybody it adds, and messages to members we have no chat with are skipped.
+
+type groupUpdateControl struct {
+	GroupId string   `json:"group_id"`
+	Title   string   `json:"title"`
+	OwnerId uint64   `json:"owner_id"`
+	Members []uint64 `json:"members"`
+}
+
+type senderKeyControl struct {
+	GroupId   string `json:"group_id"`
+	ChainKey  []byte `json:"chain_key"`
+	Iteration uint32 `json:"iteration"`
+}
+
+type groupMessageControl struct {
+	GroupId    string `json:"group_id"`
+	Iteration  uint32 `json:"iteration"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func newGroupId() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// groupMessageAdditionalData binds a group ciphertext to its group and sender.
+func groupMessageAdditionalData(groupId string, senderId uint64) []byte {
+	ad := make([]byte, 8, 8+len(groupId))
+	binary.BigEndian.PutUint64(ad, senderId)
+	return append(ad, groupId...)
+}
+
+func groupMemberIds(group *data.Group) []uint64 {
+	ids := make([]uint64, 0, len(group.Members))
+	for _, member := range group.Members {
+		ids = append(ids, member.UserId)
+	}
+	return ids
+}
+
+// sendToGroupMembers sends a control message to every given member except ourselves and
+// returns the ids of the members that could not be reached.
+func (c *MessengerClient) sendToGroupMembers(userIds []uint64, m *controlMessage) []uint64 {
+	unreachable := make([]uint64, 0)
+	for _, userId := range userIds {
+		if userId == c.config.UserId {
+			continue
+		}
+		chat, err := c.database.GetAcceptedChatWithUser(userId)
+		if err == nil && chat == nil {
+			err = errors.New("no accepted chat")
+		}
+		if err == nil {
+			err = c.sendControlMessage(chat, m)
+		}
+		if err != nil {
+			log.Printf("can not reach group member %d: %s", userId, err.Error())
+			unreachable = append(unreachable, userId)
+		}
+	}
+	return unreachable
+}
+
+func (c *MessengerClient) distributeSenderKey(group *data.Group, userIds []uint64) {
+	c.sendToGroupMembers(userIds, &controlMessage{
+		Type: controlSenderKey,
+		SenderKey: &senderKeyControl{
+			GroupId:   group.GroupId,
+			ChainKey:  group.MyChainKey,
+			Iteration: group.MyIteration,
+		},
+	})
+}
+
+func (c *MessengerClient) sendGroupUpdate(group *data.Group, to []uint64) []uint64 {
+	return c.sendToGroupMembers(to, &controlMessage{
+		Type: controlGroupUpdate,
+		GroupUpdate: &groupUpdateControl{
+			GroupId: group.GroupId,
+			Title:   group.Title,
+			OwnerId: group.OwnerId,
+			Members: groupMemberIds(group),
+		},
+	})
+}
+
+// rotateSenderKey replaces our sender key, so that removed members can not read new messages.
+func (c *MessengerClient) rotateSenderKey(group *data.Group) error {
+	chainKey, err := crypto_utils.NewSenderChainKey()
+	if err != nil {
+		return err
+	}
+	group.MyChainKey = chainKey
+	group.MyIteration = 0
+	return c.database.SaveGroup(group)
+}
+
+func (c *MessengerClient) getOwnedGroup(groupId string) (*data.Group, error) {
+	group, err := c.database.GetGroup(groupId)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return nil, errors.New("group not found")
+	}
+	if group.Left {
+		return nil, errors.New("not a member of the group")
+	}
+	if group.OwnerId != c.config.UserId {
+		return nil, errors.New("only the group owner can change members")
+	}
+	return group, nil
+}
+
+func (c *MessengerClient) CreateGroup(title string, memberIds []uint64) (*data.Group, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return nil, errors.New("not unlocked")
+	}
+	for _, userId := range memberIds {
+		chat, err := c.database.GetAcceptedChatWithUser(userId)
+		if err != nil {
+			return nil, err
+		}
+		if chat == nil {
+			return nil, fmt.Errorf("no accepted chat with user %d", userId)
+		}
+	}
+	groupId, err := newGroupId()
+	if err != nil {
+		return nil, err
+	}
+	chainKey, err := crypto_utils.NewSenderChainKey()
+	if err != nil {
+		return nil, err
+	}
+	group := &data.Group{
+		GroupId:    groupId,
+		Title:      title,
+		OwnerId:    c.config.UserId,
+		MyChainKey: chainKey,
+		Members:    []*data.GroupMember{{GroupId: groupId, UserId: c.config.UserId}},
+	}
+	for _, userId := range memberIds {
+		if group.Member(userId) == nil {
+			group.Members = append(group.Members, &data.GroupMember{GroupId: groupId, UserId: userId})
+		}
+	}
+	err = c.database.SaveGroup(group)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range group.Members {
+		if err = c.database.SaveGroupMember(member); err != nil {
+			return nil, err
+		}
+	}
+
+	c.sendGroupUpdate(group, groupMemberIds(group))
+	c.distributeSenderKey(group, groupMemberIds(group))
+	return group, nil
+}
+
+func (c *MessengerClient) GetGroups() ([]*data.Group, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.unlocked {
+		return nil, errors.New("not unlocked")
+	}
+	return c.database.GetGroups()
+}
+
+func (c *MessengerClient) GetGroup(groupId string) (*data.Group, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.unlocked {
+		return nil, errors.New("not unlocked")
+	}
+	return c.database.GetGroup(groupId)
+}
+
+func (c *MessengerClient) GetGroupMessages(groupId string) ([]*data.GroupMessage, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.unlocked {
+		return nil, errors.New("not unlocked")
+	}
+	return c.database.GetGroupMessages(groupId)
+}
+
+func (c *MessengerClient) SendGroupMessage(groupId string, text string) (*data.GroupMessage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return nil, errors.New("not unlocked")
+	}
+	group, err := c.database.GetGroup(groupId)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return nil, errors.New("group not found")
+	}
+	if group.Left {
+		return nil, errors.New("not a member of the group")
+	}
+
+	iteration := group.MyIteration
+	ciphertext, nextChainKey, err := crypto_utils.SenderKeyEncrypt(group.MyChainKey, []byte(text), groupMessageAdditionalData(groupId, c.config.UserId))
+	if err != nil {
+		return nil, err
+	}
+	group.MyChainKey = nextChainKey
+	group.MyIteration++
+	// the chain is advanced before sending, a message key must never be used twice
+	err = c.database.SaveGroup(group)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := groupMemberIds(group)
+	unreachable := c.sendToGroupMembers(recipients, &controlMessage{
+		Type: controlGroupMessage,
+		GroupMessage: &groupMessageControl{
+			GroupId:    groupId,
+			Iteration:  iteration,
+			Ciphertext: ciphertext,
+		},
+	})
+	if len(recipients) > 1 && len(unreachable) == len(recipients)-1 {
+		return nil, errors.New("no group member could be reached")
+	}
+
+	message := &data.GroupMessage{
+		GroupId:   groupId,
+		SenderId:  c.config.UserId,
+		Iteration: iteration,
+		Content:   text,
+	}
+	err = c.database.SaveGroupMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+func (c *MessengerClient) AddGroupMember(groupId string, userId uint64) (*data.Group, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return nil, errors.New("not unlocked")
+	}
+	group, err := c.getOwnedGroup(groupId)
+	if err != nil {
+		return nil, err
+	}
+	if group.Member(userId) != nil {
+		return nil, errors.New("already a member")
+	}
+	chat, err := c.database.GetAcceptedChatWithUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	if chat == nil {
+		return nil, fmt.Errorf("no accepted chat with user %d", userId)
+	}
+	member := &data.GroupMember{GroupId: groupId, UserId: userId}
+	err = c.database.SaveGroupMember(member)
+	if err != nil {
+		return nil, err
+	}
+	group.Members = append(group.Members, member)
+
+	c.sendGroupUpdate(group, groupMemberIds(group))
+	c.distributeSenderKey(group, []uint64{userId})
+	return group, nil
+}
+
+func (c *MessengerClient) RemoveGroupMember(groupId string, userId uint64) (*data.Group, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return nil, errors.New("not unlocked")
+	}
+	group, err := c.getOwnedGroup(groupId)
+	if err != nil {
+		return nil, err
+	}
+	if userId == c.config.UserId {
+		return nil, errors.New("the owner can not be removed")
+	}
+	if group.Member(userId) == nil {
+		return nil, errors.New("not a member")
+	}
+	err = c.database.DeleteGroupMember(groupId, userId)
+	if err != nil {
+		return nil, err
+	}
+	remaining := make([]*data.GroupMember, 0, len(group.Members))
+	for _, member := range group.Members {
+		if member.UserId != userId {
+			remaining = append(remaining, member)
+		}
+	}
+	group.Members = remaining
+
+	// the removed member gets the update too, so that it knows it has left
+	c.sendGroupUpdate(group, append(groupMemberIds(group), userId))
+	err = c.rotateSenderKey(group)
+	if err != nil {
+		return nil, err
+	}
+	c.distributeSenderKey(group, groupMemberIds(group))
+	return group, nil
+}
+
+func (c *MessengerClient) handleGroupUpdate(senderId uint64, update *groupUpdateControl) ([]WebNotification, error) {
+	isMember := false
+	for _, userId := range update.Members {
+		if userId == c.config.UserId {
+			isMember = true
+		}
+	}
+
+	group, err := c.database.GetGroup(update.GroupId)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		if update.OwnerId != senderId {
+			return nil, errors.New("group update for a new group not sent by its owner")
+		}
+		if !isMember {
+			return nil, nil
+		}
+		chainKey, err := crypto_utils.NewSenderChainKey()
+		if err != nil {
+			return nil, err
+		}
+		group = &data.Group{
+			GroupId:    update.GroupId,
+			Title:      update.Title,
+			OwnerId:    update.OwnerId,
+			MyChainKey: chainKey,
+		}
+		err = c.database.SaveGroup(group)
+		if err != nil {
+			return nil, err
+		}
+		for _, userId := range update.Members {
+			member := &data.GroupMember{GroupId: group.GroupId, UserId: userId}
+			if err = c.database.SaveGroupMember(member); err != nil {
+				return nil, err
+			}
+			group.Members = append(group.Members, member)
+		}
+		c.distributeSenderKey(group, update.Members)
+		return []WebNotification{&NewGroupNotification{Group: group}}, nil
+	}
+
+	if group.OwnerId != senderId || update.OwnerId != group.OwnerId {
+		return nil, errors.New("group update not sent by the group owner")
+	}
+	group.Title = update.Title
+	if !isMember {
+		group.Left = true
+		err = c.database.SaveGroup(group)
+		if err != nil {
+			return nil, err
+		}
+		return []WebNotification{&GroupUpdatedNotification{Group: group}}, nil
+	}
+
+	newMembers := make(map[uint64]bool, len(update.Members))
+	for _, userId := range update.Members {
+		newMembers[userId] = true
+	}
+	removedAny := false
+	kept := make([]*data.GroupMember, 0, len(group.Members))
+	for _, member := range group.Members {
+		if newMembers[member.UserId] {
+			kept = append(kept, member)
+			continue
+		}
+		removedAny = true
+		if err = c.database.DeleteGroupMember(group.GroupId, member.UserId); err != nil {
+			return nil, err
+		}
+	}
+	group.Members = kept
+	added := make([]uint64, 0)
+	for _, userId := range update.Members {
+		if group.Member(userId) != nil {
+			continue
+		}
+		member := &data.GroupMember{GroupId: group.GroupId, UserId: userId}
+		if err = c.database.SaveGroupMember(member); err != nil {
+			return nil, err
+		}
+		group.Members = append(group.Members, member)
+		added = append(added, userId)
+	}
+
+	if removedAny {
+		if err = c.rotateSenderKey(group); err != nil {
+			return nil, err
+		}
+		c.distributeSenderKey(group, groupMemberIds(group))
+	} else {
+		err = c.database.SaveGroup(group)
+		if err != nil {
+			return nil, err
+		}
+		c.distributeSenderKey(group, added)
+	}
+	return []WebNotification{&GroupUpdatedNotification{Group: group}}, nil
+}
+
+func (c *MessengerClient) handleSenderKey(senderId uint64, senderKey *senderKeyControl) error {
+	if len(senderKey.ChainKey) != crypto_utils.SenderChainKeySize {
+		return errors.New("invalid sender key")
+	}
+	group, err := c.database.GetGroup(senderKey.GroupId)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		return errors.New("sender key for unknown group")
+	}
+	member := group.Member(senderId)
+	if member == nil {
+		return errors.New("sender key from a non-member")
+	}
+	member.ChainKey = senderKey.ChainKey
+	member.Iteration = senderKey.Iteration
+	// the keys of the old chain can not be told apart from the new iterations
+	member.SkippedKeys = nil
+	return c.database.SaveGroupMember(member)
+}
+
+// keepSkippedKeys adds the message keys of skipped iterations to member, only the latest
+// crypto_utils.MaxSenderKeySkip of them are kept.
+func keepSkippedKeys(member *data.GroupMember, skipped map[uint32][]byte) {
+	if len(skipped) == 0 {
+		return
+	}
+	if member.SkippedKeys == nil {
+		member.SkippedKeys = make(map[uint32][]byte, len(skipped))
+	}
+	for iteration, key := range skipped {
+		member.SkippedKeys[iteration] = key
+	}
+	if len(member.SkippedKeys) <= crypto_utils.MaxSenderKeySkip {
+		return
+	}
+	iterations := make([]uint32, 0, len(member.SkippedKeys))
+	for iteration := range member.SkippedKeys {
+		iterations = append(iterations, iteration)
+	}
+	sort.Slice(iterations, func(i, j int) bool { return iterations[i] < iterations[j] })
+	for _, iteration := range iterations[:len(iterations)-crypto_utils.MaxSenderKeySkip] {
+		delete(member.SkippedKeys, iteration)
+	}
+}
+
+func (c *MessengerClient) handleGroupMessage(senderId uint64, groupMessage *groupMessageControl) ([]WebNotification, error) {
+	group, err := c.database.GetGroup(groupMessage.GroupId)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil || group.Left {
+		return nil, errors.New("message for unknown group")
+	}
+	member := group.Member(senderId)
+	if member == nil {
+		return nil, errors.New("group message from a non-member")
+	}
+	if member.ChainKey == nil {
+		return nil, errors.New("no sender key for group member")
+	}
+	additionalData := groupMessageAdditionalData(group.GroupId, senderId)
+	var plaintext []byte
+	if groupMessage.Iteration < member.Iteration {
+		// a late message, its key was kept when a later one arrived
+		messageKey, ok := member.SkippedKeys[groupMessage.Iteration]
+		if !ok {
+			return nil, errors.New("group message iteration is in the past")
+		}
+		plaintext, err = crypto_utils.SenderKeyDecryptSkipped(messageKey, groupMessage.Ciphertext, additionalData)
+		if err != nil {
+			return nil, err
+		}
+		delete(member.SkippedKeys, groupMessage.Iteration)
+	} else {
+		var nextChainKey []byte
+		var skipped map[uint32][]byte
+		plaintext, nextChainKey, skipped, err = crypto_utils.SenderKeyDecryptSkipping(
+			member.ChainKey, member.Iteration, groupMessage.Iteration, groupMessage.Ciphertext, additionalData,
+		)
+		if err != nil {
+			return nil, err
+		}
+		member.ChainKey = nextChainKey
+		member.Iteration = groupMessage.Iteration + 1
+		keepSkippedKeys(member, skipped)
+	}
+	err = c.database.SaveGroupMember(member)
+	if err != nil {
+		return nil, err
+	}
+
+	message := &data.GroupMessage{
+		GroupId:   group.GroupId,
+		SenderId:  senderId,
+		Iteration: groupMessage.Iteration,
+		Content:   string(plaintext),
+	}
+	err = c.database.SaveGroupMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	return []WebNotification{&NewGroupMessageNotification{GroupId: group.GroupId, Message: message}}, nil
+}
@@ -0,0 +1,67 @@
+package messenger_client
+
+import (
+	"testing"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/crypto_utils"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+)
+
+// TestLateGroupMessage delivers the messages of a sender out of order.
+func TestLateGroupMessage(t *testing.T) {
+	c := newTestClient(t, newTestServer(t))
+	const senderId = 2
+	chainKey, err := crypto_utils.NewSenderChainKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := &data.Group{GroupId: "group", OwnerId: senderId, MyChainKey: chainKey}
+	if err = c.database.SaveGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.database.SaveGroupMember(&data.GroupMember{GroupId: group.GroupId, UserId: senderId, ChainKey: chainKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	texts := []string{"first", "second", "third"}
+	sent := make([]*groupMessageControl, len(texts))
+	for i, text := range texts {
+		var ciphertext []byte
+		ciphertext, chainKey, err = crypto_utils.SenderKeyEncrypt(chainKey, []byte(text), groupMessageAdditionalData(group.GroupId, senderId))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sent[i] = &groupMessageControl{GroupId: group.GroupId, Iteration: uint32(i), Ciphertext: ciphertext}
+	}
+	for _, i := range []int{2, 0, 1} {
+		notifications, err := c.handleGroupMessage(senderId, sent[i])
+		if err != nil {
+			t.Fatalf("message %d: %s", i, err)
+		}
+		if got := notifications[0].(*NewGroupMessageNotification).Message.Content; got != texts[i] {
+			t.Fatalf("message %d is %q, want %q", i, got, texts[i])
+		}
+	}
+	// the key of a late message is used once
+	if _, err = c.handleGroupMessage(senderId, sent[0]); err == nil {
+		t.Fatal("a replayed message was accepted")
+	}
+}
+
+func TestKeepSkippedKeys(t *testing.T) {
+	member := &data.GroupMember{Iteration: crypto_utils.MaxSenderKeySkip + 10}
+	skipped := make(map[uint32][]byte)
+	for i := uint32(0); i < member.Iteration; i++ {
+		skipped[i] = []byte{1}
+	}
+	keepSkippedKeys(member, skipped)
+	if len(member.SkippedKeys) != crypto_utils.MaxSenderKeySkip {
+		t.Fatalf("kept %d keys, want %d", len(member.SkippedKeys), crypto_utils.MaxSenderKeySkip)
+	}
+	if _, ok := member.SkippedKeys[9]; ok {
+		t.Fatal("kept the key of an old iteration")
+	}
+	if _, ok := member.SkippedKeys[10]; !ok {
+		t.Fatal("dropped the key of a recent iteration")
+	}
+}
@@ -0,0 +1,105 @@
+package messenger_client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/crypto_utils"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/custom_types"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+)
+
+// Chat handshake:
+//
+//	initiator: (new) -> requested -> accepted -> key_rotated -> closed
+//	receiver:  (new) -> pending   -> accepted -> key_rotated -> closed
+//
+// The initiator knows the receiver's keys up front if the receiver was found by username, and
+// otherwise learns them when the chat is accepted. Every key received from the server is checked
+// against the user id it is claimed for, and keys learned earlier must not change on the way.
+
+var chatTransitions = map[data.ChatState][]data.ChatState{
+	"":                  {data.ChatRequested, data.ChatPending},
+	data.ChatRequested:  {data.ChatAccepted, data.ChatClosed},
+	data.ChatPending:    {data.ChatAccepted, data.ChatClosed},
+	data.ChatAccepted:   {data.ChatKeyRotated, data.ChatClosed},
+	data.ChatKeyRotated: {data.ChatKeyRotated, data.ChatClosed},
+	data.ChatClosed:     {},
+}
+
+type IllegalTransitionError struct {
+	ChatId uint64
+	From   data.ChatState
+	To     data.ChatState
+}
+
+func (e *IllegalTransitionError) Error() string {
+	from := e.From
+	if from == "" {
+		from = "new"
+	}
+	return fmt.Sprintf("chat %d can not go from %s to %s", e.ChatId, from, e.To)
+}
+
+// transitionChat moves chat to state to without saving it, Accepted follows the state.
+func transitionChat(chat *data.Chat, to data.ChatState) error {
+	for _, allowed := range chatTransitions[chat.State] {
+		if allowed == to {
+			chat.State = to
+			chat.Accepted = to == data.ChatAccepted || to == data.ChatKeyRotated
+			return nil
+		}
+	}
+	return &IllegalTransitionError{ChatId: chat.ChatId, From: chat.State, To: to}
+}
+
+// chatIsOpen reports whether messages can be exchanged in the chat.
+func chatIsOpen(chat *data.Chat) bool {
+	return chat.State == data.ChatAccepted || chat.State == data.ChatKeyRotated
+}
+
+// validateUserKeys checks that the keys are well-formed and that the ECDSA key derives userId.
+func validateUserKeys(userId uint64, ecdsaPublic []byte, rsaPublic []byte) error {
+	ecdsaKey, err := crypto_utils.PublicECDSAKeyFromBytes(ecdsaPublic)
+	if err != nil {
+		return fmt.Errorf("invalid ecdsa key of user %d: %w", userId, err)
+	}
+	if !crypto_utils.VerifyUserId(userId, ecdsaKey) {
+		return fmt.Errorf("ecdsa key does not derive user id %d", userId)
+	}
+	if _, err = crypto_utils.PublicRSAKeyFromBytes(rsaPublic); err != nil {
+		return fmt.Errorf("invalid rsa key of user %d: %w", userId, err)
+	}
+	return nil
+}
+
+var errMissingUserInfo = errors.New("missing user info")
+
+func errKeyChanged(userId uint64) error {
+	return fmt.Errorf("ecdsa key of user %d changed", userId)
+}
+
+func validatePublicInfo(info *custom_types.PublicUserInfo) error {
+	if info == nil {
+		return errMissingUserInfo
+	}
+	return validateUserKeys(info.UserId, info.EcdsaPublicKey, info.InitialRsaPublicKey)
+}
+
+// learnOtherUserKeys stores the other user's keys on the chat. Keys that were already known (from
+// the username search or the chat request) must match, a change means someone is in the middle.
+func learnOtherUserKeys(chat *data.Chat, info *custom_types.PublicUserInfo) error {
+	if err := validatePublicInfo(info); err != nil {
+		return err
+	}
+	if info.UserId != chat.OtherUserId {
+		return fmt.Errorf("chat %d is with user %d, got keys of %d", chat.ChatId, chat.OtherUserId, info.UserId)
+	}
+	if chat.OtherUserEcdsaPublic != nil && !bytes.Equal(chat.OtherUserEcdsaPublic, info.EcdsaPublicKey) {
+		return errKeyChanged(info.UserId)
+	}
+	chat.OtherUserEcdsaPublic = info.EcdsaPublicKey
+	chat.OtherUserRsaPublic = info.InitialRsaPublicKey
+	return nil
+}
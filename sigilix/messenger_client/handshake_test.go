@@ -0,0 +1,227 @@
+package messenger_client
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/crypto_utils"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/custom_types"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+)
+
+func TestTransitionChat(t *testing.T) {
+	paths := map[string][]data.ChatState{
+		"initiator": {data.ChatRequested, data.ChatAccepted, data.ChatKeyRotated, data.ChatKeyRotated, data.ChatClosed},
+		"receiver":  {data.ChatPending, data.ChatAccepted, data.ChatKeyRotated, data.ChatClosed},
+		"declined":  {data.ChatPending, data.ChatClosed},
+	}
+	for name, path := range paths {
+		t.Run(name, func(t *testing.T) {
+			chat := &data.Chat{ChatId: 1}
+			for _, to := range path {
+				if err := transitionChat(chat, to); err != nil {
+					t.Fatal(err)
+				}
+				if chat.State != to || chat.Accepted != chatIsOpen(chat) {
+					t.Fatalf("chat is %s, accepted %v after moving to %s", chat.State, chat.Accepted, to)
+				}
+			}
+		})
+	}
+
+	illegal := []struct {
+		from, to data.ChatState
+	}{
+		{"", data.ChatAccepted},
+		{"", data.ChatClosed},
+		{data.ChatRequested, data.ChatPending},
+		{data.ChatRequested, data.ChatKeyRotated},
+		{data.ChatPending, data.ChatKeyRotated},
+		{data.ChatAccepted, data.ChatRequested},
+		{data.ChatKeyRotated, data.ChatAccepted},
+		{data.ChatClosed, data.ChatAccepted},
+		{data.ChatClosed, data.ChatClosed},
+	}
+	for _, tt := range illegal {
+		chat := &data.Chat{ChatId: 1, State: tt.from}
+		err := transitionChat(chat, tt.to)
+		var illegalErr *IllegalTransitionError
+		if !errors.As(err, &illegalErr) || illegalErr.From != tt.from || illegalErr.To != tt.to {
+			t.Errorf("%q -> %q: got %v, want an illegal transition", tt.from, tt.to, err)
+		}
+		if chat.State != tt.from {
+			t.Errorf("%q -> %q: chat moved to %q", tt.from, tt.to, chat.State)
+		}
+	}
+}
+
+func testUserInfo(t *testing.T) *custom_types.PublicUserInfo {
+	t.Helper()
+	ecdsaKey, err := crypto_utils.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := crypto_utils.NewRSAKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &custom_types.PublicUserInfo{
+		UserId:              crypto_utils.GenerateUserIdByPublicKey(&ecdsaKey.PublicKey),
+		EcdsaPublicKey:      crypto_utils.PublicECDSAKeyToBytes(&ecdsaKey.PublicKey),
+		InitialRsaPublicKey: crypto_utils.MustPublicRSAKeyToBytes(&rsaKey.PublicKey),
+	}
+}
+
+func TestLearnOtherUserKeys(t *testing.T) {
+	info := testUserInfo(t)
+	other := testUserInfo(t)
+
+	chat := &data.Chat{ChatId: 1, OtherUserId: info.UserId}
+	if err := learnOtherUserKeys(chat, info); err != nil {
+		t.Fatal(err)
+	}
+	if string(chat.OtherUserEcdsaPublic) != string(info.EcdsaPublicKey) || string(chat.OtherUserRsaPublic) != string(info.InitialRsaPublicKey) {
+		t.Fatal("keys were not stored on the chat")
+	}
+	// learning the same keys again is fine
+	if err := learnOtherUserKeys(chat, info); err != nil {
+		t.Fatal(err)
+	}
+
+	rejected := map[string]*custom_types.PublicUserInfo{
+		"missing":           nil,
+		"id not derived":    {UserId: info.UserId + 1, EcdsaPublicKey: info.EcdsaPublicKey, InitialRsaPublicKey: info.InitialRsaPublicKey},
+		"invalid ecdsa key": {UserId: info.UserId, EcdsaPublicKey: []byte("not a key"), InitialRsaPublicKey: info.InitialRsaPublicKey},
+		"invalid rsa key":   {UserId: info.UserId, EcdsaPublicKey: info.EcdsaPublicKey, InitialRsaPublicKey: []byte("not a key")},
+		"another user":      other,
+	}
+	for name, bad := range rejected {
+		if err := learnOtherUserKeys(&data.Chat{ChatId: 1, OtherUserId: info.UserId}, bad); err == nil {
+			t.Errorf("%s: keys were accepted", name)
+		}
+	}
+
+	// valid keys, but not the ones learned from the chat request
+	known := &data.Chat{ChatId: 1, OtherUserId: info.UserId, OtherUserEcdsaPublic: other.EcdsaPublicKey}
+	if err := learnOtherUserKeys(known, info); err == nil {
+		t.Error("changed keys were accepted")
+	}
+}
+
+// TestHandshake runs a chat through every state on both sides of the loopback.
+func TestHandshake(t *testing.T) {
+	server := newTestServer(t)
+	a := newTestClient(t, server)
+	b := newTestClient(t, server)
+
+	states := func(chatId uint64, wantA, wantB data.ChatState) {
+		t.Helper()
+		for c, want := range map[*MessengerClient]data.ChatState{a: wantA, b: wantB} {
+			chat, err := c.GetChat(chatId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chat.State != want {
+				t.Fatalf("user %d: chat is %s, want %s", c.GetUserId(), chat.State, want)
+			}
+		}
+	}
+
+	chat, err := a.InitChatFromInitializer(b.GetUserId())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if incoming := pull(t, b)[NewIncomingChat]; len(incoming) != 1 {
+		t.Fatalf("receiver got %d new_incoming_chat, want 1", len(incoming))
+	}
+	states(chat.ChatId, data.ChatRequested, data.ChatPending)
+
+	if _, err = b.InitChatFromReceiver(chat.ChatId); err != nil {
+		t.Fatal(err)
+	}
+	pull(t, a)
+	states(chat.ChatId, data.ChatAccepted, data.ChatAccepted)
+	if _, err = b.InitChatFromReceiver(chat.ChatId); err == nil {
+		t.Fatal("accepted the chat twice")
+	}
+
+	rsaKey, err := crypto_utils.NewRSAKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.http.UpdateChatRsaKey(chat.ChatId, &rsaKey.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+	if changed := pull(t, b)[KeyChanged]; len(changed) != 1 {
+		t.Fatalf("got %d key_changed, want 1", len(changed))
+	}
+	states(chat.ChatId, data.ChatAccepted, data.ChatKeyRotated)
+
+	if err = a.DeleteChat(chat.ChatId); err != nil {
+		t.Fatal(err)
+	}
+	if closed := pull(t, b)[ChatClosed]; len(closed) != 1 {
+		t.Fatalf("got %d chat_closed, want 1", len(closed))
+	}
+	if chat, err := b.GetChat(chat.ChatId); err != nil || chat.State != data.ChatClosed {
+		t.Fatalf("chat is %v (%v), want closed", chat, err)
+	}
+	if _, err = b.SendMessage(chat.ChatId, "too late"); err == nil {
+		t.Fatal("sent a message to a closed chat")
+	}
+}
+
+func TestDeclineChat(t *testing.T) {
+	server := newTestServer(t)
+	a := newTestClient(t, server)
+	b := newTestClient(t, server)
+
+	chat, err := a.InitChatFromInitializer(b.GetUserId())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pull(t, b)
+	if err = b.DeclineChat(chat.ChatId); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.GetChat(chat.ChatId); !errors.Is(err, data.ErrChatNotFound) {
+		t.Fatalf("declined chat: got %v, want ErrChatNotFound", err)
+	}
+	// the server forgot the chat, it can not be accepted anymore
+	if _, err = b.http.InitChatFromReceiver(chat.ChatId); err == nil {
+		t.Fatal("the declined chat is still open on the server")
+	}
+}
+
+func TestAutoAcceptVerifiedContact(t *testing.T) {
+	server := newTestServer(t)
+	a := newTestClient(t, server)
+	b := newTestClient(t, server)
+	if err := a.SetUsernameConfig("alice", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.AddContact("alice", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetContactVerified(a.GetUserId(), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetChatRequestPolicy(data.ChatRequestPolicy{AutoAcceptVerified: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	chat, err := a.InitChatFromInitializer(b.GetUserId())
+	if err != nil {
+		t.Fatal(err)
+	}
+	incoming := pull(t, b)[NewIncomingChat]
+	if len(incoming) != 1 || incoming[0].(*IncomingChatNotification).Chat.State != data.ChatAccepted {
+		t.Fatalf("receiver got %v, want the accepted chat", incoming)
+	}
+	if accepted := pull(t, a)[ChatAccepted]; len(accepted) != 1 {
+		t.Fatalf("initiator got %d chat_accepted, want 1", len(accepted))
+	}
+	if stored, err := b.GetChat(chat.ChatId); err != nil || stored.State != data.ChatAccepted {
+		t.Fatalf("receiver stored %v (%v), want the accepted chat", stored, err)
+	}
+}
@@ -0,0 +1,159 @@
+package messenger_client
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/crypto_utils"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+)
+
+// Locking ends the session Unlock started: the database is closed, the keys in memory are zeroed
+// and the HTTP client is dropped, Unlock has to be called again with the password. With an idle
+// timeout configured (data.Config.AutoLockMinutes) the client locks itself once ReportActivity was
+// not called for that long, the UI reports user input with it.
+
+const maxAutoLockMinutes = 24 * 60
+
+type lockState struct {
+	mu           sync.Mutex
+	timeout      time.Duration
+	lastActivity time.Time
+	timer        *time.Timer
+	// session tells timers of an earlier session apart, it changes on every Unlock and Lock
+	session uint64
+}
+
+// Lock closes the session, see Unlock. Locking a locked client does nothing.
+func (c *MessengerClient) Lock() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lock()
+}
+
+func (c *MessengerClient) lock() error {
+	if !c.unlocked {
+		return nil
+	}
+	c.unlocked = false
+	c.stopIdleLock()
+	c.stopJanitor()
+
+	var err error
+	if c.store != nil {
+		err = c.store.Close()
+	}
+	c.store = nil
+	c.database = nil
+	c.http = nil
+
+	c.keys.Wipe()
+	c.keys = nil
+	crypto_utils.Wipe(c.config.PaswordHash)
+	c.config = nil
+
+	c.devices.mu.Lock()
+	crypto_utils.Wipe(c.devices.secret)
+	for _, link := range c.devices.pending {
+		crypto_utils.Wipe(link.secret)
+	}
+	c.devices.secret = nil
+	c.devices.candidates = make(map[uint64]bool)
+	c.devices.pending = make(map[uint64]*pendingDeviceLink)
+	c.devices.mu.Unlock()
+
+	c.ephemeral.mu.Lock()
+	c.ephemeral.presence = make(map[uint64]*ChatPresence)
+	c.ephemeral.typingSentAt = make(map[uint64]time.Time)
+	c.ephemeral.presenceAnnounce = time.Time{}
+	c.ephemeral.mu.Unlock()
+
+	c.pending.take()
+	c.connection = ""
+	return err
+}
+
+// ReportActivity restarts the idle timeout. It does not wait for other calls.
+func (c *MessengerClient) ReportActivity() {
+	c.idle.mu.Lock()
+	defer c.idle.mu.Unlock()
+	c.idle.lastActivity = time.Now()
+}
+
+// GetAutoLockTimeout returns the idle timeout in minutes, 0 if the client never locks itself.
+func (c *MessengerClient) GetAutoLockTimeout() (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.unlocked {
+		return 0, errors.New("not unlocked")
+	}
+	return c.config.AutoLockMinutes, nil
+}
+
+func (c *MessengerClient) SetAutoLockTimeout(minutes int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return errors.New("not unlocked")
+	}
+	if minutes < 0 || minutes > maxAutoLockMinutes {
+		return errors.New("invalid auto-lock timeout")
+	}
+	c.config.AutoLockMinutes = minutes
+	if err := c.saveConfig(); err != nil {
+		return err
+	}
+	c.startIdleLock(c.config)
+	return nil
+}
+
+// startIdleLock (re)starts the idle timer of a new session or after the timeout changed.
+func (c *MessengerClient) startIdleLock(config *data.Config) {
+	c.idle.mu.Lock()
+	defer c.idle.mu.Unlock()
+	if c.idle.timer != nil {
+		c.idle.timer.Stop()
+		c.idle.timer = nil
+	}
+	c.idle.session++
+	c.idle.timeout = time.Duration(config.AutoLockMinutes) * time.Minute
+	c.idle.lastActivity = time.Now()
+	if c.idle.timeout > 0 {
+		session := c.idle.session
+		c.idle.timer = time.AfterFunc(c.idle.timeout, func() { c.lockWhenIdle(session) })
+	}
+}
+
+func (c *MessengerClient) stopIdleLock() {
+	c.idle.mu.Lock()
+	defer c.idle.mu.Unlock()
+	if c.idle.timer != nil {
+		c.idle.timer.Stop()
+		c.idle.timer = nil
+	}
+	c.idle.session++
+}
+
+func (c *MessengerClient) lockWhenIdle(session uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.idle.mu.Lock()
+	if session != c.idle.session {
+		c.idle.mu.Unlock()
+		return
+	}
+	if left := c.idle.timeout - time.Since(c.idle.lastActivity); left > 0 {
+		c.idle.timer = time.AfterFunc(left, func() { c.lockWhenIdle(session) })
+		c.idle.mu.Unlock()
+		return
+	}
+	c.idle.timer = nil
+	c.idle.mu.Unlock()
+
+	if err := c.lock(); err != nil {
+		log.Printf("error locking idle client: %s", err.Error())
+	}
+}
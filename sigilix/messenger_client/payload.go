@@ -0,0 +1,250 @@
+package messenger_client
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/crypto_utils"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/custom_types"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+)
+
+// Every message body is a Payload: a versioned JSON document signed by its author, prefixed by
+// a marker that can not be typed in the UI. Bodies without the marker come from older clients
+// and are treated as plain text.
+const payloadPrefix = "\x00sigilix-payload:"
+
+const payloadVersion = 1
+
+type PayloadType string
+
+const (
+	PayloadText     PayloadType = "text"
+	PayloadEdit     PayloadType = "edit"
+	PayloadDelete   PayloadType = "delete"
+	PayloadReaction PayloadType = "reaction"
+	// PayloadControl carries client-to-client protocol messages, see control.go
+	PayloadControl PayloadType = "control"
+)
+
+type Payload struct {
+	Version int         `json:"v"`
+	Type    PayloadType `json:"type"`
+	Text    string      `json:"text,omitempty"`
+	// ReplyTo is set on text payloads that answer another message of the chat.
+	ReplyTo    uint64          `json:"reply_to,omitempty"`
+	ExpiresIn  uint64          `json:"expires_in,omitempty"`
+	EditOf     uint64          `json:"edit_of,omitempty"`
+	DeleteOf   uint64          `json:"delete_of,omitempty"`
+	ReactionTo uint64          `json:"reaction_to,omitempty"`
+	Reaction   string          `json:"reaction,omitempty"`
+	Control    *controlMessage `json:"control,omitempty"`
+	// Signature is the ECDSA signature of the payload encoded with an empty Signature.
+	Signature custom_types.Base64Bytes `json:"sig,omitempty"`
+}
+
+func (p *Payload) signedBytes() ([]byte, error) {
+	unsigned := *p
+	unsigned.Signature = nil
+	return json.Marshal(&unsigned)
+}
+
+func (p *Payload) Sign(signer crypto_utils.Signer) error {
+	toSign, err := p.signedBytes()
+	if err != nil {
+		return err
+	}
+	p.Signature, err = signer.Sign(toSign)
+	return err
+}
+
+func (p *Payload) Verify(key *ecdsa.PublicKey) error {
+	if len(p.Signature) == 0 {
+		return errors.New("payload is not signed")
+	}
+	signed, err := p.signedBytes()
+	if err != nil {
+		return err
+	}
+	ok, err := crypto_utils.ValidateECDSASignature(key, signed, p.Signature)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("invalid payload signature")
+	}
+	return nil
+}
+
+func (p *Payload) validate() error {
+	switch p.Type {
+	case PayloadText:
+	case PayloadEdit:
+		if p.EditOf == 0 {
+			return errors.New("edit payload without edit_of")
+		}
+	case PayloadDelete:
+		if p.DeleteOf == 0 {
+			return errors.New("delete payload without delete_of")
+		}
+	case PayloadReaction:
+		if p.ReactionTo == 0 {
+			return errors.New("reaction payload without reaction_to")
+		}
+	case PayloadControl:
+		if p.Control == nil {
+			return errors.New("control payload without control message")
+		}
+	default:
+		return fmt.Errorf("unknown payload type %q", p.Type)
+	}
+	return nil
+}
+
+func encodePayload(p *Payload, signer crypto_utils.Signer) (string, error) {
+	p.Version = payloadVersion
+	if err := p.validate(); err != nil {
+		return "", err
+	}
+	if err := p.Sign(signer); err != nil {
+		return "", err
+	}
+	encoded, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	return payloadPrefix + string(encoded), nil
+}
+
+// decodePayload parses and verifies a decrypted message body. Legacy plain-text bodies are
+// returned as unsigned text payloads.
+func decodePayload(content []byte, senderKey *ecdsa.PublicKey) (*Payload, error) {
+	if !strings.HasPrefix(string(content), payloadPrefix) {
+		return &Payload{Type: PayloadText, Text: string(content)}, nil
+	}
+	p := &Payload{}
+	err := json.Unmarshal(content[len(payloadPrefix):], p)
+	if err != nil {
+		return nil, err
+	}
+	if p.Version != payloadVersion {
+		return nil, fmt.Errorf("unsupported payload version %d", p.Version)
+	}
+	if err = p.validate(); err != nil {
+		return nil, err
+	}
+	if err = p.Verify(senderKey); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (c *MessengerClient) sendPayload(chat *data.Chat, p *Payload) (*custom_types.SendMessageResponse, error) {
+	if !chat.Accepted {
+		return nil, errors.New("chat not accepted")
+	}
+	if chat.MirroredFrom != 0 {
+		return nil, errMirroredChat
+	}
+	encoded, err := encodePayload(p, c.keys)
+	if err != nil {
+		return nil, err
+	}
+	rsaPub, err := chat.OtherUserRsaPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return c.http.SendMessage(chat.ChatId, encoded, rsaPub)
+}
+
+// applyPayload stores the effect of an incoming payload and returns the notifications for the UI.
+func (c *MessengerClient) applyPayload(chat *data.Chat, messageId uint64, senderId uint64, p *Payload) ([]WebNotification, error) {
+	switch p.Type {
+	case PayloadText:
+		message := &data.Message{}
+		message.ChatId = chat.ChatId
+		message.Content = p.Text
+		message.MessageId = messageId
+		message.SenderId = senderId
+		message.ReplyTo = p.ReplyTo
+		message.Status = data.MessageStatusReceived
+		message.ExpiresAt = expiresAt(incomingTtl(p.ExpiresIn, chat.MessageTtl))
+		err := c.database.SaveMessage(message)
+		if err != nil {
+			return nil, err
+		}
+		c.mirrorMessage(chat, message)
+		return []WebNotification{&NewMessageNotification{ChatId: chat.ChatId, Message: message, SenderUsername: chat.OtherUsername}}, nil
+	case PayloadEdit:
+		message, err := c.getOwnMessage(chat.ChatId, p.EditOf, senderId)
+		if err != nil {
+			return nil, err
+		}
+		message.Content = p.Text
+		message.Edited = true
+		if err = c.database.UpdateMessage(message); err != nil {
+			return nil, err
+		}
+		c.mirrorMessage(chat, message)
+		return []WebNotification{&MessageEditedNotification{ChatId: chat.ChatId, Message: message}}, nil
+	case PayloadDelete:
+		message, err := c.getOwnMessage(chat.ChatId, p.DeleteOf, senderId)
+		if err != nil {
+			return nil, err
+		}
+		markDeleted(message)
+		if err = c.database.UpdateMessage(message); err != nil {
+			return nil, err
+		}
+		c.mirrorMessage(chat, message)
+		return []WebNotification{&MessageDeletedNotification{ChatId: chat.ChatId, MessageId: message.MessageId}}, nil
+	case PayloadReaction:
+		message, err := c.database.GetMessage(chat.ChatId, p.ReactionTo)
+		if err != nil {
+			return nil, err
+		}
+		if message == nil {
+			return nil, errors.New("reaction to unknown message")
+		}
+		err = c.database.SetReaction(chat.ChatId, message.MessageId, senderId, p.Reaction)
+		if err != nil {
+			return nil, err
+		}
+		return []WebNotification{&MessageReactionNotification{
+			ChatId:    chat.ChatId,
+			MessageId: message.MessageId,
+			UserId:    senderId,
+			Reaction:  p.Reaction,
+		}}, nil
+	case PayloadControl:
+		return c.handleControlMessage(chat, senderId, p.Control)
+	}
+	return nil, fmt.Errorf("unknown payload type %q", p.Type)
+}
+
+// getOwnMessage returns a message only if it was written by authorId, users can only edit and
+// delete their own messages.
+func (c *MessengerClient) getOwnMessage(chatId uint64, messageId uint64, authorId uint64) (*data.Message, error) {
+	message, err := c.database.GetMessage(chatId, messageId)
+	if err != nil {
+		return nil, err
+	}
+	if message == nil {
+		return nil, errors.New("message not found")
+	}
+	if message.SenderId != authorId {
+		return nil, errors.New("message belongs to another user")
+	}
+	if message.Deleted {
+		return nil, errors.New("message is deleted")
+	}
+	return message, nil
+}
+
+func markDeleted(message *data.Message) {
+	message.Content = ""
+	message.Deleted = true
+}
@@ -0,0 +1,120 @@
+package messenger_client
+
+import (
+	"errors"
+	"log"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+)
+
+// Receipts tell the sender that its messages were decrypted (delivered) or seen (read). They are
+// control messages, so they are encrypted and signed like everything else and never show up in
+// the message list. Delivered receipts are sent for every batch of pulled text messages, read
+// receipts from MarkChatRead unless the user disabled them.
+
+type receiptControl struct {
+	Kind       data.MessageStatus `json:"kind"`
+	MessageIds []uint64           `json:"message_ids"`
+}
+
+func (c *MessengerClient) sendReceipt(chat *data.Chat, kind data.MessageStatus, messageIds []uint64) error {
+	if len(messageIds) == 0 {
+		return nil
+	}
+	return c.sendControlMessage(chat, &controlMessage{
+		Type:    controlReceipt,
+		Receipt: &receiptControl{Kind: kind, MessageIds: messageIds},
+	})
+}
+
+func (c *MessengerClient) handleReceipt(chat *data.Chat, receipt *receiptControl) ([]WebNotification, error) {
+	if receipt.Kind != data.MessageStatusDelivered && receipt.Kind != data.MessageStatusRead {
+		return nil, errors.New("unknown receipt kind")
+	}
+	updated := make([]uint64, 0, len(receipt.MessageIds))
+	for _, messageId := range receipt.MessageIds {
+		message, err := c.database.GetMessage(chat.ChatId, messageId)
+		if err != nil {
+			return nil, err
+		}
+		// receipts can only be issued for our own messages, and never move a status backwards
+		if message == nil || message.SenderId != c.config.UserId || receipt.Kind.Rank() <= message.Status.Rank() {
+			continue
+		}
+		err = c.database.SetMessageStatus(chat.ChatId, messageId, receipt.Kind)
+		if err != nil {
+			return nil, err
+		}
+		updated = append(updated, messageId)
+	}
+	if len(updated) == 0 {
+		return nil, nil
+	}
+	return []WebNotification{&MessageStatusNotification{
+		ChatId:     chat.ChatId,
+		MessageIds: updated,
+		Status:     receipt.Kind,
+	}}, nil
+}
+
+// sendDeliveredReceipts acknowledges the text messages decrypted during one pull.
+func (c *MessengerClient) sendDeliveredReceipts(delivered map[uint64][]uint64) {
+	for chatId, messageIds := range delivered {
+		chat, err := c.database.GetChat(chatId)
+		if err != nil {
+			log.Printf("error getting chat for receipt: %s", err.Error())
+			continue
+		}
+		err = c.sendReceipt(chat, data.MessageStatusDelivered, messageIds)
+		if err != nil {
+			log.Printf("error sending delivered receipt: %s", err.Error())
+		}
+	}
+}
+
+// MarkChatRead marks every received message of the chat as read and, unless disabled, tells the
+// sender about it.
+func (c *MessengerClient) MarkChatRead(chatId uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return errors.New("not unlocked")
+	}
+	chat, err := c.database.GetChat(chatId)
+	if err != nil {
+		return err
+	}
+	unread, err := c.database.GetUnreadMessageIds(chatId, c.config.UserId)
+	if err != nil {
+		return err
+	}
+	for _, messageId := range unread {
+		err = c.database.SetMessageStatus(chatId, messageId, data.MessageStatusRead)
+		if err != nil {
+			return err
+		}
+	}
+	if c.config.DisableReadReceipts || !chat.Accepted || chat.MirroredFrom != 0 {
+		return nil
+	}
+	return c.sendReceipt(chat, data.MessageStatusRead, unread)
+}
+
+func (c *MessengerClient) ReadReceiptsEnabled() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.config == nil {
+		return true
+	}
+	return !c.config.DisableReadReceipts
+}
+
+func (c *MessengerClient) SetReadReceiptsEnabled(enabled bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return errors.New("not unlocked")
+	}
+	c.config.DisableReadReceipts = !enabled
+	return c.saveConfig()
+}
@@ -0,0 +1,160 @@
+package messenger_client
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/custom_types"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+)
+
+// Incoming chat requests go through data.ChatRequestPolicy before they are stored. Requests that
+// pass stay pending until they are accepted or declined, and are listed separately from chats.
+
+// chatRequestWindow is the period MaxRequestsPerSender is counted over.
+const chatRequestWindow = 24 * time.Hour
+
+type requestLimiter struct {
+	mu   sync.Mutex
+	seen map[uint64][]time.Time
+}
+
+func newRequestLimiter() *requestLimiter {
+	return &requestLimiter{seen: make(map[uint64][]time.Time)}
+}
+
+// allow records a request from userId and reports whether it is within limit, 0 means no limit.
+func (l *requestLimiter) allow(userId uint64, limit int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	recent := l.seen[userId][:0]
+	for _, at := range l.seen[userId] {
+		if now.Sub(at) < chatRequestWindow {
+			recent = append(recent, at)
+		}
+	}
+	recent = append(recent, now)
+	l.seen[userId] = recent
+	return limit <= 0 || len(recent) <= limit
+}
+
+type chatRequestDecision int
+
+const (
+	requestPending chatRequestDecision = iota
+	requestDropped
+	requestAutoAccepted
+)
+
+func (c *MessengerClient) decideChatRequest(chatId uint64, info *custom_types.PublicUserInfo) (chatRequestDecision, error) {
+	policy := c.config.ChatRequestPolicy
+	contact, err := c.database.GetContact(info.UserId)
+	if err != nil {
+		return requestDropped, err
+	}
+	if contact != nil && contact.Blocked {
+		return requestDropped, errors.New("user is blocked")
+	}
+	// a device waiting to be linked accepts the primary's chat, see StartDeviceLink
+	if c.claimLinkChat(chatId) {
+		return requestAutoAccepted, nil
+	}
+	// the rate limit is for strangers, contacts are never limited
+	if contact == nil {
+		if policy.OnlyContacts {
+			return requestDropped, errors.New("not a contact")
+		}
+		if !c.requests.allow(info.UserId, policy.MaxRequestsPerSender) {
+			return requestDropped, errors.New("too many requests")
+		}
+		return requestPending, nil
+	}
+	// a verified contact is only trusted with the keys that were verified
+	if policy.AutoAcceptVerified && contact.Verified &&
+		bytes.Equal(contact.EcdsaPublic, info.EcdsaPublicKey) && bytes.Equal(contact.RsaPublic, info.InitialRsaPublicKey) {
+		return requestAutoAccepted, nil
+	}
+	return requestPending, nil
+}
+
+// DeclineChat removes an incoming chat request and closes it on the server, see leaveChat. The
+// request was never accepted, so no message reaches the other user: their chat stays requested,
+// but nothing they send to it is delivered. Block the user to drop further requests.
+func (c *MessengerClient) DeclineChat(chatId uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return errors.New("not unlocked")
+	}
+	chat, err := c.database.GetChat(chatId)
+	if err != nil {
+		return err
+	}
+	if chat.State != data.ChatPending {
+		return errors.New("not a pending chat request")
+	}
+	c.leaveChat(chat)
+	return c.database.DeleteChat(chat.ChatId)
+}
+
+// GetPendingChatRequests returns incoming chat requests that were not accepted or declined yet.
+func (c *MessengerClient) GetPendingChatRequests() ([]*data.Chat, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.unlocked {
+		return nil, errors.New("not unlocked")
+	}
+	chats, err := c.database.GetAllChats()
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]*data.Chat, 0)
+	for _, chat := range chats {
+		if isPendingRequest(chat) {
+			pending = append(pending, chat)
+		}
+	}
+	return pending, nil
+}
+
+func isPendingRequest(chat *data.Chat) bool {
+	return chat.State == data.ChatPending
+}
+
+func (c *MessengerClient) GetChatRequestPolicy() data.ChatRequestPolicy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.config == nil {
+		return data.ChatRequestPolicy{}
+	}
+	return c.config.ChatRequestPolicy
+}
+
+func (c *MessengerClient) SetChatRequestPolicy(policy data.ChatRequestPolicy) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return errors.New("not unlocked")
+	}
+	if policy.MaxRequestsPerSender < 0 {
+		return errors.New("invalid request limit")
+	}
+	c.config.ChatRequestPolicy = policy
+	return c.saveConfig()
+}
+
+// autoAcceptChat accepts a saved request that passed the policy as requestAutoAccepted and
+// updates chat, failures are logged and leave the request pending. It runs after the commit of
+// the request, see afterCommit.
+func (c *MessengerClient) autoAcceptChat(chat *data.Chat) {
+	accepted, err := c.initChatFromReceiver(chat.ChatId)
+	if err != nil {
+		log.Printf("error auto-accepting chat %d: %s", chat.ChatId, err.Error())
+		return
+	}
+	*chat = *accepted
+}
@@ -0,0 +1,91 @@
+package messenger_client
+
+import (
+	"bytes"
+	"log"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/custom_types"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+)
+
+// Every PublicUserInfo the server hands out goes through ingestUserInfo: the user id has to derive
+// from the ECDSA key, and a user whose key we already know must not show up with another one. Since
+// the id is derived from the key, a different key for a known id is either a hash collision or the
+// server substituting keys. Both are rejected and surfaced as security alerts.
+
+type SecurityAlertKind string
+
+const (
+	// SecurityKeyMismatch means the user id does not derive from the claimed ECDSA key.
+	SecurityKeyMismatch SecurityAlertKind = "key_mismatch"
+	// SecurityKeyChanged means a known user showed up with a different ECDSA key.
+	SecurityKeyChanged SecurityAlertKind = "key_changed"
+)
+
+type SecurityAlertNotification struct {
+	Kind   SecurityAlertKind `json:"kind"`
+	UserId uint64            `json:"user_id"`
+	// ChatId is set when the alert was raised for a chat.
+	ChatId uint64 `json:"chat_id,omitempty"`
+	Detail string `json:"detail"`
+}
+
+func (i *SecurityAlertNotification) NotificationType() WebNotificationType { return SecurityAlert }
+
+// securityAlertError is err wrapped with the alert it raised. While a notification is applied
+// the alert is only sent by the pull that drops it, outside inTx it is queued right away.
+type securityAlertError struct {
+	alert *SecurityAlertNotification
+	err   error
+}
+
+func (e *securityAlertError) Error() string { return e.err.Error() }
+
+func (e *securityAlertError) Unwrap() error { return e.err }
+
+func (c *MessengerClient) securityAlert(kind SecurityAlertKind, userId uint64, chatId uint64, err error) error {
+	log.Printf("security alert %s for user %d: %s", kind, userId, err.Error())
+	alert := &SecurityAlertNotification{Kind: kind, UserId: userId, ChatId: chatId, Detail: err.Error()}
+	if c.tx == nil {
+		c.pending.push(alert)
+	}
+	return &securityAlertError{alert: alert, err: err}
+}
+
+// knownEcdsaKey returns the ECDSA key we already trust for userId, nil if there is none.
+func (c *MessengerClient) knownEcdsaKey(userId uint64) ([]byte, error) {
+	contact, err := c.database.GetContact(userId)
+	if err != nil {
+		return nil, err
+	}
+	if contact != nil && contact.EcdsaPublic != nil {
+		return contact.EcdsaPublic, nil
+	}
+	cached, err := c.database.GetUserInfo(userId)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		return cached.EcdsaPublic, nil
+	}
+	return nil, nil
+}
+
+// ingestUserInfo validates public info received from the server and caches it. chatId is only
+// used to point alerts at a chat.
+func (c *MessengerClient) ingestUserInfo(info *custom_types.PublicUserInfo, chatId uint64) (*data.UserInfo, error) {
+	if info == nil {
+		return nil, errMissingUserInfo
+	}
+	if err := validatePublicInfo(info); err != nil {
+		return nil, c.securityAlert(SecurityKeyMismatch, info.UserId, chatId, err)
+	}
+	known, err := c.knownEcdsaKey(info.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if known != nil && !bytes.Equal(known, info.EcdsaPublicKey) {
+		return nil, c.securityAlert(SecurityKeyChanged, info.UserId, chatId, errKeyChanged(info.UserId))
+	}
+	return c.rememberUserInfo(info), nil
+}
@@ -0,0 +1,55 @@
+package messenger_client
+
+import (
+	"log"
+	"sync"
+)
+
+// Subscriptions let other consumers than the caller of PullNotificationsAndUpdateData (e.g. the
+// local API) see the notifications of every pull. A subscriber that does not keep up loses
+// notifications instead of blocking the pull.
+
+type subscribers struct {
+	mu   sync.Mutex
+	next int
+	subs map[int]chan *WebNotificationWithTypeInfo
+}
+
+func newSubscribers() *subscribers {
+	return &subscribers{subs: make(map[int]chan *WebNotificationWithTypeInfo)}
+}
+
+// Subscribe returns a channel receiving the notifications of every following pull, and a function
+// that ends the subscription and closes the channel.
+func (c *MessengerClient) Subscribe(buffer int) (<-chan *WebNotificationWithTypeInfo, func()) {
+	ch := make(chan *WebNotificationWithTypeInfo, buffer)
+	c.events.mu.Lock()
+	id := c.events.next
+	c.events.next++
+	c.events.subs[id] = ch
+	c.events.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			c.events.mu.Lock()
+			delete(c.events.subs, id)
+			c.events.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (c *MessengerClient) broadcast(notifications []*WebNotificationWithTypeInfo) {
+	c.events.mu.Lock()
+	defer c.events.mu.Unlock()
+	for id, ch := range c.events.subs {
+		for _, notification := range notifications {
+			select {
+			case ch <- notification:
+			default:
+				log.Printf("subscriber %d is not keeping up, dropping %s notification", id, notification.Type)
+			}
+		}
+	}
+}
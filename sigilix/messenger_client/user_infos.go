@@ -0,0 +1,114 @@
+package messenger_client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/custom_types"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/data"
+)
+
+// Public info of other users is cached from every server response that carries it. The server can
+// only be searched by username, so a cached entry is refreshed through its last known username.
+
+// userInfoMaxAge is how long a cached entry is used before GetUserInfo refreshes it.
+const userInfoMaxAge = time.Hour
+
+// rememberUserInfo caches info that was already checked by ingestUserInfo.
+func (c *MessengerClient) rememberUserInfo(info *custom_types.PublicUserInfo) *data.UserInfo {
+	cached := &data.UserInfo{
+		UserId:      info.UserId,
+		Username:    info.Username,
+		EcdsaPublic: info.EcdsaPublicKey,
+		RsaPublic:   info.InitialRsaPublicKey,
+		UpdatedAt:   time.Now().Unix(),
+	}
+	previous, err := c.database.GetUserInfo(info.UserId)
+	if err != nil {
+		log.Printf("error getting cached user info of %d: %s", info.UserId, err.Error())
+	} else if previous != nil && previous.Username != info.Username {
+		c.queueNotifications(&UsernameChangedNotification{UserId: info.UserId, OldUsername: previous.Username, Username: info.Username})
+	}
+	if err := c.database.SaveUserInfo(cached); err != nil {
+		log.Printf("error caching user info of %d: %s", info.UserId, err.Error())
+	}
+	return cached
+}
+
+// GetUserInfo returns the cached public info of a user, refreshing it if it is stale.
+func (c *MessengerClient) GetUserInfo(userId uint64) (*data.UserInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return nil, errors.New("not unlocked")
+	}
+	cached, err := c.database.GetUserInfo(userId)
+	if err != nil {
+		return nil, err
+	}
+	if cached == nil {
+		return nil, errors.New("user info not known")
+	}
+	if time.Since(time.Unix(cached.UpdatedAt, 0)) < userInfoMaxAge {
+		return cached, nil
+	}
+	refreshed, err := c.refreshUserInfo(cached)
+	if err != nil {
+		log.Printf("error refreshing user info of %d: %s", userId, err.Error())
+		return cached, nil
+	}
+	return refreshed, nil
+}
+
+// RefreshUserInfo fetches the public info of a user from the server, bypassing the cache age.
+func (c *MessengerClient) RefreshUserInfo(userId uint64) (*data.UserInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.unlocked {
+		return nil, errors.New("not unlocked")
+	}
+	cached, err := c.database.GetUserInfo(userId)
+	if err != nil {
+		return nil, err
+	}
+	if cached == nil {
+		return nil, errors.New("user info not known")
+	}
+	return c.refreshUserInfo(cached)
+}
+
+func (c *MessengerClient) refreshUserInfo(cached *data.UserInfo) (*data.UserInfo, error) {
+	if cached.Username == "" {
+		return nil, errors.New("user has no username")
+	}
+	search, err := c.http.SearchByUsername(cached.Username)
+	if err != nil {
+		return nil, err
+	}
+	// the user may have changed or hidden the username, or someone else took it
+	if search == nil || search.PublicInfo.UserId != cached.UserId {
+		return nil, errors.New("username no longer belongs to the user")
+	}
+	return c.ingestUserInfo(search.PublicInfo, 0)
+}
+
+func defaultChatTitle(userId uint64, username string) string {
+	name := username
+	if name == "" {
+		name = fmt.Sprint(userId)
+	}
+	return fmt.Sprintf("Chat with %s, %s", name, time.Now().Format("2006-01-02 15:04:05"))
+}
+
+// retitleWithUsername replaces the user id in a default title once the username is known, titles
+// renamed by the user are left alone.
+func retitleWithUsername(chat *data.Chat, username string) {
+	prefix := fmt.Sprintf("Chat with %d,", chat.OtherUserId)
+	if username == "" || !strings.HasPrefix(chat.Title, prefix) {
+		return
+	}
+	chat.Title = "Chat with " + username + "," + chat.Title[len(prefix):]
+}
@@ -0,0 +1,170 @@
+package mock_server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/crypto_utils"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/custom_types"
+)
+
+type handlerFunc func(s *Server, userId uint64, body []byte) (custom_types.SigilixStruct, error)
+
+func decodeInto(body []byte, req custom_types.SigilixStruct) error {
+	if err := json.Unmarshal(body, req); err != nil {
+		return newApiError(http.StatusBadRequest, err.Error())
+	}
+	return nil
+}
+
+var routes = map[string]handlerFunc{
+	"users/set_username_config": func(s *Server, userId uint64, body []byte) (custom_types.SigilixStruct, error) {
+		req := &custom_types.SetUsernameConfigRequest{}
+		if err := decodeInto(body, req); err != nil {
+			return nil, err
+		}
+		return s.SetUsernameConfig(userId, req)
+	},
+	"users/delete_account": func(s *Server, userId uint64, body []byte) (custom_types.SigilixStruct, error) {
+		req := &custom_types.DeleteAccountRequest{}
+		if err := decodeInto(body, req); err != nil {
+			return nil, err
+		}
+		return s.DeleteAccount(userId, req)
+	},
+	"users/search_by_username": func(s *Server, userId uint64, body []byte) (custom_types.SigilixStruct, error) {
+		req := &custom_types.SearchByUsernameRequest{}
+		if err := decodeInto(body, req); err != nil {
+			return nil, err
+		}
+		return s.SearchByUsername(userId, req)
+	},
+	"messages/init_chat_from_initializer": func(s *Server, userId uint64, body []byte) (custom_types.SigilixStruct, error) {
+		req := &custom_types.InitChatFromInitializerRequest{}
+		if err := decodeInto(body, req); err != nil {
+			return nil, err
+		}
+		return s.InitChatFromInitializer(userId, req)
+	},
+	"messages/init_chat_from_receiver": func(s *Server, userId uint64, body []byte) (custom_types.SigilixStruct, error) {
+		req := &custom_types.InitChatFromReceiverRequest{}
+		if err := decodeInto(body, req); err != nil {
+			return nil, err
+		}
+		return s.InitChatFromReceiver(userId, req)
+	},
+	"messages/update_chat_rsa_key": func(s *Server, userId uint64, body []byte) (custom_types.SigilixStruct, error) {
+		req := &custom_types.UpdateChatRsaKeyRequest{}
+		if err := decodeInto(body, req); err != nil {
+			return nil, err
+		}
+		return s.UpdateChatRsaKey(userId, req)
+	},
+	"messages/send_message": func(s *Server, userId uint64, body []byte) (custom_types.SigilixStruct, error) {
+		req := &custom_types.SendMessageRequest{}
+		if err := decodeInto(body, req); err != nil {
+			return nil, err
+		}
+		return s.SendMessage(userId, req)
+	},
+	"messages/send_file": func(s *Server, userId uint64, body []byte) (custom_types.SigilixStruct, error) {
+		req := &custom_types.SendFileRequest{}
+		if err := decodeInto(body, req); err != nil {
+			return nil, err
+		}
+		return s.SendFile(userId, req)
+	},
+	"messages/close_chat": func(s *Server, userId uint64, body []byte) (custom_types.SigilixStruct, error) {
+		req := &custom_types.CloseChatRequest{}
+		if err := decodeInto(body, req); err != nil {
+			return nil, err
+		}
+		return s.CloseChat(userId, req)
+	},
+	"messages/get_notifications": func(s *Server, userId uint64, body []byte) (custom_types.SigilixStruct, error) {
+		req := &custom_types.GetNotificationsRequest{}
+		if err := decodeInto(body, req); err != nil {
+			return nil, err
+		}
+		return s.GetNotifications(userId, req)
+	},
+}
+
+// ServeHTTP serves the API relative to the handler root, so mount it with http.StripPrefix
+// when the client base url has a path (e.g. http://127.0.0.1:8080/api/).
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, newApiError(http.StatusMethodNotAllowed, "method not allowed"))
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, newApiError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	userId, err := strconv.ParseUint(r.Header.Get("X-Sigilix-User-Id"), 10, 64)
+	if err != nil {
+		writeError(w, newApiError(http.StatusUnauthorized, "missing user id"))
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/")
+
+	if path == "users/login" {
+		req := &custom_types.LoginRequest{}
+		if err = decodeInto(body, req); err != nil {
+			writeError(w, err)
+			return
+		}
+		if !checkSignature(req.ClientEcdaPublicKey, body, r.Header.Get("X-Sigilix-Signature")) {
+			writeError(w, newApiError(http.StatusUnauthorized, "bad request signature"))
+			return
+		}
+		resp, err := s.Login(userId, req)
+		writeResult(w, resp, err)
+		return
+	}
+
+	handler, ok := routes[path]
+	if !ok {
+		writeError(w, newApiError(http.StatusNotFound, "unknown method "+path))
+		return
+	}
+	pub, err := s.ecdsaKeyOf(userId)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !checkSignature(crypto_utils.PublicECDSAKeyToBytes(pub), body, r.Header.Get("X-Sigilix-Signature")) {
+		writeError(w, newApiError(http.StatusUnauthorized, "bad request signature"))
+		return
+	}
+	resp, err := handler(s, userId, body)
+	writeResult(w, resp, err)
+}
+
+func checkSignature(pubKey []byte, body []byte, signature string) bool {
+	ok, err := crypto_utils.ValidateECDSASignatureFromBase64(pubKey, body, signature)
+	return err == nil && ok
+}
+
+func writeResult(w http.ResponseWriter, resp custom_types.SigilixStruct, err error) {
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	apiErr, ok := err.(*ApiError)
+	if !ok {
+		apiErr = newApiError(http.StatusInternalServerError, err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Code)
+	_ = json.NewEncoder(w).Encode(apiErr)
+}
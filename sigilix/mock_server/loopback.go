@@ -0,0 +1,174 @@
+package mock_server
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/json"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/crypto_utils"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/custom_types"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/http_client"
+)
+
+// Loopback is a transport that calls a Server in the same process, without HTTP. Clients that use
+// loopbacks of the same server talk to each other, which makes tests deterministic and fast.
+// Requests are built like the HTTP client builds them; responses are passed through JSON so that
+// the caller gets copies, like over the wire, and errors come back as *http_client.ErrorResponse.
+type Loopback struct {
+	server *Server
+	signer crypto_utils.Signer
+	userId uint64
+}
+
+var _ http_client.Transport = (*Loopback)(nil)
+
+func NewLoopback(server *Server, signer crypto_utils.Signer, userId uint64) *Loopback {
+	return &Loopback{server: server, signer: signer, userId: userId}
+}
+
+// Transport is a http_client.TransportFactory that creates loopbacks of s.
+func (s *Server) Transport(signer crypto_utils.Signer, userId uint64) http_client.Transport {
+	return NewLoopback(s, signer, userId)
+}
+
+func roundTrip(resp custom_types.SigilixStruct, err error, writeTo custom_types.SigilixStruct) error {
+	if err != nil {
+		if apiErr, ok := err.(*ApiError); ok {
+			return &http_client.ErrorResponse{Code: apiErr.Code, Message: apiErr.Message}
+		}
+		return err
+	}
+	encoded, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, writeTo)
+}
+
+func (l *Loopback) Login(ecdsaPublicKey *ecdsa.PublicKey, rsaPublicKey *rsa.PublicKey) (*custom_types.LoginResponse, error) {
+	req, err := http_client.NewLoginRequest(ecdsaPublicKey, rsaPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	resp := &custom_types.LoginResponse{}
+	result, err := l.server.Login(l.userId, req)
+	if err = roundTrip(result, err, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (l *Loopback) SetUsernameConfig(setUsername string, searchable bool) (*custom_types.SetUsernameConfigResponse, error) {
+	req := &custom_types.SetUsernameConfigRequest{
+		Username:                setUsername,
+		SearchByUsernameAllowed: searchable,
+	}
+	resp := &custom_types.SetUsernameConfigResponse{}
+	result, err := l.server.SetUsernameConfig(l.userId, req)
+	if err = roundTrip(result, err, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (l *Loopback) SearchByUsername(searchUsername string) (*custom_types.SearchByUsernameResponse, error) {
+	req := &custom_types.SearchByUsernameRequest{Username: searchUsername}
+	resp := &custom_types.SearchByUsernameResponse{}
+	result, err := l.server.SearchByUsername(l.userId, req)
+	if err = roundTrip(result, err, resp); err != nil {
+		return nil, err
+	}
+	if resp.PublicInfo == nil || resp.PublicInfo.UserId == 0 {
+		return nil, nil
+	}
+	return resp, nil
+}
+
+func (l *Loopback) InitChatFromInitializer(userId uint64) (*custom_types.InitChatFromInitializerResponse, error) {
+	req := &custom_types.InitChatFromInitializerRequest{TargetUserId: userId}
+	resp := &custom_types.InitChatFromInitializerResponse{}
+	result, err := l.server.InitChatFromInitializer(l.userId, req)
+	if err = roundTrip(result, err, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (l *Loopback) InitChatFromReceiver(chatId uint64) (*custom_types.InitChatFromReceiverResponse, error) {
+	req := &custom_types.InitChatFromReceiverRequest{ChatId: chatId}
+	resp := &custom_types.InitChatFromReceiverResponse{}
+	result, err := l.server.InitChatFromReceiver(l.userId, req)
+	if err = roundTrip(result, err, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (l *Loopback) UpdateChatRsaKey(chatId uint64, rsaPublicKey *rsa.PublicKey) (*custom_types.UpdateChatRsaKeyResponse, error) {
+	req, err := http_client.NewUpdateChatRsaKeyRequest(chatId, rsaPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	resp := &custom_types.UpdateChatRsaKeyResponse{}
+	result, err := l.server.UpdateChatRsaKey(l.userId, req)
+	if err = roundTrip(result, err, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (l *Loopback) SendMessage(chatId uint64, message string, rsaPublicKey *rsa.PublicKey) (*custom_types.SendMessageResponse, error) {
+	req, err := http_client.NewSendMessageRequest(l.signer, chatId, message, rsaPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	resp := &custom_types.SendMessageResponse{}
+	result, err := l.server.SendMessage(l.userId, req)
+	if err = roundTrip(result, err, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (l *Loopback) SendFile(chatId uint64, file []byte, mimeType string, rsaPublicKey *rsa.PublicKey) (*custom_types.SendFileResponse, error) {
+	req, err := http_client.NewSendFileRequest(l.signer, chatId, file, mimeType, rsaPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	resp := &custom_types.SendFileResponse{}
+	result, err := l.server.SendFile(l.userId, req)
+	if err = roundTrip(result, err, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (l *Loopback) FetchNotifications(limit uint32) ([]*custom_types.IncomingNotification, error) {
+	req := &custom_types.GetNotificationsRequest{Limit: limit}
+	resp := &custom_types.GetNotificationsResponse{}
+	result, err := l.server.GetNotifications(l.userId, req)
+	if err = roundTrip(result, err, resp); err != nil {
+		return nil, err
+	}
+	return resp.Notifications, nil
+}
+
+func (l *Loopback) DeleteAccount(farewells []*custom_types.SendMessageRequest) (*custom_types.DeleteAccountResponse, error) {
+	req := &custom_types.DeleteAccountRequest{Farewells: farewells}
+	resp := &custom_types.DeleteAccountResponse{}
+	result, err := l.server.DeleteAccount(l.userId, req)
+	if err = roundTrip(result, err, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (l *Loopback) CloseChat(chatId uint64) (*custom_types.CloseChatResponse, error) {
+	req := &custom_types.CloseChatRequest{ChatId: chatId}
+	resp := &custom_types.CloseChatResponse{}
+	result, err := l.server.CloseChat(l.userId, req)
+	if err = roundTrip(result, err, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
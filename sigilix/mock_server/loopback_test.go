@@ -0,0 +1,164 @@
+package mock_server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/crypto_utils"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/custom_types"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/http_client"
+)
+
+// transports returns a new server behind every transport, the tests run against each of them and
+// must see the same results.
+func transports(t *testing.T) map[string]http_client.TransportFactory {
+	t.Helper()
+	servers := make([]*Server, 2)
+	for i := range servers {
+		server, err := NewServer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		servers[i] = server
+	}
+	ts := httptest.NewServer(servers[1])
+	t.Cleanup(ts.Close)
+	return map[string]http_client.TransportFactory{
+		"loopback": servers[0].Transport,
+		"http":     http_client.HttpTransport(ts.URL + "/"),
+	}
+}
+
+type testUser struct {
+	id   uint64
+	keys *crypto_utils.Keyring
+	api  http_client.Transport
+}
+
+func newTestUser(t *testing.T, transport http_client.TransportFactory) *testUser {
+	t.Helper()
+	ecdsaKey, err := crypto_utils.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := crypto_utils.NewRSAKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := crypto_utils.NewKeyring(crypto_utils.PrivateKeyToBytes(ecdsaKey), crypto_utils.RsaPrivateToBytes(rsaKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &testUser{id: crypto_utils.GenerateUserIdByPublicKey(&ecdsaKey.PublicKey), keys: keys}
+	u.api = transport(keys, u.id)
+	if _, err = u.api.Login(keys.EcdsaPublicKey(), keys.RsaPublicKey()); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// fetch returns the queued notifications of u, they are gone from the server afterwards.
+func (u *testUser) fetch(t *testing.T) []custom_types.SomeNotification {
+	t.Helper()
+	incoming, err := u.api.FetchNotifications(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifications := make([]custom_types.SomeNotification, 0, len(incoming))
+	for _, n := range incoming {
+		notifications = append(notifications, n.Notification)
+	}
+	return notifications
+}
+
+func errorCode(err error) int {
+	var apiErr *http_client.ErrorResponse
+	if !errors.As(err, &apiErr) {
+		return 0
+	}
+	return apiErr.Code
+}
+
+func TestChatOverTransports(t *testing.T) {
+	for name, transport := range transports(t) {
+		t.Run(name, func(t *testing.T) {
+			a := newTestUser(t, transport)
+			b := newTestUser(t, transport)
+
+			chat, err := a.api.InitChatFromInitializer(b.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			notifications := b.fetch(t)
+			if len(notifications) != 1 {
+				t.Fatalf("receiver got %d notifications, want 1", len(notifications))
+			}
+			request, ok := notifications[0].(*custom_types.InitChatFromInitializerNotification)
+			if !ok || request.ChatId != chat.ChatId || request.InitializerUserInfo.UserId != a.id {
+				t.Fatalf("receiver got %+v, want the chat request of %d", notifications[0], a.id)
+			}
+			if again := b.fetch(t); len(again) != 0 {
+				t.Fatalf("notifications were delivered twice: %+v", again)
+			}
+
+			if _, err = a.api.SendMessage(chat.ChatId, "too early", b.keys.RsaPublicKey()); errorCode(err) == 0 {
+				t.Fatalf("sending to a chat that is not accepted: got %v, want an api error", err)
+			}
+			if _, err = b.api.InitChatFromReceiver(chat.ChatId); err != nil {
+				t.Fatal(err)
+			}
+			notifications = a.fetch(t)
+			if len(notifications) != 1 {
+				t.Fatalf("initiator got %d notifications, want 1", len(notifications))
+			}
+			if accepted, ok := notifications[0].(*custom_types.InitChatFromReceiverNotification); !ok || accepted.ReceiverUserInfo.UserId != b.id {
+				t.Fatalf("initiator got %+v, want the acceptance of %d", notifications[0], b.id)
+			}
+
+			for i, text := range []string{"first", "second"} {
+				sent, err := a.api.SendMessage(chat.ChatId, text, b.keys.RsaPublicKey())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if sent.MessageId != uint64(i+1) {
+					t.Fatalf("message %q got id %d, want %d", text, sent.MessageId, i+1)
+				}
+			}
+			notifications = b.fetch(t)
+			if len(notifications) != 2 {
+				t.Fatalf("receiver got %d messages, want 2", len(notifications))
+			}
+			for i, want := range []string{"first", "second"} {
+				message, ok := notifications[i].(*custom_types.SendMessageNotification)
+				if !ok {
+					t.Fatalf("receiver got %+v, want a message", notifications[i])
+				}
+				text, err := message.ValidateAndDecrypt(a.keys.EcdsaPublicKey(), b.keys)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(text) != want || message.SenderUserId != a.id {
+					t.Fatalf("message %d is %q from %d, want %q from %d", i, text, message.SenderUserId, want, a.id)
+				}
+			}
+
+			if _, err = b.api.SendMessage(chat.ChatId+1, "nowhere", a.keys.RsaPublicKey()); errorCode(err) != http.StatusNotFound {
+				t.Fatalf("sending to a missing chat: got %v, want not found", err)
+			}
+		})
+	}
+}
+
+func TestLoginChecksUserId(t *testing.T) {
+	for name, transport := range transports(t) {
+		t.Run(name, func(t *testing.T) {
+			u := newTestUser(t, transport)
+			impostor := transport(u.keys, u.id+1)
+			if _, err := impostor.Login(u.keys.EcdsaPublicKey(), u.keys.RsaPublicKey()); errorCode(err) != http.StatusUnauthorized {
+				t.Fatalf("login with another user id: got %v, want unauthorized", err)
+			}
+		})
+	}
+}
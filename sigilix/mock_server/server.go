@@ -0,0 +1,379 @@
+// Package mock_server is an in-memory implementation of the Sigilix server API. It is meant for
+// local development, examples and tests; nothing is persisted and the notification queue is not
+// acknowledged, exactly like the real server hands each notification out once.
+package mock_server
+
+import (
+	"crypto/ecdsa"
+	"net/http"
+	"sync"
+
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/crypto_utils"
+	"github.com/apepenkov/wails_sigilix_interface/sigilix/custom_types"
+)
+
+type ApiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ApiError) Error() string {
+	return e.Message
+}
+
+func newApiError(code int, message string) *ApiError {
+	return &ApiError{Code: code, Message: message}
+}
+
+var (
+	errUnknownUser  = newApiError(http.StatusUnauthorized, "unknown user, login first")
+	errUserNotFound = newApiError(http.StatusNotFound, "user not found")
+	errChatNotFound = newApiError(http.StatusNotFound, "chat not found")
+	errNotInChat    = newApiError(http.StatusForbidden, "not a member of this chat")
+	errNotAccepted  = newApiError(http.StatusBadRequest, "chat not accepted")
+)
+
+type user struct {
+	info          *custom_types.PublicUserInfo
+	searchable    bool
+	notifications []*custom_types.IncomingNotification
+}
+
+type chat struct {
+	chatId        uint64
+	initiatorId   uint64
+	receiverId    uint64
+	accepted      bool
+	lastMessageId uint64
+}
+
+func (c *chat) otherUser(userId uint64) uint64 {
+	if userId == c.initiatorId {
+		return c.receiverId
+	}
+	return c.initiatorId
+}
+
+func (c *chat) hasUser(userId uint64) bool {
+	return userId == c.initiatorId || userId == c.receiverId
+}
+
+type Server struct {
+	mu         sync.Mutex
+	key        *ecdsa.PrivateKey
+	users      map[uint64]*user
+	chats      map[uint64]*chat
+	lastChatId uint64
+}
+
+func NewServer() (*Server, error) {
+	key, err := crypto_utils.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		key:   key,
+		users: make(map[uint64]*user),
+		chats: make(map[uint64]*chat),
+	}, nil
+}
+
+func (s *Server) PublicKey() *ecdsa.PublicKey {
+	return &s.key.PublicKey
+}
+
+// notify queues a notification for userId. Callers must hold s.mu.
+func (s *Server) notify(userId uint64, notification custom_types.SomeNotification) {
+	u, ok := s.users[userId]
+	if !ok {
+		return
+	}
+	u.notifications = append(u.notifications, &custom_types.IncomingNotification{
+		Notification: notification,
+	})
+}
+
+func (s *Server) getUser(userId uint64) (*user, error) {
+	u, ok := s.users[userId]
+	if !ok {
+		return nil, errUnknownUser
+	}
+	return u, nil
+}
+
+func (s *Server) getChat(userId uint64, chatId uint64) (*chat, error) {
+	c, ok := s.chats[chatId]
+	if !ok {
+		return nil, errChatNotFound
+	}
+	if !c.hasUser(userId) {
+		return nil, errNotInChat
+	}
+	return c, nil
+}
+
+// ecdsaKeyOf returns the stored public key used to check request signatures.
+func (s *Server) ecdsaKeyOf(userId uint64) (*ecdsa.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.getUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	return crypto_utils.PublicECDSAKeyFromBytes(u.info.EcdsaPublicKey)
+}
+
+func (s *Server) Login(userId uint64, req *custom_types.LoginRequest) (*custom_types.LoginResponse, error) {
+	ecdsaPub, err := crypto_utils.PublicECDSAKeyFromBytes(req.ClientEcdaPublicKey)
+	if err != nil {
+		return nil, newApiError(http.StatusBadRequest, err.Error())
+	}
+	if _, err = crypto_utils.PublicRSAKeyFromBytes(req.ClientRsaPublicKey); err != nil {
+		return nil, newApiError(http.StatusBadRequest, err.Error())
+	}
+	if !crypto_utils.VerifyUserId(userId, ecdsaPub) {
+		return nil, newApiError(http.StatusUnauthorized, "user id does not match the public key")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userId]
+	if !ok {
+		u = &user{info: &custom_types.PublicUserInfo{UserId: userId}}
+		s.users[userId] = u
+	}
+	u.info.EcdsaPublicKey = req.ClientEcdaPublicKey
+	u.info.InitialRsaPublicKey = req.ClientRsaPublicKey
+
+	return &custom_types.LoginResponse{
+		PrivateInfo: &custom_types.PrivateUserInfo{
+			PublicInfo:              u.info,
+			SearchByUsernameAllowed: u.searchable,
+		},
+		UserId:               userId,
+		ServerEcdsaPublicKey: crypto_utils.PublicECDSAKeyToBytes(&s.key.PublicKey),
+	}, nil
+}
+
+func (s *Server) SetUsernameConfig(userId uint64, req *custom_types.SetUsernameConfigRequest) (*custom_types.SetUsernameConfigResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.getUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	if req.Username != "" {
+		for id, other := range s.users {
+			if id != userId && other.info.Username == req.Username {
+				return nil, newApiError(http.StatusConflict, "username is taken")
+			}
+		}
+	}
+	u.info.Username = req.Username
+	u.searchable = req.SearchByUsernameAllowed
+	return &custom_types.SetUsernameConfigResponse{Success: true}, nil
+}
+
+// DeleteAccount forgets the user with its queued notifications and chats, later requests of the
+// other members of those chats fail with errChatNotFound. Notifications the user sent before are
+// still delivered, followed by the farewells of the request.
+func (s *Server) DeleteAccount(userId uint64, req *custom_types.DeleteAccountRequest) (*custom_types.DeleteAccountResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.getUser(userId); err != nil {
+		return nil, err
+	}
+	farewells := make(map[uint64]*custom_types.SendMessageRequest)
+	for _, farewell := range req.Farewells {
+		farewells[farewell.ChatId] = farewell
+	}
+	delete(s.users, userId)
+	for chatId, c := range s.chats {
+		if !c.hasUser(userId) {
+			continue
+		}
+		delete(s.chats, chatId)
+		if farewell, ok := farewells[chatId]; ok && c.accepted {
+			c.lastMessageId++
+			s.notify(c.otherUser(userId), &custom_types.SendMessageNotification{
+				ChatId:                c.chatId,
+				MessageId:             c.lastMessageId,
+				SenderUserId:          userId,
+				EncryptedMessage:      farewell.EncryptedMessage,
+				MessageEcdsaSignature: farewell.MessageEcdsaSignature,
+			})
+		}
+	}
+	return &custom_types.DeleteAccountResponse{Success: true}, nil
+}
+
+func (s *Server) SearchByUsername(userId uint64, req *custom_types.SearchByUsernameRequest) (*custom_types.SearchByUsernameResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.getUser(userId); err != nil {
+		return nil, err
+	}
+	for _, u := range s.users {
+		if u.searchable && u.info.Username == req.Username {
+			return &custom_types.SearchByUsernameResponse{PublicInfo: u.info}, nil
+		}
+	}
+	return &custom_types.SearchByUsernameResponse{PublicInfo: &custom_types.PublicUserInfo{}}, nil
+}
+
+func (s *Server) InitChatFromInitializer(userId uint64, req *custom_types.InitChatFromInitializerRequest) (*custom_types.InitChatFromInitializerResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.getUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.users[req.TargetUserId]; !ok {
+		return nil, errUserNotFound
+	}
+	if req.TargetUserId == userId {
+		return nil, newApiError(http.StatusBadRequest, "can not start a chat with yourself")
+	}
+	s.lastChatId++
+	c := &chat{
+		chatId:      s.lastChatId,
+		initiatorId: userId,
+		receiverId:  req.TargetUserId,
+	}
+	s.chats[c.chatId] = c
+	s.notify(req.TargetUserId, &custom_types.InitChatFromInitializerNotification{
+		ChatId:              c.chatId,
+		InitializerUserInfo: u.info,
+	})
+	return &custom_types.InitChatFromInitializerResponse{ChatId: c.chatId}, nil
+}
+
+func (s *Server) InitChatFromReceiver(userId uint64, req *custom_types.InitChatFromReceiverRequest) (*custom_types.InitChatFromReceiverResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.getUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.getChat(userId, req.ChatId)
+	if err != nil {
+		return nil, err
+	}
+	if c.receiverId != userId {
+		return nil, newApiError(http.StatusForbidden, "only the receiver can accept a chat")
+	}
+	if c.accepted {
+		return nil, newApiError(http.StatusBadRequest, "chat already accepted")
+	}
+	c.accepted = true
+	s.notify(c.initiatorId, &custom_types.InitChatFromReceiverNotification{
+		ChatId:           c.chatId,
+		ReceiverUserInfo: u.info,
+	})
+	return &custom_types.InitChatFromReceiverResponse{ChatId: c.chatId}, nil
+}
+
+func (s *Server) UpdateChatRsaKey(userId uint64, req *custom_types.UpdateChatRsaKeyRequest) (*custom_types.UpdateChatRsaKeyResponse, error) {
+	if _, err := crypto_utils.PublicRSAKeyFromBytes(req.RsaPublicKey); err != nil {
+		return nil, newApiError(http.StatusBadRequest, err.Error())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.getChat(userId, req.ChatId)
+	if err != nil {
+		return nil, err
+	}
+	s.notify(c.otherUser(userId), &custom_types.UpdateChatRsaKeyNotification{
+		ChatId:       c.chatId,
+		UserId:       userId,
+		RsaPublicKey: req.RsaPublicKey,
+	})
+	return &custom_types.UpdateChatRsaKeyResponse{ChatId: c.chatId}, nil
+}
+
+func (s *Server) SendMessage(userId uint64, req *custom_types.SendMessageRequest) (*custom_types.SendMessageResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.getChat(userId, req.ChatId)
+	if err != nil {
+		return nil, err
+	}
+	if !c.accepted {
+		return nil, errNotAccepted
+	}
+	c.lastMessageId++
+	s.notify(c.otherUser(userId), &custom_types.SendMessageNotification{
+		ChatId:                c.chatId,
+		MessageId:             c.lastMessageId,
+		SenderUserId:          userId,
+		EncryptedMessage:      req.EncryptedMessage,
+		MessageEcdsaSignature: req.MessageEcdsaSignature,
+	})
+	return &custom_types.SendMessageResponse{ChatId: c.chatId, MessageId: c.lastMessageId}, nil
+}
+
+func (s *Server) SendFile(userId uint64, req *custom_types.SendFileRequest) (*custom_types.SendFileResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.getChat(userId, req.ChatId)
+	if err != nil {
+		return nil, err
+	}
+	if !c.accepted {
+		return nil, errNotAccepted
+	}
+	c.lastMessageId++
+	s.notify(c.otherUser(userId), &custom_types.SendFileNotification{
+		ChatId:             c.chatId,
+		MessageId:          c.lastMessageId,
+		SenderUserId:       userId,
+		EncryptedFile:      req.EncryptedFile,
+		EncryptedMimeType:  req.EncryptedMimeType,
+		FileEcdsaSignature: req.FileEcdsaSignature,
+	})
+	return &custom_types.SendFileResponse{ChatId: c.chatId, MessageId: c.lastMessageId}, nil
+}
+
+// CloseChat deletes a chat of the user, messages sent before are still delivered.
+func (s *Server) CloseChat(userId uint64, req *custom_types.CloseChatRequest) (*custom_types.CloseChatResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.getUser(userId); err != nil {
+		return nil, err
+	}
+	if _, err := s.getChat(userId, req.ChatId); err != nil {
+		return nil, err
+	}
+	delete(s.chats, req.ChatId)
+	return &custom_types.CloseChatResponse{ChatId: req.ChatId}, nil
+}
+
+func (s *Server) GetNotifications(userId uint64, req *custom_types.GetNotificationsRequest) (*custom_types.GetNotificationsResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.getUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	count := len(u.notifications)
+	if req.Limit > 0 && int(req.Limit) < count {
+		count = int(req.Limit)
+	}
+	taken := u.notifications[:count]
+	u.notifications = append([]*custom_types.IncomingNotification{}, u.notifications[count:]...)
+	for _, n := range taken {
+		if err = s.signNotification(n); err != nil {
+			return nil, err
+		}
+	}
+	return &custom_types.GetNotificationsResponse{Notifications: taken}, nil
+}
+
+func (s *Server) signNotification(n *custom_types.IncomingNotification) error {
+	encoded, err := n.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	n.EcdsaSignature, err = crypto_utils.SignMessage(s.key, encoded)
+	return err
+}